@@ -3,11 +3,10 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
 	"os"
 
-	"github.com/Sirupsen/logrus"
 	config "github.com/openebs/csi/pkg/config/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
 	service "github.com/openebs/csi/pkg/service/v1alpha1"
 	"github.com/openebs/csi/pkg/version"
 	"github.com/spf13/cobra"
@@ -16,11 +15,33 @@ import (
 func main() {
 	_ = flag.CommandLine.Parse([]string{})
 	var config = config.Default()
+	var featureGates string
+
+	// values set in the environment act as defaults
+	// for the corresponding flags
+	if err := config.LoadEnv(); err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	cmd := &cobra.Command{
 		Use:   "openebs-csi-driver",
 		Short: "openebs-csi-driver",
 		Run: func(cmd *cobra.Command, args []string) {
+			if err := log.SetFormat(config.LogFormat); err != nil {
+				log.Fatalf("%v", err)
+			}
+			if err := log.SetLevel(config.LogLevel); err != nil {
+				log.Fatalf("%v", err)
+			}
+			if err := config.ValidateLogLevelAddress(); err != nil {
+				log.Fatalf("%v", err)
+			}
+			if err := config.SetFeatureGates(featureGates); err != nil {
+				log.Fatalf("%v", err)
+			}
+			if config.MountResyncInterval <= 0 {
+				log.Fatalf("invalid mount resync interval {%v}: should be positive", config.MountResyncInterval)
+			}
 			run(config)
 		},
 	}
@@ -51,6 +72,82 @@ func main() {
 		&config.PluginType, "plugin", "csi-plugin", "Type of this driver i.e. controller or node",
 	)
 
+	cmd.PersistentFlags().StringVar(
+		&config.HealthAddress, "health-address", "", "Address to serve driver readiness at /healthz e.g. :9809, disabled if empty",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&config.MetricsAddress, "metrics-address", "", "Address to serve prometheus metrics at /metrics e.g. :9505, disabled if empty",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&config.TraceExporter, "trace-exporter", "", "Exporter of request traces i.e. none, otlp, stdout or file, disabled if empty",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&config.TraceEndpoint, "trace-endpoint", "", "OTLP/HTTP endpoint e.g. http://otel-collector:4318 for the otlp trace exporter or path of the file for the file trace exporter",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&config.LogLevel, "log-level", config.LogLevel, "Min level of the logs i.e. debug, info, warning or error, can be changed at runtime at /loglevel of the log level address",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&config.LogLevelAddress, "log-level-address", "", "Loopback address to serve and change the log level at /loglevel e.g. localhost:9810, disabled if empty",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&config.LogFormat, "log-format", config.LogFormat, "Format of the logs i.e. json or text",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&featureGates, "feature-gates", "", "Comma separated list of feature=true|false e.g. VolumeStats=true,VolumeExpansion=false",
+	)
+
+	cmd.PersistentFlags().DurationVar(
+		&config.VolumeWaitInterval, "volume-wait-interval", config.VolumeWaitInterval, "Initial interval between checks of volume readiness and reachability",
+	)
+
+	cmd.PersistentFlags().DurationVar(
+		&config.VolumeWaitMaxInterval, "volume-wait-max-interval", config.VolumeWaitMaxInterval, "Max interval between checks of volume readiness and reachability",
+	)
+
+	cmd.PersistentFlags().DurationVar(
+		&config.VolumeWaitTimeout, "volume-wait-timeout", config.VolumeWaitTimeout, "Max time to wait for a volume to be ready and reachable before publishing it",
+	)
+
+	cmd.PersistentFlags().DurationVar(
+		&config.ShutdownGracePeriod, "shutdown-grace-period", config.ShutdownGracePeriod, "Max time to wait for in flight requests to complete on SIGTERM or SIGINT",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&config.StateDir, "state-dir", config.StateDir, "Directory on the node to persist the state of the node plugin e.g. operation journal and iSCSI records",
+	)
+
+	cmd.PersistentFlags().DurationVar(
+		&config.GCInterval, "gc-interval", config.GCInterval, "Interval to garbage collect orphaned iSCSI sessions, mounts and disk links of the node, disabled if zero",
+	)
+
+	cmd.PersistentFlags().DurationVar(
+		&config.MountResyncInterval, "mount-resync-interval", config.MountResyncInterval, "Interval to verify the mounts of all the volumes published on the node even if the mount table has not changed",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&config.GCDryRun, "gc-dry-run", config.GCDryRun, "Only report orphaned iSCSI sessions, mounts and disk links of the node without releasing them, set to false to release them",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&config.ISCSIIface, "iscsi-iface", config.ISCSIIface, "Name of the iface record to log in to the volumes on this node, read from the node labels if empty",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&config.ISCSIIfaceNetdev, "iscsi-iface-netdev", config.ISCSIIfaceNetdev, "Network interface to bind the iface record to e.g. eth1",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&config.ISCSIIfaceHWAddress, "iscsi-iface-hwaddress", config.ISCSIIfaceHWAddress, "Hardware address to bind the iface record to e.g. 00:1b:21:aa:bb:cc",
+	)
+
 	err := cmd.Execute()
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "%s", err.Error())
@@ -63,8 +160,12 @@ func run(config *config.Config) {
 		config.Version = version.Current()
 	}
 
-	logrus.Infof("%s - %s", version.Current(), version.GetGitCommit())
-	logrus.Infof(
+	// every log of the driver carries the plugin
+	// and the node it runs on
+	log.Init(log.Fields{"plugin": config.PluginType, "node": config.NodeID})
+
+	log.Infof("%s - %s", version.Current(), version.GetGitCommit())
+	log.Infof(
 		"DriverName: %s Plugin: %s EndPoint: %s URL: %s NodeID: %s",
 		config.DriverName,
 		config.PluginType,
@@ -72,10 +173,17 @@ func run(config *config.Config) {
 		config.RestURL,
 		config.NodeID,
 	)
+	log.Infof("FeatureGates: %v", config.FeatureGates)
+	log.Infof(
+		"VolumeWait: Interval: %v MaxInterval: %v Timeout: %v",
+		config.VolumeWaitInterval,
+		config.VolumeWaitMaxInterval,
+		config.VolumeWaitTimeout,
+	)
 
 	err := service.New(config).Run()
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatalf("%v", err)
 	}
 	os.Exit(0)
 }
@@ -29,7 +29,8 @@ type CSIVolume struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec CSIVolumeSpec `json:"spec"`
+	Spec   CSIVolumeSpec   `json:"spec"`
+	Status CSIVolumeStatus `json:"status"`
 }
 
 // CSIVolumeSpec is the spec for a CStorVolume resource
@@ -89,6 +90,26 @@ type VolumeInfo struct {
 	// which is returned when the iSCSI
 	// login is successful
 	DevicePath string `json:"devicePath"`
+
+	// RepairPolicy decides if the filesystem
+	// of the volume is repaired before it is
+	// remounted after going read only i.e.
+	// never, auto or manual
+	RepairPolicy string `json:"repairPolicy,omitempty"`
+
+	// DegradedPolicy decides if the volume is
+	// published while fewer replicas than its
+	// replication factor are healthy i.e. allow
+	// or deny
+	DegradedPolicy string `json:"degradedPolicy,omitempty"`
+
+	// PersistentVolumeClaim is the claim bound
+	// to the volume as namespace/name
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
+
+	// Pod is the pod consuming the volume at
+	// the node as namespace/name
+	Pod string `json:"pod,omitempty"`
 }
 
 // ISCSIInfo has ISCSI protocol specific info,
@@ -109,11 +130,145 @@ type ISCSIInfo struct {
 	// IscsiInterface of this volume
 	IscsiInterface string `json:"iscsiInterface"`
 
+	// InitiatorName is the iSCSI initiator
+	// IQN of the node logging in to this
+	// volume
+	InitiatorName string `json:"initiatorName"`
+
+	// SessionSettings are the iscsiadm node
+	// settings e.g. node.session.queue_depth
+	// applied before logging in to this volume
+	SessionSettings map[string]string `json:"sessionSettings,omitempty"`
+
 	// Lun specify the lun number 0, 1.. on
 	// iSCSI Volume. (default: 0)
 	Lun string `json:"lun"`
 }
 
+// CSIVolumePhase represents the current phase of
+// CSIVolume at the node
+type CSIVolumePhase string
+
+const (
+	// CSIVolumePhasePending indicates that the volume
+	// is yet to be attached to the node
+	CSIVolumePhasePending CSIVolumePhase = "Pending"
+
+	// CSIVolumePhaseAttaching indicates that the node
+	// is logging in to the volume & mounting it
+	CSIVolumePhaseAttaching CSIVolumePhase = "Attaching"
+
+	// CSIVolumePhaseMounted indicates that the volume
+	// is mounted in its desired mode
+	CSIVolumePhaseMounted CSIVolumePhase = "Mounted"
+
+	// CSIVolumePhaseRemounting indicates that the
+	// volume lost its desired mount state & is being
+	// remounted
+	CSIVolumePhaseRemounting CSIVolumePhase = "Remounting"
+
+	// CSIVolumePhaseFailed indicates that the last
+	// operation on the volume failed
+	CSIVolumePhaseFailed CSIVolumePhase = "Failed"
+)
+
+// CSIVolumeConditionType is a typed string to
+// represent the type of a CSIVolume condition
+type CSIVolumeConditionType string
+
+const (
+	// CSIVolumeReady is true once the volume is
+	// ready to serve IOs and reachable
+	CSIVolumeReady CSIVolumeConditionType = "VolumeReady"
+
+	// CSIVolumeAttached is true once the node has
+	// logged in to the volume
+	CSIVolumeAttached CSIVolumeConditionType = "Attached"
+
+	// CSIVolumeMounted is true once the volume is
+	// mounted in its desired mode
+	CSIVolumeMounted CSIVolumeConditionType = "Mounted"
+
+	// CSIVolumePathsHealthy indicates if the node is
+	// logged in to all the target portals of the volume
+	CSIVolumePathsHealthy CSIVolumeConditionType = "PathsHealthy"
+
+	// CSIVolumeFilesystemHealthy reports the outcome
+	// of the last check of the filesystem of the
+	// volume after it went read only
+	CSIVolumeFilesystemHealthy CSIVolumeConditionType = "FilesystemHealthy"
+)
+
+// ConditionStatus is the status of a condition
+type ConditionStatus string
+
+const (
+	// ConditionTrue means the condition is met
+	ConditionTrue ConditionStatus = "True"
+
+	// ConditionFalse means the condition is not met
+	ConditionFalse ConditionStatus = "False"
+
+	// ConditionUnknown means it is not known if the
+	// condition is met
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+// CSIVolumeCondition represents the state of an
+// aspect of the volume at the node
+type CSIVolumeCondition struct {
+	// Type of this condition
+	Type CSIVolumeConditionType `json:"type"`
+
+	// Status of this condition
+	Status ConditionStatus `json:"status"`
+
+	// Reason is a single word reason for the
+	// last transition of this condition
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description
+	// of the last transition
+	Message string `json:"message,omitempty"`
+
+	// LastTransitionTime is the time when the
+	// status of this condition last changed
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// CSIVolumePath represents the state of an
+// iSCSI path of the volume at the node
+type CSIVolumePath struct {
+	// Portal of the target this path leads to
+	Portal string `json:"portal"`
+
+	// Active is true if the node has a session
+	// to the target via this path
+	Active bool `json:"active"`
+}
+
+// CSIVolumeStatus represents the current state
+// of CSIVolume at the node
+type CSIVolumeStatus struct {
+	// Phase of the volume at the node
+	Phase CSIVolumePhase `json:"phase,omitempty"`
+
+	// Conditions of the volume at the node
+	Conditions []CSIVolumeCondition `json:"conditions,omitempty"`
+
+	// LastError is the error seen during the
+	// last failed operation on the volume
+	LastError string `json:"lastError,omitempty"`
+
+	// RemountCount is the number of times the
+	// volume has been remounted by the node
+	RemountCount int `json:"remountCount"`
+
+	// Paths are the iSCSI paths of the volume
+	// at the node
+	Paths []CSIVolumePath `json:"paths,omitempty"`
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +resource:path=csivolumes
 
@@ -30,6 +30,7 @@ func (in *CSIVolume) DeepCopyInto(out *CSIVolume) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -51,6 +52,23 @@ func (in *CSIVolume) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CSIVolumeCondition) DeepCopyInto(out *CSIVolumeCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CSIVolumeCondition.
+func (in *CSIVolumeCondition) DeepCopy() *CSIVolumeCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(CSIVolumeCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CSIVolumeList) DeepCopyInto(out *CSIVolumeList) {
 	*out = *in
@@ -84,11 +102,27 @@ func (in *CSIVolumeList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CSIVolumePath) DeepCopyInto(out *CSIVolumePath) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CSIVolumePath.
+func (in *CSIVolumePath) DeepCopy() *CSIVolumePath {
+	if in == nil {
+		return nil
+	}
+	out := new(CSIVolumePath)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CSIVolumeSpec) DeepCopyInto(out *CSIVolumeSpec) {
 	*out = *in
 	in.Volume.DeepCopyInto(&out.Volume)
-	out.ISCSI = in.ISCSI
+	in.ISCSI.DeepCopyInto(&out.ISCSI)
 	return
 }
 
@@ -102,9 +136,44 @@ func (in *CSIVolumeSpec) DeepCopy() *CSIVolumeSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CSIVolumeStatus) DeepCopyInto(out *CSIVolumeStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]CSIVolumeCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]CSIVolumePath, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CSIVolumeStatus.
+func (in *CSIVolumeStatus) DeepCopy() *CSIVolumeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CSIVolumeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ISCSIInfo) DeepCopyInto(out *ISCSIInfo) {
 	*out = *in
+	if in.SessionSettings != nil {
+		in, out := &in.SessionSettings, &out.SessionSettings
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
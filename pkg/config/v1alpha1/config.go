@@ -16,6 +16,60 @@ limitations under the License.
 
 package v1alpha1
 
+import (
+	"fmt"
+	"net"
+	"time"
+
+	env "github.com/openebs/csi/pkg/generated/maya/env/v1alpha1"
+	retry "github.com/openebs/csi/pkg/retry/v1alpha1"
+)
+
+const (
+	// defaultVolumeWaitInterval is the default initial
+	// interval between checks of volume readiness
+	defaultVolumeWaitInterval = 1 * time.Second
+
+	// defaultVolumeWaitMaxInterval is the default max
+	// interval between checks of volume readiness
+	defaultVolumeWaitMaxInterval = 4 * time.Second
+
+	// defaultVolumeWaitTimeout is the default time to
+	// wait for a volume to be ready before publishing
+	// it. This number was arrived at based on the
+	// kubelet's retrying logic which retries to publish
+	// a volume after every 14s
+	defaultVolumeWaitTimeout = 12 * time.Second
+
+	// defaultShutdownGracePeriod is the default time
+	// to wait for the in flight requests to complete
+	// during shutdown
+	defaultShutdownGracePeriod = 30 * time.Second
+
+	// defaultStateDir is the default directory where
+	// the node plugin persists its state
+	defaultStateDir = "/var/lib/openebs/csi"
+
+	// defaultLogLevel is the default min level of the
+	// logs of this driver
+	defaultLogLevel = "info"
+
+	// defaultLogFormat is the default format of the
+	// logs of this driver
+	defaultLogFormat = "json"
+
+	// defaultGCInterval is the default interval after
+	// which the orphaned iSCSI sessions of the node
+	// are garbage collected
+	defaultGCInterval = 10 * time.Minute
+
+	// defaultMountResyncInterval is the default interval
+	// after which all the mounts of the node are verified
+	// even if no change has been noticed in the mount
+	// table
+	defaultMountResyncInterval = 60 * time.Second
+)
+
 // Config struct fills the parameters of request or user input
 type Config struct {
 	// DriverName to be registered at CSI
@@ -46,10 +100,214 @@ type Config struct {
 	// A REST Server is exposed on this URL for internal
 	// operations and Day-2 ops
 	RestURL string
+
+	// HealthAddress is the address on which the
+	// readiness of this driver is served over http
+	//
+	// NOTE:
+	//  Health endpoint is disabled if this is empty
+	HealthAddress string
+
+	// MetricsAddress is the address on which the
+	// prometheus metrics of this driver are served
+	// over http
+	//
+	// NOTE:
+	//  Metrics endpoint is disabled if this is empty
+	MetricsAddress string
+
+	// LogLevelAddress is the address on which the
+	// log level of this driver is served & can be
+	// changed over http
+	//
+	// NOTE:
+	//  This endpoint is not authenticated, hence it
+	// is disabled if this is empty & is served only
+	// on a loopback address
+	LogLevelAddress string
+
+	// TraceExporter is where the spans of the requests
+	// handled by this driver are sent i.e. none, otlp,
+	// stdout or file
+	//
+	// NOTE:
+	//  Tracing is disabled if this is empty
+	TraceExporter string
+
+	// TraceEndpoint is the OTLP/HTTP endpoint e.g.
+	// http://otel-collector:4318 for the otlp exporter
+	// or the path of the file for the file exporter
+	TraceEndpoint string
+
+	// LogLevel is the min level of the logs of this
+	// driver i.e. debug, info, warning or error
+	LogLevel string
+
+	// LogFormat is the format of the logs of this
+	// driver i.e. json or text
+	LogFormat string
+
+	// FeatureGates holds the optional features of this
+	// driver along with their enabled state
+	FeatureGates map[Feature]bool
+
+	// VolumeWaitInterval is the initial interval
+	// between the checks of volume readiness and
+	// reachability
+	VolumeWaitInterval time.Duration
+
+	// VolumeWaitMaxInterval caps the interval
+	// between the checks of volume readiness and
+	// reachability
+	VolumeWaitMaxInterval time.Duration
+
+	// VolumeWaitTimeout is the max time to wait
+	// for a volume to be ready and reachable before
+	// publishing it
+	//
+	// NOTE:
+	//  Publish stops waiting earlier if the deadline
+	// of the request is reached
+	VolumeWaitTimeout time.Duration
+
+	// ShutdownGracePeriod is the max time to wait
+	// for the in flight requests to complete once
+	// the driver is asked to stop. Requests still in
+	// flight after this are cancelled.
+	ShutdownGracePeriod time.Duration
+
+	// StateDir is the directory on the node where the
+	// node plugin persists its state e.g. the journal
+	// of node operations
+	//
+	// NOTE:
+	//  This should be on the host so that the state
+	// survives restarts of the node plugin
+	StateDir string
+
+	// GCInterval is the interval after which the iSCSI
+	// sessions of the node which are not owned by any
+	// volume are logged out
+	//
+	// NOTE:
+	//  Garbage collection is disabled if this is zero
+	GCInterval time.Duration
+
+	// GCDryRun makes the garbage collector only report
+	// the orphaned iSCSI sessions, mounts & links
+	// without releasing them
+	//
+	// NOTE:
+	//  This is enabled by default so that the orphans
+	// are reviewed in the audit log before the garbage
+	// collector is allowed to release them
+	GCDryRun bool
+
+	// MountResyncInterval is the interval after which
+	// the mounts of all the volumes published on this
+	// node are verified even if no change has been
+	// noticed in the mount table
+	MountResyncInterval time.Duration
+
+	// ISCSIIface is the name of the iface record used
+	// to log in to the volumes published on this node
+	//
+	// NOTE:
+	//  The iface set in the labels of the node is used
+	// if this is empty
+	ISCSIIface string
+
+	// ISCSIIfaceNetdev is the network interface to
+	// which ISCSIIface is bound e.g. eth1
+	ISCSIIfaceNetdev string
+
+	// ISCSIIfaceHWAddress is the hardware address to
+	// which ISCSIIface is bound e.g. 00:1b:21:aa:bb:cc
+	ISCSIIfaceHWAddress string
 }
 
 // Default returns a new instance of config
 // required to initialize a driver instance
 func Default() *Config {
-	return &Config{}
+	return &Config{
+		FeatureGates:          newDefaultFeatureGates(),
+		VolumeWaitInterval:    defaultVolumeWaitInterval,
+		VolumeWaitMaxInterval: defaultVolumeWaitMaxInterval,
+		VolumeWaitTimeout:     defaultVolumeWaitTimeout,
+		ShutdownGracePeriod:   defaultShutdownGracePeriod,
+		StateDir:              defaultStateDir,
+		GCInterval:            defaultGCInterval,
+		GCDryRun:              true,
+		MountResyncInterval:   defaultMountResyncInterval,
+		LogLevel:              defaultLogLevel,
+		LogFormat:             defaultLogFormat,
+	}
+}
+
+// LoadEnv overrides the config with the values
+// set in the environment
+func (c *Config) LoadEnv() error {
+	durations := []struct {
+		key   env.ENVKey
+		value *time.Duration
+	}{
+		{env.CSIVolumeWaitInterval, &c.VolumeWaitInterval},
+		{env.CSIVolumeWaitMaxInterval, &c.VolumeWaitMaxInterval},
+		{env.CSIVolumeWaitTimeout, &c.VolumeWaitTimeout},
+		{env.CSIShutdownGracePeriod, &c.ShutdownGracePeriod},
+		{env.CSIGCInterval, &c.GCInterval},
+		{env.CSIMountResyncInterval, &c.MountResyncInterval},
+	}
+
+	if stateDir := env.Get(env.CSIStateDir); stateDir != "" {
+		c.StateDir = stateDir
+	}
+
+	for _, d := range durations {
+		value := env.Get(d.key)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid value {%s} of env {%s}: %v", value, d.key, err)
+		}
+		*d.value = parsed
+	}
+	return nil
+}
+
+// ValidateLogLevelAddress returns an error if the
+// log level address is set to a non loopback address
+// since anyone who reaches it can change the log level
+func (c *Config) ValidateLogLevelAddress() error {
+	if c.LogLevelAddress == "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(c.LogLevelAddress)
+	if err != nil {
+		return fmt.Errorf("invalid log level address {%s}: %v", c.LogLevelAddress, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf(
+		"invalid log level address {%s}: should be a loopback address e.g. localhost:9810",
+		c.LogLevelAddress,
+	)
+}
+
+// VolumeWaitPolicy returns the policy to wait for
+// a volume to be ready and reachable
+func (c *Config) VolumeWaitPolicy() retry.Policy {
+	return retry.Policy{
+		InitialInterval: c.VolumeWaitInterval,
+		MaxInterval:     c.VolumeWaitMaxInterval,
+		Multiplier:      1.5,
+		Jitter:          0.2,
+		MaxElapsedTime:  c.VolumeWaitTimeout,
+	}
 }
@@ -0,0 +1,100 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Feature is a typed string to represent an
+// optional functionality of this driver that
+// can be toggled via feature gates
+type Feature string
+
+const (
+	// VolumeStats enables NodeGetVolumeStats at the
+	// node plugin
+	VolumeStats Feature = "VolumeStats"
+
+	// VolumeExpansion enables NodeExpandVolume at the
+	// node plugin
+	VolumeExpansion Feature = "VolumeExpansion"
+
+	// VolumeCondition enables reporting of abnormal
+	// volume conditions e.g. inactive iSCSI paths in
+	// the volume stats of the node plugin
+	VolumeCondition Feature = "VolumeCondition"
+)
+
+// defaultFeatureGates has the features known to
+// this driver along with their default state
+var defaultFeatureGates = map[Feature]bool{
+	VolumeStats:     true,
+	VolumeExpansion: false,
+	VolumeCondition: false,
+}
+
+// newDefaultFeatureGates returns a copy of the
+// default feature gates
+func newDefaultFeatureGates() map[Feature]bool {
+	gates := map[Feature]bool{}
+	for f, enabled := range defaultFeatureGates {
+		gates[f] = enabled
+	}
+	return gates
+}
+
+// IsFeatureEnabled returns true if the provided
+// feature is enabled
+func (c *Config) IsFeatureEnabled(f Feature) bool {
+	return c.FeatureGates[f]
+}
+
+// SetFeatureGates overrides the feature gates from
+// a comma separated list of key=value pairs e.g.
+// "VolumeStats=true,VolumeExpansion=false"
+func (c *Config) SetFeatureGates(gates string) error {
+	if c.FeatureGates == nil {
+		c.FeatureGates = newDefaultFeatureGates()
+	}
+
+	for _, gate := range strings.Split(gates, ",") {
+		gate = strings.TrimSpace(gate)
+		if gate == "" {
+			continue
+		}
+
+		kv := strings.SplitN(gate, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid feature gate {%s}: expected key=value", gate)
+		}
+
+		f := Feature(strings.TrimSpace(kv[0]))
+		if _, ok := defaultFeatureGates[f]; !ok {
+			return fmt.Errorf("invalid feature gate {%s}: unknown feature {%s}", gate, f)
+		}
+
+		enabled, err := strconv.ParseBool(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return fmt.Errorf("invalid feature gate {%s}: %v", gate, err)
+		}
+		c.FeatureGates[f] = enabled
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sync"
+
+	client "github.com/openebs/csi/pkg/generated/maya/kubernetes/client/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var (
+	// lock guards recorder
+	lock sync.RWMutex
+
+	// recorder emits the events of this driver
+	//
+	// NOTE:
+	//  Events are dropped if this is not set
+	recorder record.EventRecorder
+)
+
+// Init starts recording the events of this driver
+// to kubernetes as the given component of the host
+func Init(component, host string) error {
+	cs, err := client.New().Clientset()
+	if err != nil {
+		return err
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: cs.CoreV1().Events(""),
+	})
+	SetRecorder(broadcaster.NewRecorder(
+		scheme.Scheme,
+		corev1.EventSource{Component: component, Host: host},
+	))
+	return nil
+}
+
+// SetRecorder sets the recorder to emit the events
+// of this driver
+func SetRecorder(r record.EventRecorder) {
+	lock.Lock()
+	defer lock.Unlock()
+	recorder = r
+}
+
+// emit records an event against the given object
+func emit(ref *corev1.ObjectReference, eventType, reason, messageFmt string, args ...interface{}) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if recorder == nil || ref == nil {
+		return
+	}
+	recorder.Eventf(ref, eventType, reason, messageFmt, args...)
+}
+
+// Normal records an event which is informational
+func Normal(ref *corev1.ObjectReference, reason, messageFmt string, args ...interface{}) {
+	emit(ref, corev1.EventTypeNormal, reason, messageFmt, args...)
+}
+
+// Warning records an event which needs attention
+func Warning(ref *corev1.ObjectReference, reason, messageFmt string, args ...interface{}) {
+	emit(ref, corev1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+// Refs are the objects against which an event is
+// recorded e.g. a volume, its claim & its consumer
+type Refs []*corev1.ObjectReference
+
+// Normal records an informational event against
+// each of the objects
+func (r Refs) Normal(reason, messageFmt string, args ...interface{}) {
+	for _, ref := range r {
+		Normal(ref, reason, messageFmt, args...)
+	}
+}
+
+// Warning records an event which needs attention
+// against each of the objects
+func (r Refs) Warning(reason, messageFmt string, args ...interface{}) {
+	for _, ref := range r {
+		Warning(ref, reason, messageFmt, args...)
+	}
+}
+
+// PersistentVolume returns the reference to the
+// given persistent volume
+func PersistentVolume(name string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "PersistentVolume",
+		Name:       name,
+	}
+}
+
+// PersistentVolumeClaim returns the reference to the
+// persistent volume claim with the given namespace
+// and name. Nil is returned if either is empty.
+func PersistentVolumeClaim(namespace, name string) *corev1.ObjectReference {
+	return namespaced("PersistentVolumeClaim", namespace, name)
+}
+
+// Pod returns the reference to the pod with the
+// given namespace and name. Nil is returned if
+// either is empty.
+func Pod(namespace, name string) *corev1.ObjectReference {
+	return namespaced("Pod", namespace, name)
+}
+
+// namespaced returns the reference to the given
+// namespaced object of the core API group
+func namespaced(kind, namespace, name string) *corev1.ObjectReference {
+	if namespace == "" || name == "" {
+		return nil
+	}
+	return &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       kind,
+		Namespace:  namespace,
+		Name:       name,
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRefs(t *testing.T) {
+	tests := map[string]struct {
+		refs     Refs
+		warning  bool
+		expected []string
+	}{
+		"no objects": {
+			refs: nil,
+		},
+		"normal against volume and claim": {
+			refs: Refs{
+				PersistentVolume("pvc-1"),
+				PersistentVolumeClaim("default", "claim-1"),
+			},
+			expected: []string{
+				"Normal Mounted volume {pvc-1} is mounted",
+				"Normal Mounted volume {pvc-1} is mounted",
+			},
+		},
+		"warning against pod": {
+			refs:     Refs{Pod("default", "app-1")},
+			warning:  true,
+			expected: []string{"Warning Mounted volume {pvc-1} is mounted"},
+		},
+		"missing namespace": {
+			refs: Refs{Pod("", "app-1")},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			fake := record.NewFakeRecorder(10)
+			SetRecorder(fake)
+			defer SetRecorder(nil)
+
+			if mock.warning {
+				mock.refs.Warning("Mounted", "volume {%s} is mounted", "pvc-1")
+			} else {
+				mock.refs.Normal("Mounted", "volume {%s} is mounted", "pvc-1")
+			}
+			close(fake.Events)
+
+			var got []string
+			for e := range fake.Events {
+				got = append(got, e)
+			}
+			if len(got) != len(mock.expected) {
+				t.Fatalf("Test {%s} failed: expected events {%v} got {%v}", name, mock.expected, got)
+			}
+			for i := range got {
+				if got[i] != mock.expected[i] {
+					t.Fatalf("Test {%s} failed: expected event {%s} got {%s}", name, mock.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
@@ -57,6 +57,42 @@ const (
 	// This environment variable is set via kubernetes downward API
 	OpenEBSServiceAccount ENVKey = "OPENEBS_SERVICE_ACCOUNT"
 
+	// CSIVolumeWaitInterval is the environment variable to get the initial
+	// interval between the checks of volume readiness & reachability
+	// e.g. 1s
+	CSIVolumeWaitInterval ENVKey = "OPENEBS_IO_CSI_VOLUME_WAIT_INTERVAL"
+
+	// CSIVolumeWaitMaxInterval is the environment variable to get the max
+	// interval between the checks of volume readiness & reachability
+	// e.g. 4s
+	CSIVolumeWaitMaxInterval ENVKey = "OPENEBS_IO_CSI_VOLUME_WAIT_MAX_INTERVAL"
+
+	// CSIVolumeWaitTimeout is the environment variable to get the max time
+	// to wait for a volume to be ready & reachable before publishing it
+	// e.g. 12s
+	CSIVolumeWaitTimeout ENVKey = "OPENEBS_IO_CSI_VOLUME_WAIT_TIMEOUT"
+
+	// CSIShutdownGracePeriod is the environment variable to get the max time
+	// to wait for the in flight requests to complete before the driver exits
+	// e.g. 30s
+	CSIShutdownGracePeriod ENVKey = "OPENEBS_IO_CSI_SHUTDOWN_GRACE_PERIOD"
+
+	// CSIStateDir is the environment variable to get the directory on the
+	// node where the node plugin persists its state
+	// e.g. /var/lib/openebs/csi
+	CSIStateDir ENVKey = "OPENEBS_IO_CSI_STATE_DIR"
+
+	// CSIGCInterval is the environment variable to get the interval after
+	// which the orphaned iSCSI sessions of the node are garbage collected
+	// e.g. 10m
+	CSIGCInterval ENVKey = "OPENEBS_IO_CSI_GC_INTERVAL"
+
+	// CSIMountResyncInterval is the environment variable to get the interval
+	// after which the mounts of all the volumes published on the node are
+	// verified even if no change has been noticed in the mount table
+	// e.g. 60s
+	CSIMountResyncInterval ENVKey = "OPENEBS_IO_CSI_MOUNT_RESYNC_INTERVAL"
+
 	// TODO:
 	//
 	// The constants present here should be moved to respective/relevant packages
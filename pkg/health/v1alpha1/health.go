@@ -0,0 +1,229 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	"golang.org/x/net/context"
+)
+
+// staleIntervals is the number of check intervals
+// after which the outcome of the last run of checks
+// is no longer trusted e.g. if a check hangs
+const staleIntervals = 3
+
+// CheckFunc verifies if a dependency of the
+// driver is usable. A non nil error is the
+// reason why the dependency is not usable
+type CheckFunc func() error
+
+// Check is a named readiness check
+type Check struct {
+	// Name of the dependency being checked
+	Name string
+
+	// Verify checks the dependency
+	Verify CheckFunc
+}
+
+// Checker runs the registered readiness checks in
+// the background and keeps track of the latest
+// outcome
+//
+// NOTE:
+//  Checks may make network calls, hence probes are
+// served the outcome of the last run of checks &
+// never wait for the checks to complete
+type Checker struct {
+	sync.Mutex
+	checks []Check
+
+	// interval is the time between two runs of
+	// the checks
+	interval time.Duration
+
+	// ready & reason are the outcome of the
+	// last run of checks
+	ready  bool
+	reason string
+
+	// checked is the time the last run of checks
+	// completed at
+	checked time.Time
+}
+
+// NewChecker returns a new instance of Checker
+// which runs the checks after every interval
+func NewChecker(interval time.Duration) *Checker {
+	return &Checker{
+		interval: interval,
+		reason:   "readiness checks have not been run",
+	}
+}
+
+// WithCheck registers a new check against this
+// checker
+func (c *Checker) WithCheck(name string, verify CheckFunc) *Checker {
+	c.Lock()
+	defer c.Unlock()
+
+	c.checks = append(c.checks, Check{Name: name, Verify: verify})
+	return c
+}
+
+// Run runs the checks after every interval till the
+// context is done. This blocks and hence should be
+// run as a goroutine.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.Refresh()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh runs all the registered checks and returns
+// if the driver is ready along with the reason if it
+// is not. Checks stop at the first failure.
+func (c *Checker) Refresh() (bool, string) {
+	c.Lock()
+	checks := c.checks
+	c.Unlock()
+
+	// checks are run without the lock so that
+	// probes are served meanwhile
+	ready, reason := true, ""
+	for _, check := range checks {
+		if err := check.Verify(); err != nil {
+			ready, reason = false, fmt.Sprintf("%s: %v", check.Name, err)
+			break
+		}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	// log only when the state changes to avoid
+	// flooding the logs on every run
+	if ready != c.ready || reason != c.reason {
+		if ready {
+			log.Infof("driver is ready")
+		} else {
+			log.Warningf("driver is not ready: %s", reason)
+		}
+	}
+
+	c.ready, c.reason, c.checked = ready, reason, time.Now()
+	return c.ready, c.reason
+}
+
+// Status returns the outcome of the last run of the
+// checks. Driver is not ready if the checks have not
+// completed for a while.
+func (c *Checker) Status() (bool, string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.checked.IsZero() && time.Since(c.checked) > staleIntervals*c.interval {
+		return false, fmt.Sprintf("readiness checks have not completed since %s",
+			c.checked.Format(time.RFC3339))
+	}
+	return c.ready, c.reason
+}
+
+// ServeHTTP replies with 200 if the driver is ready,
+// 503 along with the reason otherwise
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ready, reason := c.Status()
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, reason)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// BinariesPresent returns a check that verifies
+// if the provided binaries are present in PATH
+func BinariesPresent(names ...string) CheckFunc {
+	return func() error {
+		for _, name := range names {
+			if _, err := exec.LookPath(name); err != nil {
+				return fmt.Errorf("binary {%s} not found: %v", name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// When returns a check that runs the provided check
+// only if the condition holds, it succeeds otherwise
+func When(condition func() bool, check CheckFunc) CheckFunc {
+	return func() error {
+		if !condition() {
+			return nil
+		}
+		return check()
+	}
+}
+
+// Flag is a thread safe boolean that can be used
+// to signal completion of a task to a check
+type Flag struct {
+	sync.RWMutex
+	done bool
+}
+
+// Set marks the flag as done
+func (f *Flag) Set() {
+	f.Lock()
+	defer f.Unlock()
+
+	f.done = true
+}
+
+// IsSet returns true if the flag is done
+func (f *Flag) IsSet() bool {
+	f.RLock()
+	defer f.RUnlock()
+
+	return f.done
+}
+
+// Completed returns a check that succeeds once
+// the provided flag is set
+func Completed(f *Flag, task string) CheckFunc {
+	return func() error {
+		if !f.IsSet() {
+			return fmt.Errorf("%s has not completed yet", task)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckerRun(t *testing.T) {
+	pass := func() error { return nil }
+	fail := func() error { return errors.New("not reachable") }
+	flag := &Flag{}
+
+	tests := map[string]struct {
+		checker       *Checker
+		isReady       bool
+		expectedCode  int
+		reasonContain string
+	}{
+		"no checks": {
+			checker:      NewChecker(time.Minute),
+			isReady:      true,
+			expectedCode: http.StatusOK,
+		},
+		"all checks pass": {
+			checker:      NewChecker(time.Minute).WithCheck("a", pass).WithCheck("b", pass),
+			isReady:      true,
+			expectedCode: http.StatusOK,
+		},
+		"one check fails": {
+			checker:       NewChecker(time.Minute).WithCheck("a", pass).WithCheck("backend", fail),
+			isReady:       false,
+			expectedCode:  http.StatusServiceUnavailable,
+			reasonContain: "backend: not reachable",
+		},
+		"task not completed": {
+			checker:       NewChecker(time.Minute).WithCheck("recovery", Completed(flag, "recovery")),
+			isReady:       false,
+			expectedCode:  http.StatusServiceUnavailable,
+			reasonContain: "recovery has not completed yet",
+		},
+		"missing binary": {
+			checker:       NewChecker(time.Minute).WithCheck("tools", BinariesPresent("no-such-binary-csi")),
+			isReady:       false,
+			expectedCode:  http.StatusServiceUnavailable,
+			reasonContain: "no-such-binary-csi",
+		},
+		"conditional check skipped": {
+			checker: NewChecker(time.Minute).WithCheck("xfs tools",
+				When(func() bool { return false }, BinariesPresent("no-such-binary-csi"))),
+			isReady:      true,
+			expectedCode: http.StatusOK,
+		},
+		"conditional check run": {
+			checker: NewChecker(time.Minute).WithCheck("xfs tools",
+				When(func() bool { return true }, BinariesPresent("no-such-binary-csi"))),
+			isReady:       false,
+			expectedCode:  http.StatusServiceUnavailable,
+			reasonContain: "xfs tools: binary {no-such-binary-csi} not found",
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			ready, reason := mock.checker.Refresh()
+			if ready != mock.isReady {
+				t.Fatalf("expected ready {%t} got {%t}: %s", mock.isReady, ready, reason)
+			}
+			if !strings.Contains(reason, mock.reasonContain) {
+				t.Fatalf("expected reason to contain {%s} got {%s}", mock.reasonContain, reason)
+			}
+
+			if cached, _ := mock.checker.Status(); cached != mock.isReady {
+				t.Fatalf("expected cached ready {%t} got {%t}", mock.isReady, cached)
+			}
+			rec := httptest.NewRecorder()
+			mock.checker.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+			if rec.Code != mock.expectedCode {
+				t.Fatalf("expected http code {%d} got {%d}", mock.expectedCode, rec.Code)
+			}
+		})
+	}
+}
+
+func TestCheckerStatus(t *testing.T) {
+	release := make(chan struct{})
+	c := NewChecker(time.Minute).WithCheck("backend", func() error {
+		<-release
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		c.Refresh()
+		close(done)
+	}()
+
+	// status is served while the checks are running
+	if ready, reason := c.Status(); ready || !strings.Contains(reason, "have not been run") {
+		t.Fatalf("expected not ready before the checks complete got {%t}: %s", ready, reason)
+	}
+	close(release)
+	<-done
+	if ready, reason := c.Status(); !ready {
+		t.Fatalf("expected ready after the checks complete got: %s", reason)
+	}
+
+	// outcome is not trusted once the checks have not
+	// completed for a while
+	c.Lock()
+	c.checked = time.Now().Add(-staleIntervals*time.Minute - time.Second)
+	c.Unlock()
+	if ready, reason := c.Status(); ready || !strings.Contains(reason, "have not completed since") {
+		t.Fatalf("expected not ready with stale checks got {%t}: %s", ready, reason)
+	}
+}
+
+func TestCompletedFlag(t *testing.T) {
+	flag := &Flag{}
+	check := Completed(flag, "recovery")
+	if err := check(); err == nil {
+		t.Fatalf("expected error before flag is set")
+	}
+	flag.Set()
+	if err := check(); err != nil {
+		t.Fatalf("expected no error after flag is set got: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+)
+
+var (
+	// credentialsLock guards credentials
+	credentialsLock sync.RWMutex
+
+	// credentials holds the CHAP secrets of the
+	// volumes keyed by volume name
+	//
+	// NOTE:
+	//  These are persisted next to the record of the
+	// volume in RecordDir so that the volume can be
+	// logged in again e.g. on remount after a restart
+	// of the driver, when there are no publish secrets
+	credentials = map[string]map[string]string{}
+)
+
+// credentialsPath returns the path of the file where
+// the CHAP secrets of the provided volume are persisted
+func credentialsPath(volName string) string {
+	return filepath.Join(RecordDir, volName+".chap")
+}
+
+// persistCredentials saves the CHAP secrets of the
+// volume, readable only by the driver. The file is
+// replaced atomically so that a crash never leaves
+// partial secrets.
+func persistCredentials(volName string, chap map[string]string) error {
+	if err := os.MkdirAll(RecordDir, 0700); err != nil {
+		return fmt.Errorf("iscsi: create %s err %s", RecordDir, err)
+	}
+
+	data, err := json.Marshal(chap)
+	if err != nil {
+		return fmt.Errorf("iscsi: encode credentials of %s err %v", volName, err)
+	}
+
+	file := credentialsPath(volName)
+	tmp := file + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("iscsi: create %s err %s", tmp, err)
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("iscsi: rename %s err %s", tmp, err)
+	}
+	return nil
+}
+
+// loadCredentials returns the persisted CHAP secrets
+// of the volume, nil if there are none
+func loadCredentials(volName string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(credentialsPath(volName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("iscsi: open credentials of %s err %s", volName, err)
+	}
+
+	chap := map[string]string{}
+	if err = json.Unmarshal(data, &chap); err != nil {
+		return nil, fmt.Errorf("iscsi: decode credentials of %s err %v", volName, err)
+	}
+	return chap, nil
+}
+
+// removeCredentials deletes the persisted CHAP
+// secrets of the volume
+func removeCredentials(volName string) error {
+	err := os.Remove(credentialsPath(volName))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("iscsi: remove credentials of %s err %s", volName, err)
+	}
+	return nil
+}
+
+// SetCredentials sets the CHAP secrets to be used to
+// log in to the volume. Secrets are expected to be
+// keyed by the iscsiadm settings e.g.
+// node.session.auth.username. Discovery and session
+// CHAP are enabled if their username is provided.
+func SetCredentials(volName string, secrets map[string]string) error {
+	chap := map[string]string{}
+	for _, keys := range [][]string{chapSt, chapSess} {
+		for _, k := range keys {
+			if v := secrets[k]; v != "" {
+				chap[k] = v
+			}
+		}
+	}
+
+	// only the names of the settings are reported,
+	// values of the secrets are never logged
+	pairs := [][2]string{
+		{chapSt[0], chapSt[1]},
+		{chapSt[2], chapSt[3]},
+		{chapSess[0], chapSess[1]},
+		{chapSess[2], chapSess[3]},
+	}
+	for _, pair := range pairs {
+		if (chap[pair[0]] == "") != (chap[pair[1]] == "") {
+			return fmt.Errorf("iscsi: both %s and %s are required for CHAP", pair[0], pair[1])
+		}
+	}
+	for _, pair := range [][2]string{{chapSt[2], chapSt[0]}, {chapSess[2], chapSess[0]}} {
+		if chap[pair[0]] != "" && chap[pair[1]] == "" {
+			return fmt.Errorf("iscsi: mutual CHAP %s requires %s", pair[0], pair[1])
+		}
+	}
+
+	credentialsLock.Lock()
+	defer credentialsLock.Unlock()
+	if len(chap) == 0 {
+		delete(credentials, volName)
+		return removeCredentials(volName)
+	}
+	if err := persistCredentials(volName, chap); err != nil {
+		return err
+	}
+	credentials[volName] = chap
+	return nil
+}
+
+// ClearCredentials forgets the CHAP secrets of
+// the volume
+func ClearCredentials(volName string) {
+	credentialsLock.Lock()
+	defer credentialsLock.Unlock()
+	delete(credentials, volName)
+	if err := removeCredentials(volName); err != nil {
+		log.Warningf("%v", err)
+	}
+}
+
+// applyCredentials enables CHAP for the disk if
+// secrets have been set for its volume. Secrets
+// persisted before a restart of the driver are
+// used if none have been set since.
+func applyCredentials(disk *iscsiDisk) {
+	credentialsLock.Lock()
+	defer credentialsLock.Unlock()
+
+	chap, ok := credentials[disk.VolName]
+	if !ok {
+		persisted, err := loadCredentials(disk.VolName)
+		if err != nil {
+			log.Warningf("%v", err)
+		}
+		if len(persisted) == 0 {
+			return
+		}
+		chap = persisted
+		credentials[disk.VolName] = chap
+	}
+	disk.secret = chap
+	disk.chapDiscovery = chap[chapSt[0]] != ""
+	disk.chapSession = chap[chapSess[0]] != ""
+}
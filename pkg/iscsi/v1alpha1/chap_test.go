@@ -0,0 +1,159 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csi-iscsi-chap")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	RecordDir = dir
+
+	tests := map[string]struct {
+		secrets          map[string]string
+		isErr            bool
+		expectDiscovery  bool
+		expectSession    bool
+		expectSecretKeys int
+	}{
+		"no secrets": {
+			secrets: nil,
+		},
+		"unrelated secrets are ignored": {
+			secrets: map[string]string{"foo": "bar"},
+		},
+		"session chap": {
+			secrets: map[string]string{
+				"node.session.auth.username": "user",
+				"node.session.auth.password": "secret",
+			},
+			expectSession:    true,
+			expectSecretKeys: 2,
+		},
+		"discovery and mutual session chap": {
+			secrets: map[string]string{
+				"discovery.sendtargets.auth.username": "user",
+				"discovery.sendtargets.auth.password": "secret",
+				"node.session.auth.username":          "user",
+				"node.session.auth.password":          "secret",
+				"node.session.auth.username_in":       "target",
+				"node.session.auth.password_in":       "target-secret",
+			},
+			expectDiscovery:  true,
+			expectSession:    true,
+			expectSecretKeys: 6,
+		},
+		"password missing": {
+			secrets: map[string]string{"node.session.auth.username": "chap-user-1"},
+			isErr:   true,
+		},
+		"mutual chap without chap": {
+			secrets: map[string]string{
+				"node.session.auth.username_in": "target",
+				"node.session.auth.password_in": "target-secret",
+			},
+			isErr: true,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			defer ClearCredentials("pvc-1")
+
+			err := SetCredentials("pvc-1", mock.secrets)
+			if mock.isErr {
+				if err == nil {
+					t.Fatalf("expected error got nil")
+				}
+				for _, v := range mock.secrets {
+					if strings.Contains(err.Error(), v) {
+						t.Fatalf("expected error to not reveal secrets got: %v", err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error got: %v", err)
+			}
+
+			disk := &iscsiDisk{VolName: "pvc-1"}
+			applyCredentials(disk)
+			if disk.chapDiscovery != mock.expectDiscovery || disk.chapSession != mock.expectSession {
+				t.Fatalf("expected discovery/session chap {%t/%t} got {%t/%t}",
+					mock.expectDiscovery, mock.expectSession, disk.chapDiscovery, disk.chapSession)
+			}
+			if len(disk.secret) != mock.expectSecretKeys {
+				t.Fatalf("expected {%d} secrets got {%d}", mock.expectSecretKeys, len(disk.secret))
+			}
+		})
+	}
+}
+
+func TestCredentialsSurviveRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csi-iscsi-chap")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	RecordDir = dir
+
+	secrets := map[string]string{
+		"node.session.auth.username": "user",
+		"node.session.auth.password": "secret",
+	}
+	if err = SetCredentials("pvc-1", secrets); err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	info, err := os.Stat(credentialsPath("pvc-1"))
+	if err != nil {
+		t.Fatalf("expected credentials to be persisted got: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected credentials mode {0600} got {%v}", info.Mode().Perm())
+	}
+
+	// restart of the driver loses the secrets held
+	// in memory
+	credentialsLock.Lock()
+	credentials = map[string]map[string]string{}
+	credentialsLock.Unlock()
+
+	disk := &iscsiDisk{VolName: "pvc-1"}
+	applyCredentials(disk)
+	if !disk.chapSession || disk.secret["node.session.auth.password"] != "secret" {
+		t.Fatalf("expected persisted session chap got %+v", disk.secret)
+	}
+
+	ClearCredentials("pvc-1")
+	if _, err = os.Stat(credentialsPath("pvc-1")); !os.IsNotExist(err) {
+		t.Fatalf("expected credentials to be removed got: %v", err)
+	}
+	disk = &iscsiDisk{VolName: "pvc-1"}
+	applyCredentials(disk)
+	if disk.chapSession {
+		t.Fatalf("expected no chap after credentials are cleared")
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"fmt"
+	"net"
+
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+const (
+	// DefaultIface is the iface record of open-iscsi
+	// which lets the kernel route the iSCSI traffic
+	DefaultIface = "default"
+
+	// ifaceNetdevKey is the iface setting to bind the
+	// iSCSI traffic to a network interface
+	ifaceNetdevKey = "iface.net_ifacename"
+
+	// ifaceHWAddressKey is the iface setting to bind
+	// the iSCSI traffic to a hardware address
+	ifaceHWAddressKey = "iface.hwaddress"
+)
+
+// NodeIface is the iface record used to log in to
+// all the volumes published on this node
+//
+// NOTE:
+//  The iface of the volume is used if this is empty
+var NodeIface string
+
+// Iface binds the iSCSI traffic of the node to a
+// network interface or a hardware address
+type Iface struct {
+	// Name of the iface record
+	Name string
+
+	// NetDev is the network interface e.g. eth1
+	NetDev string
+
+	// HWAddress is the MAC address of the interface
+	// e.g. 00:1b:21:aa:bb:cc or 00-1b-21-aa-bb-cc
+	HWAddress string
+}
+
+// IsDefault returns true if the iSCSI traffic is
+// not bound to any interface
+func (i Iface) IsDefault() bool {
+	return i.Name == "" || i.Name == DefaultIface
+}
+
+// Validate checks if the iface can be created
+func (i Iface) Validate() error {
+	if i.IsDefault() {
+		if i.NetDev != "" || i.HWAddress != "" {
+			return fmt.Errorf("iface name is required to bind to netdev {%s} hwaddress {%s}", i.NetDev, i.HWAddress)
+		}
+		return nil
+	}
+	if i.NetDev == "" && i.HWAddress == "" {
+		return fmt.Errorf("netdev or hwaddress is required for iface {%s}", i.Name)
+	}
+	if i.HWAddress != "" {
+		if _, err := net.ParseMAC(i.HWAddress); err != nil {
+			return fmt.Errorf("invalid hwaddress {%s} of iface {%s}: %v", i.HWAddress, i.Name, err)
+		}
+	}
+	return nil
+}
+
+// EnsureIface creates the iface record if it is not
+// present and binds it to the configured netdev
+// and hardware address. The record is updated if it
+// is present already so that changes of the node
+// config are applied on restart of the driver.
+func EnsureIface(iface Iface) error {
+	return ensureIface(mount.NewOsExec(), iface)
+}
+
+func ensureIface(exec mount.Exec, iface Iface) error {
+	if err := iface.Validate(); err != nil {
+		return err
+	}
+	if iface.IsDefault() {
+		return nil
+	}
+
+	if _, err := exec.Run("iscsiadm", "-m", "iface", "-I", iface.Name, "-o", "show"); err != nil {
+		log.Infof("iscsi: creating iface {%s}", iface.Name)
+		out, err := exec.Run("iscsiadm", "-m", "iface", "-I", iface.Name, "-o", "new")
+		if err != nil {
+			return fmt.Errorf("failed to create iface {%s}: %s (%v)", iface.Name, string(out), err)
+		}
+	}
+
+	// iscsiadm expects the hardware address to be
+	// colon separated, it may be dash separated when
+	// read from a node label
+	hwAddress := ""
+	if iface.HWAddress != "" {
+		mac, _ := net.ParseMAC(iface.HWAddress)
+		hwAddress = mac.String()
+	}
+
+	settings := [][2]string{
+		{ifaceNetdevKey, iface.NetDev},
+		{ifaceHWAddressKey, hwAddress},
+	}
+	for _, s := range settings {
+		if s[1] == "" {
+			continue
+		}
+		out, err := exec.Run("iscsiadm", "-m", "iface", "-I", iface.Name, "-o", "update", "-n", s[0], "-v", s[1])
+		if err != nil {
+			return fmt.Errorf("failed to set {%s} of iface {%s}: %s (%v)", s[0], iface.Name, string(out), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+func TestEnsureIface(t *testing.T) {
+	tests := map[string]struct {
+		iface        Iface
+		present      bool
+		expectedCmds []string
+		isErr        bool
+	}{
+		"default iface": {
+			iface:        Iface{Name: DefaultIface},
+			expectedCmds: nil,
+		},
+		"default iface with netdev": {
+			iface: Iface{NetDev: "eth1"},
+			isErr: true,
+		},
+		"iface without binding": {
+			iface: Iface{Name: "iface0"},
+			isErr: true,
+		},
+		"invalid hwaddress": {
+			iface: Iface{Name: "iface0", HWAddress: "not-a-mac"},
+			isErr: true,
+		},
+		"missing iface is created": {
+			iface: Iface{Name: "iface0", NetDev: "eth1"},
+			expectedCmds: []string{
+				"-m iface -I iface0 -o show",
+				"-m iface -I iface0 -o new",
+				"-m iface -I iface0 -o update -n iface.net_ifacename -v eth1",
+			},
+		},
+		"present iface is updated": {
+			iface:   Iface{Name: "iface0", HWAddress: "00-1B-21-AA-BB-CC"},
+			present: true,
+			expectedCmds: []string{
+				"-m iface -I iface0 -o show",
+				"-m iface -I iface0 -o update -n iface.hwaddress -v 00:1b:21:aa:bb:cc",
+			},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			var cmds []string
+			exec := mount.NewFakeExec(func(cmd string, args ...string) ([]byte, error) {
+				cmds = append(cmds, strings.Join(args, " "))
+				if args[len(args)-1] == "show" && !mock.present {
+					return nil, errors.New("iface not found")
+				}
+				return nil, nil
+			})
+			err := ensureIface(exec, mock.iface)
+			if mock.isErr != (err != nil) {
+				t.Fatalf("Test {%s} failed: expected error {%v} got {%v}", name, mock.isErr, err)
+			}
+			if !reflect.DeepEqual(cmds, mock.expectedCmds) {
+				t.Fatalf("Test {%s} failed: expected commands {%v} got {%v}", name, mock.expectedCmds, cmds)
+			}
+		})
+	}
+}
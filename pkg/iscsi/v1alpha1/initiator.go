@@ -0,0 +1,72 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// initiatorNameKey is the key of the initiator IQN
+// in the initiator name file of open-iscsi
+const initiatorNameKey = "InitiatorName"
+
+// InitiatorNameFile is the file of open-iscsi which
+// holds the initiator IQN of this node
+var InitiatorNameFile = "/etc/iscsi/initiatorname.iscsi"
+
+// NodeInitiator is the initiator IQN of this node
+// read once on start of the node plugin
+//
+// NOTE:
+//  This is empty if the initiator name file could
+// not be read
+var NodeInitiator string
+
+// ReadInitiatorName returns the initiator IQN which
+// iscsid uses to log in to the targets
+func ReadInitiatorName() (string, error) {
+	data, err := ioutil.ReadFile(InitiatorNameFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read initiator name: %v", err)
+	}
+	iqn := parseInitiatorName(string(data))
+	if iqn == "" {
+		return "", fmt.Errorf("initiator name is not set in {%s}", InitiatorNameFile)
+	}
+	return iqn, nil
+}
+
+// parseInitiatorName parses the initiator IQN from
+// the contents of the initiator name file e.g.
+//
+//  ## DO NOT EDIT OR REMOVE THIS FILE!
+//  InitiatorName=iqn.1993-08.org.debian:01:abcdef
+func parseInitiatorName(data string) string {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == initiatorNameKey {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"testing"
+)
+
+func TestParseInitiatorName(t *testing.T) {
+	tests := map[string]struct {
+		data     string
+		expected string
+	}{
+		"empty file": {
+			data:     "",
+			expected: "",
+		},
+		"initiator name": {
+			data:     "InitiatorName=iqn.1993-08.org.debian:01:abcdef\n",
+			expected: "iqn.1993-08.org.debian:01:abcdef",
+		},
+		"with comments and spaces": {
+			data:     "## DO NOT EDIT OR REMOVE THIS FILE!\n#InitiatorName=iqn.old\n InitiatorName = iqn.1993-08.org.debian:01:abcdef \n",
+			expected: "iqn.1993-08.org.debian:01:abcdef",
+		},
+		"only commented": {
+			data:     "#InitiatorName=iqn.old\n",
+			expected: "",
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			if got := parseInitiatorName(mock.data); got != mock.expected {
+				t.Fatalf("Test {%s} failed: expected {%s} got {%s}", name, mock.expected, got)
+			}
+		})
+	}
+}
@@ -17,30 +17,12 @@ limitations under the License.
 package iscsi
 
 import (
-	"encoding/json"
-	"strings"
-
 	"k8s.io/kubernetes/pkg/util/mount"
 	"k8s.io/kubernetes/pkg/volume"
 	"k8s.io/kubernetes/pkg/volume/util"
 	"k8s.io/utils/keymutex"
 )
 
-func portalMounter(portal string) string {
-	if !strings.Contains(portal, ":") {
-		portal = portal + ":3260"
-	}
-	return portal
-}
-
-func parseSecret(secretParams string) map[string]string {
-	var secret map[string]string
-	if err := json.Unmarshal([]byte(secretParams), &secret); err != nil {
-		return nil
-	}
-	return secret
-}
-
 type iscsiDisk struct {
 	Portals       []string
 	Iqn           string
@@ -51,6 +33,9 @@ type iscsiDisk struct {
 	secret        map[string]string
 	InitiatorName string
 	VolName       string
+	// SessionSettings are the iscsiadm node
+	// settings applied before login
+	SessionSettings map[string]string
 }
 
 type iscsiPlugin struct {
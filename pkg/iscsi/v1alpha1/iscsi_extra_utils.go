@@ -1,7 +1,7 @@
 package iscsi
 
 import (
-	"fmt"
+	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
@@ -9,63 +9,43 @@ import (
 	"k8s.io/kubernetes/pkg/volume/util"
 )
 
-func getISCSIInfo(vol *apis.CSIVolume) (*iscsiDisk, error) {
-	portal := portalMounter(vol.Spec.ISCSI.TargetPortal)
-	var portals []string
-	portals = append(portals, portal)
-
-	chapDiscovery := false
-	chapSession := false
-
-	return &iscsiDisk{
-		VolName:       vol.Spec.Volume.Name,
-		Portals:       portals,
-		Iqn:           vol.Spec.ISCSI.Iqn,
-		lun:           vol.Spec.ISCSI.Lun,
-		Iface:         vol.Spec.ISCSI.IscsiInterface,
-		chapDiscovery: chapDiscovery,
-		chapSession:   chapSession}, nil
-}
-
-func getISCSIInfoFromPV(req *csi.NodePublishVolumeRequest) (*iscsiDisk, error) {
-	volName := req.GetVolumeId()
-	tp := req.GetVolumeContext()["targetPortal"]
-	iqn := req.GetVolumeContext()["iqn"]
-	lun := req.GetVolumeContext()["lun"]
-	if tp == "" || iqn == "" || lun == "" {
-		return nil, fmt.Errorf("iSCSI target information is missing")
+// targetPortals returns all the target portals of
+// the volume with its primary target portal first.
+// Portals which are discovered from the target
+// while attaching the volume are read from its
+// record.
+func targetPortals(vol *apis.CSIVolume) []string {
+	portals := []string{NormalizePortal(vol.Spec.ISCSI.TargetPortal)}
+	for _, portal := range strings.Split(vol.Spec.ISCSI.Portals, ",") {
+		portal = strings.TrimSpace(portal)
+		if portal == "" {
+			continue
+		}
+		portals = append(portals, NormalizePortal(portal))
 	}
 
-	//portalList := req.GetVolumeContext()["portals"]
-	secretParams := req.GetVolumeContext()["secret"]
-	secret := parseSecret(secretParams)
-
-	portal := portalMounter(tp)
-	var portals []string
-	portals = append(portals, portal)
-
-	iface := req.GetVolumeContext()["iscsiInterface"]
-	initiatorName := req.GetVolumeContext()["initiatorName"]
-	chapDiscovery := false
-	if req.GetVolumeContext()["discoveryCHAPAuth"] == "true" {
-		chapDiscovery = true
+	recorded := &iscsiDisk{VolName: vol.Spec.Volume.Name}
+	if vol.Spec.Volume.Name != "" && HasRecord(vol.Spec.Volume.Name) {
+		if err := (&ISCSIUtil{}).loadISCSI(recorded, ""); err == nil {
+			portals = append(portals, recorded.Portals...)
+		}
 	}
+	return removeDuplicate(portals)
+}
 
-	chapSession := false
-	if req.GetVolumeContext()["sessionCHAPAuth"] == "true" {
-		chapSession = true
+func getISCSIInfo(vol *apis.CSIVolume) (*iscsiDisk, error) {
+	disk := &iscsiDisk{
+		VolName:         vol.Spec.Volume.Name,
+		Portals:         targetPortals(vol),
+		Iqn:             vol.Spec.ISCSI.Iqn,
+		lun:             vol.Spec.ISCSI.Lun,
+		Iface:           vol.Spec.ISCSI.IscsiInterface,
+		SessionSettings: vol.Spec.ISCSI.SessionSettings,
 	}
-
-	return &iscsiDisk{
-		VolName:       volName,
-		Portals:       portals,
-		Iqn:           iqn,
-		lun:           lun,
-		Iface:         iface,
-		chapDiscovery: chapDiscovery,
-		chapSession:   chapSession,
-		secret:        secret,
-		InitiatorName: initiatorName}, nil
+	// CHAP is enabled as per the secrets received
+	// while publishing the volume
+	applyCredentials(disk)
+	return disk, nil
 }
 
 func getISCSIDiskMounter(iscsiInfo *iscsiDisk, vol *apis.CSIVolume) *iscsiDiskMounter {
@@ -0,0 +1,89 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+)
+
+func TestTargetPortals(t *testing.T) {
+	tests := map[string]struct {
+		targetPortal string
+		portals      string
+		recorded     []string
+		expected     []string
+	}{
+		"single portal": {
+			targetPortal: "10.0.0.1:3260",
+			expected:     []string{"10.0.0.1:3260"},
+		},
+		"portals same as target portal": {
+			targetPortal: "10.0.0.1:3260",
+			portals:      "10.0.0.1:3260",
+			expected:     []string{"10.0.0.1:3260"},
+		},
+		"multiple portals": {
+			targetPortal: "10.0.0.2:3260",
+			portals:      "10.0.0.1:3260, 10.0.0.2:3260,10.0.0.3",
+			expected:     []string{"10.0.0.2:3260", "10.0.0.1:3260", "10.0.0.3:3260"},
+		},
+		"dual stack portals": {
+			targetPortal: "fd00::10",
+			portals:      "[fd00::10]:3260,10.0.0.1:3260,fd00::11",
+			expected:     []string{"[fd00::10]:3260", "10.0.0.1:3260", "[fd00::11]:3260"},
+		},
+		"portals discovered from the target": {
+			targetPortal: "10.0.0.1:3260",
+			portals:      "10.0.0.1:3260",
+			recorded:     []string{"10.0.0.1:3260", "10.0.0.2:3260"},
+			expected:     []string{"10.0.0.1:3260", "10.0.0.2:3260"},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "csi-iscsi-record")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			RecordDir = dir
+
+			vol := &apis.CSIVolume{}
+			vol.Spec.Volume.Name = "pvc-1"
+			vol.Spec.ISCSI.TargetPortal = mock.targetPortal
+			vol.Spec.ISCSI.Portals = mock.portals
+			if mock.recorded != nil {
+				err = (&ISCSIUtil{}).persistISCSI(iscsiDisk{VolName: "pvc-1", Portals: mock.recorded})
+				if err != nil {
+					t.Fatalf("failed to persist record: %v", err)
+				}
+			}
+
+			got := targetPortals(vol)
+			if !reflect.DeepEqual(got, mock.expected) {
+				t.Fatalf("expected portals {%v} got {%v}", mock.expected, got)
+			}
+		})
+	}
+}
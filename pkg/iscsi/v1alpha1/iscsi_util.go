@@ -17,19 +17,26 @@ limitations under the License.
 package iscsi
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
-	"github.com/golang/glog"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	metrics "github.com/openebs/csi/pkg/metrics/v1alpha1"
+	trace "github.com/openebs/csi/pkg/trace/v1alpha1"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/context"
 	"k8s.io/kubernetes/pkg/util/mount"
 )
 
+// multipathWaitRetries is the number of seconds to
+// wait for multipath to assemble the device of a
+// volume with more than one path
+const multipathWaitRetries = 10
+
 var (
 	chapSt = []string{
 		"discovery.sendtargets.auth.username",
@@ -58,7 +65,7 @@ func updateISCSIDiscoverydb(b iscsiDiskMounter, tp string) error {
 		if len(v) > 0 {
 			out, err := b.exec.Run("iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", tp, "-I", b.Iface, "-o", "update", "-n", k, "-v", v)
 			if err != nil {
-				return fmt.Errorf("iscsi: failed to update discoverydb key %q with value %q error: %v", k, v, string(out))
+				return fmt.Errorf("iscsi: failed to update discoverydb key %q error: %v", k, string(out))
 			}
 		}
 	}
@@ -80,7 +87,7 @@ func updateISCSINode(b iscsiDiskMounter, tp string) error {
 		if len(v) > 0 {
 			out, err := b.exec.Run("iscsiadm", "-m", "node", "-p", tp, "-T", b.Iqn, "-I", b.Iface, "-o", "update", "-n", k, "-v", v)
 			if err != nil {
-				return fmt.Errorf("iscsi: failed to update node session key %q with value %q error: %v", k, v, string(out))
+				return fmt.Errorf("iscsi: failed to update node session key %q error: %v", k, string(out))
 			}
 		}
 	}
@@ -136,38 +143,10 @@ func waitForPathToExistInternal(devicePath *string, maxRetries int, deviceTransp
 // ISCSIUtil is an empty struct type
 type ISCSIUtil struct{}
 
-func (util *ISCSIUtil) persistISCSI(conf iscsiDisk, mnt string) error {
-	file := path.Join(mnt, conf.VolName+".json")
-	fp, err := os.Create(file)
-	if err != nil {
-		return fmt.Errorf("iscsi: create %s err %s", file, err)
-	}
-	defer fp.Close()
-	encoder := json.NewEncoder(fp)
-	if err = encoder.Encode(conf); err != nil {
-		return fmt.Errorf("iscsi: encode err: %v", err)
-	}
-	return nil
-}
-
-func (util *ISCSIUtil) loadISCSI(conf *iscsiDisk, mnt string) error {
-	// NOTE: The iscsi config json is not deleted after logging out from target portals.
-	file := path.Join(mnt, conf.VolName+".json")
-	fp, err := os.Open(file)
-	if err != nil {
-		return fmt.Errorf("iscsi: open %s err %s", file, err)
-	}
-	defer fp.Close()
-	decoder := json.NewDecoder(fp)
-	if err = decoder.Decode(conf); err != nil {
-		return fmt.Errorf("iscsi: decode err: %v", err)
-	}
-	return nil
-}
-
 // AttachDisk logs in to the iSCSI volume and returns the corresponding diskPath
-// of the volume which gets created on the node
-func (util *ISCSIUtil) AttachDisk(b iscsiDiskMounter) (string, error) {
+// of the volume which gets created on the node. Discovery, login and mount are
+// traced as children of the span in the given context.
+func (util *ISCSIUtil) AttachDisk(ctx context.Context, b iscsiDiskMounter) (string, error) {
 	var devicePath string
 	var devicePaths []string
 	var iscsiTransport string
@@ -175,7 +154,7 @@ func (util *ISCSIUtil) AttachDisk(b iscsiDiskMounter) (string, error) {
 
 	out, err := b.exec.Run("iscsiadm", "-m", "iface", "-I", b.Iface, "-o", "show")
 	if err != nil {
-		glog.Errorf("iscsi: could not read iface %s error: %s", b.Iface, string(out))
+		log.Errorf("iscsi: could not read iface %s error: %s", b.Iface, string(out))
 		return "", err
 	}
 
@@ -189,42 +168,46 @@ func (util *ISCSIUtil) AttachDisk(b iscsiDiskMounter) (string, error) {
 		newIface := bkpPortal[0] + ":" + b.VolName
 		err = cloneIface(b, newIface)
 		if err != nil {
-			glog.Errorf("iscsi: failed to clone iface: %s error: %v", b.Iface, err)
+			log.Errorf("iscsi: failed to clone iface: %s error: %v", b.Iface, err)
 			return "", err
 		}
 		// update iface name
 		b.Iface = newIface
 	}
 
-	for _, tp := range bkpPortal {
+	// NOTE:
+	//  Portals returned by the SendTargets discovery
+	// of the target are appended to bkpPortal so that
+	// the node logs in to every portal of the target
+	for i := 0; i < len(bkpPortal); i++ {
+		tp := bkpPortal[i]
 		// Rescan sessions to discover newly mapped LUNs. Do not specify the interface when rescanning
 		// to avoid establishing additional sessions to the same target.
 		out, err := b.exec.Run("iscsiadm", "-m", "node", "-p", tp, "-T", b.Iqn, "-R")
 		if err != nil {
-			glog.Errorf("iscsi: failed to rescan session with error: %s (%v)", string(out), err)
+			log.Errorf("iscsi: failed to rescan session with error: %s (%v)", string(out), err)
 		}
 
 		if iscsiTransport == "" {
-			glog.Errorf("iscsi: could not find transport name in iface %s", b.Iface)
+			log.Errorf("iscsi: could not find transport name in iface %s", b.Iface)
 			return "", fmt.Errorf("Could not parse iface file for %s", b.Iface)
 		}
-		if iscsiTransport == "tcp" {
-			devicePath = strings.Join([]string{"/dev/disk/by-path/ip", tp, "iscsi", b.Iqn, "lun", b.lun}, "-")
-		} else {
-			devicePath = strings.Join([]string{"/dev/disk/by-path/pci", "*", "ip", tp, "iscsi", b.Iqn, "lun", b.lun}, "-")
-		}
+		devicePath = devicePathFor(iscsiTransport, tp, b.Iqn, b.lun)
 
 		if exist := waitForPathToExist(&devicePath, 1, iscsiTransport); exist {
-			glog.V(4).Infof("iscsi: devicepath (%s) exists", devicePath)
+			log.Debugf("iscsi: devicepath (%s) exists", devicePath)
 			devicePaths = append(devicePaths, devicePath)
 			continue
 		}
 		// build discoverydb and discover iscsi target
+		_, span := trace.Start(ctx, "iscsi.discovery")
+		span.SetAttributes(attribute.String("iscsi.portal", tp))
 		b.exec.Run("iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", tp, "-I", b.Iface, "-o", "new")
 		// update discoverydb with CHAP secret
 		err = updateISCSIDiscoverydb(b, tp)
 		if err != nil {
 			lastErr = fmt.Errorf("iscsi: failed to update discoverydb to portal %s error: %v", tp, err)
+			trace.End(span, lastErr)
 			continue
 		}
 		out, err = b.exec.Run("iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", tp, "-I", b.Iface, "--discover")
@@ -232,16 +215,29 @@ func (util *ISCSIUtil) AttachDisk(b iscsiDiskMounter) (string, error) {
 			// delete discoverydb record
 			b.exec.Run("iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", tp, "-I", b.Iface, "-o", "delete")
 			lastErr = fmt.Errorf("iscsi: failed to sendtargets to portal %s output: %s, err %v", tp, string(out), err)
+			trace.End(span, lastErr)
 			continue
 		}
+		trace.End(span, nil)
+		bkpPortal = removeDuplicate(append(bkpPortal, discoveredPortals(string(out), b.Iqn)...))
 		err = updateISCSINode(b, tp)
 		if err != nil {
 			// failure to update node db is rare. But deleting record will likely impact those who already start using it.
 			lastErr = fmt.Errorf("iscsi: failed to update iscsi node to portal %s error: %v", tp, err)
 			continue
 		}
+		err = updateISCSISession(b, tp)
+		if err != nil {
+			lastErr = fmt.Errorf("iscsi: failed to tune iscsi session to portal %s error: %v", tp, err)
+			continue
+		}
 		// login to iscsi target
+		_, span = trace.Start(ctx, "iscsi.login")
+		span.SetAttributes(attribute.String("iscsi.portal", tp))
+		start := time.Now()
 		out, err = b.exec.Run("iscsiadm", "-m", "node", "-p", tp, "-T", b.Iqn, "-I", b.Iface, "--login")
+		metrics.ObserveISCSIOperation(metrics.OperationLogin, time.Since(start), err)
+		trace.End(span, err)
 		if err != nil {
 			// delete the node record from database
 			b.exec.Run("iscsiadm", "-m", "node", "-p", tp, "-I", b.Iface, "-T", b.Iqn, "-o", "delete")
@@ -249,7 +245,7 @@ func (util *ISCSIUtil) AttachDisk(b iscsiDiskMounter) (string, error) {
 			continue
 		}
 		if exist := waitForPathToExist(&devicePath, 10, iscsiTransport); !exist {
-			glog.Errorf("Could not attach disk: Timeout after 10s")
+			log.Errorf("Could not attach disk: Timeout after 10s")
 			// update last error
 			lastErr = fmt.Errorf("Could not attach disk: Timeout after 10s")
 			continue
@@ -261,11 +257,11 @@ func (util *ISCSIUtil) AttachDisk(b iscsiDiskMounter) (string, error) {
 	if len(devicePaths) == 0 {
 		// delete cloned iface
 		b.exec.Run("iscsiadm", "-m", "iface", "-I", b.Iface, "-o", "delete")
-		glog.Errorf("iscsi: failed to get any path for iscsi disk, last err seen:\n%v", lastErr)
+		log.Errorf("iscsi: failed to get any path for iscsi disk, last err seen:\n%v", lastErr)
 		return "", fmt.Errorf("failed to get any path for iscsi disk, last err seen:\n%v", lastErr)
 	}
 	if lastErr != nil {
-		glog.Errorf("iscsi: last error occurred during iscsi init:\n%v", lastErr)
+		log.Errorf("iscsi: last error occurred during iscsi init:\n%v", lastErr)
 	}
 
 	// Make sure we use a valid devicepath to find mpio device.
@@ -278,32 +274,25 @@ func (util *ISCSIUtil) AttachDisk(b iscsiDiskMounter) (string, error) {
 		return "", fmt.Errorf("Heuristic determination of mount point failed:%v", err)
 	}
 	if !notMnt {
-		glog.Infof("iscsi: %s already mounted", mntPath)
+		log.Infof("iscsi: %s already mounted", mntPath)
 		return "", nil
 	}
 
 	if err := os.MkdirAll(mntPath, 0750); err != nil {
-		glog.Errorf("iscsi: failed to mkdir %s, error", mntPath)
+		log.Errorf("iscsi: failed to mkdir %s, error", mntPath)
 		return "", err
 	}
 
 	// Persist iscsi disk config to json file for DetachDisk path
-	if err := util.persistISCSI(*(b.iscsiDisk), b.targetPath); err != nil {
-		glog.Errorf("iscsi: failed to save iscsi config with error: %v", err)
+	b.Portals = bkpPortal
+	if err := util.persistISCSI(*(b.iscsiDisk)); err != nil {
+		log.Errorf("iscsi: failed to save iscsi config with error: %v", err)
 		return "", err
 	}
 
-	for _, path := range devicePaths {
-		// There shouldnt be any empty device paths. However adding this check
-		// for safer side to avoid the possibility of an empty entry.
-		if path == "" {
-			continue
-		}
-		// check if the dev is using mpio and if so mount it via the dm-XX device
-		if mappedDevicePath := b.deviceUtil.FindMultipathDeviceForDevice(path); mappedDevicePath != "" {
-			devicePath = mappedDevicePath
-			break
-		}
+	// check if the dev is using mpio and if so mount it via the dm-XX device
+	if mappedDevicePath := findMultipathDevice(b, devicePaths); mappedDevicePath != "" {
+		devicePath = mappedDevicePath
 	}
 
 	var options []string
@@ -315,9 +304,18 @@ func (util *ISCSIUtil) AttachDisk(b iscsiDiskMounter) (string, error) {
 	}
 	options = append(options, b.mountOptions...)
 
+	// filesystem is created on the device if it has
+	// none, this is usually the slowest step of the
+	// first publish
+	_, span := trace.Start(ctx, "FormatAndMount")
+	span.SetAttributes(
+		attribute.String("device", devicePath),
+		attribute.String("fs.type", b.fsType),
+	)
 	err = b.mounter.FormatAndMount(devicePath, mntPath, b.fsType, options)
+	trace.End(span, err)
 	if err != nil {
-		glog.Errorf("iscsi: failed to mount iscsi volume %s [%s] to %s, error %v", devicePath, b.fsType, mntPath, err)
+		log.Errorf("iscsi: failed to mount iscsi volume %s [%s] to %s, error %v", devicePath, b.fsType, mntPath, err)
 	}
 
 	return devicePath, err
@@ -325,26 +323,34 @@ func (util *ISCSIUtil) AttachDisk(b iscsiDiskMounter) (string, error) {
 
 // DetachDisk logs out of the iSCSI volume and the corresponding path is removed
 func (util *ISCSIUtil) DetachDisk(c iscsiDiskUnmounter, targetPath string) error {
-	_, cnt, err := mount.GetDeviceNameFromMount(c.mounter, targetPath)
+	device, cnt, err := mount.GetDeviceNameFromMount(c.mounter, targetPath)
 	if err != nil {
-		glog.Errorf("iscsi detach disk: failed to get device from mnt: %s\nError: %v", targetPath, err)
+		log.Errorf("iscsi detach disk: failed to get device from mnt: %s\nError: %v", targetPath, err)
 		return err
 	}
 
 	if pathExists, pathErr := mount.PathExists(targetPath); pathErr != nil {
 		return fmt.Errorf("Error checking if path exists: %v", pathErr)
-	} else if !pathExists {
-		glog.Warningf("Warning: Unmount skipped because path does not exist: %v", targetPath)
-		return nil
-	}
-
-	if err = c.mounter.Unmount(targetPath); err != nil {
-		glog.Errorf("iscsi detach disk: failed to unmount: %s\nError: %v", targetPath, err)
-		return err
-	}
-	cnt--
-	if cnt != 0 {
+	} else if pathExists {
+		if err = c.mounter.Unmount(targetPath); err != nil {
+			log.Errorf("iscsi detach disk: failed to unmount: %s\nError: %v", targetPath, err)
+			return err
+		}
+		cnt--
+		if cnt != 0 {
+			return nil
+		}
+		// multipath device is flushed before its
+		// paths are logged out
+		flushMultipathDevice(c.exec, device)
+	} else if !HasRecord(c.iscsiDisk.VolName) {
+		log.Warningf("Warning: Unmount skipped because path does not exist: %v", targetPath)
 		return nil
+	} else {
+		// volume can still be logged in e.g. when the path
+		// got removed while the driver was down
+		log.Warningf("iscsi: path %s does not exist, logging out of volume %s as per its record",
+			targetPath, c.iscsiDisk.VolName)
 	}
 
 	var bkpPortal []string
@@ -356,7 +362,7 @@ func (util *ISCSIUtil) DetachDisk(c iscsiDiskUnmounter, targetPath string) error
 		bkpPortal, iqn, iface, volName = c.iscsiDisk.Portals, c.iscsiDisk.Iqn, c.iscsiDisk.Iface, c.iscsiDisk.VolName
 		initiatorName = c.iscsiDisk.InitiatorName
 	} else {
-		glog.Errorf("iscsi detach disk: failed to get iscsi config from path %s Error: %v", targetPath, err)
+		log.Errorf("iscsi detach disk: failed to get iscsi config from path %s Error: %v", targetPath, err)
 		return err
 	}
 	portals := removeDuplicate(bkpPortal)
@@ -371,16 +377,18 @@ func (util *ISCSIUtil) DetachDisk(c iscsiDiskUnmounter, targetPath string) error
 			logoutArgs = append(logoutArgs, []string{"-I", iface}...)
 			deleteArgs = append(deleteArgs, []string{"-I", iface}...)
 		}
-		glog.Infof("iscsi: log out target %s iqn %s iface %s", portal, iqn, iface)
+		log.Infof("iscsi: log out target %s iqn %s iface %s", portal, iqn, iface)
+		start := time.Now()
 		out, err := c.exec.Run("iscsiadm", logoutArgs...)
+		metrics.ObserveISCSIOperation(metrics.OperationLogout, time.Since(start), err)
 		if err != nil {
-			glog.Errorf("iscsi: failed to detach disk Error: %s", string(out))
+			log.Errorf("iscsi: failed to detach disk Error: %s", string(out))
 		}
 		// Delete the node record
-		glog.Infof("iscsi: delete node record target %s iqn %s", portal, iqn)
+		log.Infof("iscsi: delete node record target %s iqn %s", portal, iqn)
 		out, err = c.exec.Run("iscsiadm", deleteArgs...)
 		if err != nil {
-			glog.Errorf("iscsi: failed to delete node record Error: %s", string(out))
+			log.Errorf("iscsi: failed to delete node record Error: %s", string(out))
 		}
 	}
 	// Delete the iface after all sessions have logged out
@@ -389,18 +397,67 @@ func (util *ISCSIUtil) DetachDisk(c iscsiDiskUnmounter, targetPath string) error
 		deleteArgs := []string{"-m", "iface", "-I", iface, "-o", "delete"}
 		out, err := c.exec.Run("iscsiadm", deleteArgs...)
 		if err != nil {
-			glog.Errorf("iscsi: failed to delete iface Error: %s", string(out))
+			log.Errorf("iscsi: failed to delete iface Error: %s", string(out))
 		}
 	}
 
+	if err := util.removeRecord(volName); err != nil {
+		log.Errorf("iscsi: failed to remove record Error: %v", err)
+	}
+
 	if err := os.RemoveAll(targetPath); err != nil {
-		glog.Errorf("iscsi: failed to remove mount path Error: %v", err)
+		log.Errorf("iscsi: failed to remove mount path Error: %v", err)
 		return err
 	}
 
 	return nil
 }
 
+// findMultipathDevice returns the dm-multipath device
+// assembled from the provided device paths. Multipath
+// takes a while to assemble the device after login
+// hence it is waited upon if the volume has more than
+// one path.
+func findMultipathDevice(b iscsiDiskMounter, devicePaths []string) string {
+	retries := 1
+	if len(devicePaths) > 1 {
+		retries = multipathWaitRetries
+	}
+
+	for i := 0; i < retries; i++ {
+		for _, path := range devicePaths {
+			// There shouldnt be any empty device paths. However adding this check
+			// for safer side to avoid the possibility of an empty entry.
+			if path == "" {
+				continue
+			}
+			if mappedDevicePath := b.deviceUtil.FindMultipathDeviceForDevice(path); mappedDevicePath != "" {
+				return mappedDevicePath
+			}
+		}
+		if i < retries-1 {
+			time.Sleep(time.Second)
+		}
+	}
+
+	if len(devicePaths) > 1 {
+		log.Warningf("iscsi: no multipath device found for %v, is multipathd running?", devicePaths)
+	}
+	return ""
+}
+
+// flushMultipathDevice flushes the unused multipath
+// device so that its paths can be logged out
+func flushMultipathDevice(exec mount.Exec, device string) {
+	if !strings.HasPrefix(device, "/dev/dm-") {
+		return
+	}
+	out, err := exec.Run("multipath", "-f", device)
+	if err != nil {
+		log.Errorf("iscsi: failed to flush multipath device %s Error: %s", device, string(out))
+	}
+}
+
 func extractTransportname(ifaceOutput string) (iscsiTransport string) {
 	rexOutput := ifaceTransportNameRe.FindStringSubmatch(ifaceOutput)
 	if rexOutput == nil {
@@ -1,10 +1,14 @@
 package iscsi
 
 import (
+	"fmt"
+
 	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"k8s.io/kubernetes/pkg/util/mount"
+	"k8s.io/kubernetes/pkg/util/resizefs"
 )
 
 // UnmountAndDetachDisk unmounts the disk from the specified path
@@ -12,7 +16,7 @@ import (
 func UnmountAndDetachDisk(vol *apis.CSIVolume, path string) error {
 	iscsiInfo := &iscsiDisk{
 		VolName: vol.Spec.Volume.Name,
-		Portals: []string{vol.Spec.ISCSI.TargetPortal},
+		Portals: targetPortals(vol),
 		Iqn:     vol.Spec.ISCSI.Iqn,
 		lun:     vol.Spec.ISCSI.Lun,
 	}
@@ -32,7 +36,7 @@ func UnmountAndDetachDisk(vol *apis.CSIVolume, path string) error {
 
 // AttachAndMountDisk logs in to the iSCSI Volume
 // and mounts the disk to the specified path
-func AttachAndMountDisk(vol *apis.CSIVolume) (string, error) {
+func AttachAndMountDisk(ctx context.Context, vol *apis.CSIVolume) (string, error) {
 	if len(vol.Spec.Volume.MountPath) == 0 {
 		return "", status.Error(codes.InvalidArgument, "Target path missing in request")
 	}
@@ -43,9 +47,63 @@ func AttachAndMountDisk(vol *apis.CSIVolume) (string, error) {
 	diskMounter := getISCSIDiskMounter(iscsiInfo, vol)
 
 	util := &ISCSIUtil{}
-	devicePath, err := util.AttachDisk(*diskMounter)
+	devicePath, err := util.AttachDisk(ctx, *diskMounter)
 	if err != nil {
 		return "", status.Error(codes.Internal, err.Error())
 	}
 	return devicePath, err
 }
+
+// ResizeDisk rescans every iSCSI session of the volume
+// so that the node sees the new size of the LUN via
+// each of its paths, resizes the multipath map built
+// over these paths, if any, and then expands the
+// filesystem mounted at the specified path
+func ResizeDisk(vol *apis.CSIVolume, path string) error {
+	exec := mount.NewOsExec()
+	mounter := &mount.SafeFormatAndMount{Interface: mount.New(""), Exec: exec}
+
+	devicePath, _, err := mount.GetDeviceNameFromMount(mounter, path)
+	if err != nil {
+		return err
+	}
+	if devicePath == "" {
+		return fmt.Errorf("iscsi: volume %s is not mounted at %s",
+			vol.Spec.Volume.Name, path)
+	}
+
+	paths, err := PathStates(vol)
+	if err != nil {
+		return err
+	}
+	rescanned := 0
+	for _, path := range paths {
+		// portal without a session has nothing to
+		// rescan, it sees the new size on login
+		if !path.Active {
+			continue
+		}
+		out, err := exec.Run("iscsiadm", "-m", "node", "-p", path.Portal, "-T", vol.Spec.ISCSI.Iqn, "-R")
+		if err != nil {
+			return fmt.Errorf("iscsi: failed to rescan session via %s: %s (%v)", path.Portal, string(out), err)
+		}
+		rescanned++
+	}
+	if rescanned == 0 {
+		return fmt.Errorf("iscsi: volume %s has no session to rescan", vol.Spec.Volume.Name)
+	}
+
+	// multipath map keeps its old size till it is
+	// resized even if all of its paths are rescanned
+	if name := multipathMap(devicePath); name != "" {
+		out, err := exec.Run("multipathd", "resize", "map", name)
+		if err != nil {
+			return fmt.Errorf("iscsi: failed to resize multipath map %s: %s (%v)", name, string(out), err)
+		}
+	}
+
+	if _, err := resizefs.NewResizeFs(mounter).Resize(devicePath, path); err != nil {
+		return fmt.Errorf("iscsi: failed to resize filesystem on %s: %v", devicePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"net"
+	"strings"
+)
+
+// defaultPort is the port of an iSCSI portal
+// if the portal does not specify one
+const defaultPort = "3260"
+
+// NormalizePortal returns the provided portal in
+// host:port format which is understood by iscsiadm,
+// udev & net.Dial. IPv6 addresses are enclosed in
+// brackets e.g. [fd00::10]:3260
+//
+// NOTE:
+//  An IPv6 literal without brackets is assumed to
+// not have a port since the port can not be told
+// apart from the address
+func NormalizePortal(portal string) string {
+	portal = strings.TrimSpace(portal)
+	if portal == "" {
+		return ""
+	}
+
+	if host, port, err := net.SplitHostPort(portal); err == nil {
+		return net.JoinHostPort(host, port)
+	}
+
+	host := strings.TrimSuffix(strings.TrimPrefix(portal, "["), "]")
+	return net.JoinHostPort(host, defaultPort)
+}
+
+// devicePathFor returns the path of the disk that
+// gets created on login to the LUN of the target
+// via the provided portal. Path is a glob pattern
+// for transports other than tcp since the PCI id
+// of the device is not known.
+func devicePathFor(transport, portal, iqn, lun string) string {
+	if transport == "tcp" {
+		return strings.Join([]string{"/dev/disk/by-path/ip", portal, "iscsi", iqn, "lun", lun}, "-")
+	}
+	return strings.Join([]string{"/dev/disk/by-path/pci", "*", "ip", portal, "iscsi", iqn, "lun", lun}, "-")
+}
+
+// discoveredPortals returns the portals of the target
+// with the provided IQN as listed in the output of a
+// SendTargets discovery i.e. lines of the form
+// <portal>,<tpgt> <iqn>
+func discoveredPortals(out, iqn string) []string {
+	var portals []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[1] != iqn {
+			continue
+		}
+		portal := fields[0]
+		if i := strings.LastIndex(portal, ","); i != -1 {
+			portal = portal[:i]
+		}
+		if portal = NormalizePortal(portal); portal != "" {
+			portals = append(portals, portal)
+		}
+	}
+	return portals
+}
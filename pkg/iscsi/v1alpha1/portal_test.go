@@ -0,0 +1,118 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizePortal(t *testing.T) {
+	tests := map[string]struct {
+		portal   string
+		expected string
+	}{
+		"empty portal":                {portal: "", expected: ""},
+		"ipv4 without port":           {portal: "10.0.0.1", expected: "10.0.0.1:3260"},
+		"ipv4 with port":              {portal: "10.0.0.1:3261", expected: "10.0.0.1:3261"},
+		"hostname without port":       {portal: "target.openebs.svc", expected: "target.openebs.svc:3260"},
+		"ipv6 without brackets":       {portal: "fd00::10", expected: "[fd00::10]:3260"},
+		"ipv6 with brackets":          {portal: "[fd00::10]", expected: "[fd00::10]:3260"},
+		"ipv6 with brackets and port": {portal: "[fd00::10]:3261", expected: "[fd00::10]:3261"},
+		"ipv4 mapped ipv6":            {portal: "::ffff:10.0.0.1", expected: "[::ffff:10.0.0.1]:3260"},
+		"surrounding spaces":          {portal: " 10.0.0.1 ", expected: "10.0.0.1:3260"},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			if got := NormalizePortal(mock.portal); got != mock.expected {
+				t.Fatalf("expected portal {%s} got {%s}", mock.expected, got)
+			}
+		})
+	}
+}
+
+func TestDevicePathFor(t *testing.T) {
+	iqn := "iqn.2016-09.com.openebs.cstor:pvc-1"
+	tests := map[string]struct {
+		transport string
+		portal    string
+		expected  string
+	}{
+		"ipv4 over tcp": {
+			transport: "tcp",
+			portal:    "10.0.0.1",
+			expected:  "/dev/disk/by-path/ip-10.0.0.1:3260-iscsi-" + iqn + "-lun-0",
+		},
+		"ipv6 over tcp": {
+			transport: "tcp",
+			portal:    "fd00::10",
+			expected:  "/dev/disk/by-path/ip-[fd00::10]:3260-iscsi-" + iqn + "-lun-0",
+		},
+		"ipv6 with port over tcp": {
+			transport: "tcp",
+			portal:    "[fd00::10]:3261",
+			expected:  "/dev/disk/by-path/ip-[fd00::10]:3261-iscsi-" + iqn + "-lun-0",
+		},
+		"ipv6 over other transport": {
+			transport: "bnx2i",
+			portal:    "fd00::10",
+			expected:  "/dev/disk/by-path/pci-*-ip-[fd00::10]:3260-iscsi-" + iqn + "-lun-0",
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			got := devicePathFor(mock.transport, NormalizePortal(mock.portal), iqn, "0")
+			if got != mock.expected {
+				t.Fatalf("expected device path {%s} got {%s}", mock.expected, got)
+			}
+		})
+	}
+}
+
+func TestDiscoveredPortals(t *testing.T) {
+	iqn := "iqn.2016-09.com.openebs.cstor:pvc-1"
+	tests := map[string]struct {
+		out      string
+		expected []string
+	}{
+		"no targets": {},
+		"single portal": {
+			out:      "10.0.0.1:3260,1 " + iqn + "\n",
+			expected: []string{"10.0.0.1:3260"},
+		},
+		"portals of other targets are ignored": {
+			out: "10.0.0.1:3260,1 " + iqn + "\n" +
+				"10.0.0.9:3260,1 iqn.2016-09.com.openebs.cstor:pvc-9\n" +
+				"[fd00::10]:3260,2 " + iqn + "\n",
+			expected: []string{"10.0.0.1:3260", "[fd00::10]:3260"},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			got := discoveredPortals(mock.out, iqn)
+			if !reflect.DeepEqual(got, mock.expected) {
+				t.Fatalf("expected portals {%v} got {%v}", mock.expected, got)
+			}
+		})
+	}
+}
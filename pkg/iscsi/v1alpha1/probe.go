@@ -0,0 +1,55 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+const (
+	// iscsidSocket is the abstract unix socket on
+	// which iscsid accepts requests from iscsiadm
+	iscsidSocket = "@ISCSIADM_ABSTRACT_NAMESPACE"
+
+	// iscsidDialTimeout is the time to wait for
+	// iscsid to accept a connection
+	iscsidDialTimeout = 2 * time.Second
+)
+
+// VerifyISCSIAdm checks if iscsiadm can be
+// executed on this node
+func VerifyISCSIAdm() error {
+	out, err := mount.NewOsExec().Run("iscsiadm", "--version")
+	if err != nil {
+		return fmt.Errorf("iscsiadm is not usable: %s (%v)", string(out), err)
+	}
+	return nil
+}
+
+// VerifyISCSID checks if iscsid is accepting
+// requests on this node
+func VerifyISCSID() error {
+	conn, err := net.DialTimeout("unix", iscsidSocket, iscsidDialTimeout)
+	if err != nil {
+		return fmt.Errorf("iscsid is not responding: %v", err)
+	}
+	return conn.Close()
+}
@@ -0,0 +1,167 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+// RecordDir is the directory on the node where the
+// iSCSI disk config of every attached volume is
+// persisted. This config is used to log out of the
+// volume, even after a restart of the driver.
+//
+// NOTE:
+//  Older versions persisted this config inside the
+// target path of the volume i.e. under the mount
+var RecordDir = "/var/lib/openebs/csi/iscsi"
+
+// recordPath returns the path of the record of
+// the provided volume
+func recordPath(volName string) string {
+	return filepath.Join(RecordDir, volName+".json")
+}
+
+// legacyRecordPath returns the path of the record
+// of the provided volume as persisted by older
+// versions
+func legacyRecordPath(mnt, volName string) string {
+	return filepath.Join(mnt, volName+".json")
+}
+
+// HasRecord returns true if the record of the
+// provided volume exists i.e. the volume was logged
+// in to by this driver & is yet to be logged out
+func HasRecord(volName string) bool {
+	_, err := os.Stat(recordPath(volName))
+	return err == nil
+}
+
+// persistISCSI saves the disk config of the volume
+// in its record. The record is replaced atomically
+// so that a crash never leaves a partial record.
+func (util *ISCSIUtil) persistISCSI(conf iscsiDisk) error {
+	if err := os.MkdirAll(RecordDir, 0700); err != nil {
+		return fmt.Errorf("iscsi: create %s err %s", RecordDir, err)
+	}
+
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return fmt.Errorf("iscsi: encode err: %v", err)
+	}
+
+	file := recordPath(conf.VolName)
+	tmp := file + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("iscsi: create %s err %s", tmp, err)
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("iscsi: rename %s err %s", tmp, err)
+	}
+	return nil
+}
+
+// loadISCSI loads the disk config of the volume from
+// its record. Record persisted by older versions inside
+// the provided mount path is used if there is none in
+// the record dir.
+func (util *ISCSIUtil) loadISCSI(conf *iscsiDisk, mnt string) error {
+	file := recordPath(conf.VolName)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) && mnt != "" {
+		file = legacyRecordPath(mnt, conf.VolName)
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return fmt.Errorf("iscsi: open %s err %s", file, err)
+	}
+	if err = json.Unmarshal(data, conf); err != nil {
+		return fmt.Errorf("iscsi: decode err: %v", err)
+	}
+	return nil
+}
+
+// removeRecord deletes the record & the persisted
+// CHAP secrets of the volume once it has been
+// logged out
+func (util *ISCSIUtil) removeRecord(volName string) error {
+	err := os.Remove(recordPath(volName))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("iscsi: remove record of %s err %s", volName, err)
+	}
+	return removeCredentials(volName)
+}
+
+// MigrateRecords creates the records of the provided
+// volumes which were attached by older versions.
+//
+// NOTE:
+//  The config persisted by older versions is hidden
+// under the mount of the volume. Hence it is used only
+// if the volume is not mounted, else the record is
+// built from the CSIVolume the same way it was built
+// during attach. Nothing inside a mounted volume is
+// read or removed since it belongs to the user.
+func MigrateRecords(mounter mount.Interface, vols []*apis.CSIVolume) error {
+	util := &ISCSIUtil{}
+	for _, vol := range vols {
+		volName := vol.Spec.Volume.Name
+		if HasRecord(volName) {
+			continue
+		}
+
+		conf, err := getISCSIInfo(vol)
+		if err != nil {
+			return err
+		}
+
+		legacy := ""
+		if mnt := vol.Spec.Volume.MountPath; mnt != "" {
+			notMnt, err := mounter.IsLikelyNotMountPoint(mnt)
+			switch {
+			case err == nil && notMnt:
+				if util.loadISCSI(conf, mnt) == nil {
+					legacy = legacyRecordPath(mnt, volName)
+				}
+			case err == nil:
+				log.Infof("iscsi: volume %s is mounted at %s: building its record from the csivolume",
+					volName, mnt)
+			case !os.IsNotExist(err):
+				log.Warningf("iscsi: failed to check mount of volume %s at %s: %v", volName, mnt, err)
+			}
+		}
+
+		if err := util.persistISCSI(*conf); err != nil {
+			return err
+		}
+		if legacy != "" {
+			if err := os.Remove(legacy); err != nil && !os.IsNotExist(err) {
+				log.Warningf("iscsi: failed to remove old record %s: %v", legacy, err)
+			}
+		}
+		log.Infof("iscsi: migrated record of volume %s to %s", volName, RecordDir)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+func fakeVolume(name, mountPath string) *apis.CSIVolume {
+	vol := &apis.CSIVolume{}
+	vol.Spec.Volume.Name = name
+	vol.Spec.Volume.MountPath = mountPath
+	vol.Spec.ISCSI.TargetPortal = "10.0.0.1:3260"
+	vol.Spec.ISCSI.Iqn = "iqn.2016-09.com.openebs.cstor:" + name
+	vol.Spec.ISCSI.IscsiInterface = "default"
+	return vol
+}
+
+func TestMigrateRecords(t *testing.T) {
+	tests := map[string]struct {
+		hasLegacy     bool
+		isMounted     bool
+		legacyIface   string
+		expectedIface string
+		isLegacyKept  bool
+	}{
+		"record is built from the volume": {
+			expectedIface: "default",
+		},
+		"legacy record is moved": {
+			hasLegacy:     true,
+			legacyIface:   "10.0.0.1:3260:pvc-1",
+			expectedIface: "10.0.0.1:3260:pvc-1",
+		},
+		"file of a mounted volume is left alone": {
+			hasLegacy:     true,
+			isMounted:     true,
+			legacyIface:   "10.0.0.1:3260:pvc-1",
+			expectedIface: "default",
+			isLegacyKept:  true,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "csi-iscsi-record")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			RecordDir = filepath.Join(dir, "state")
+			mnt := filepath.Join(dir, "mnt")
+			if err = os.MkdirAll(mnt, 0750); err != nil {
+				t.Fatalf("failed to create mount path: %v", err)
+			}
+
+			vol := fakeVolume("pvc-1", mnt)
+			legacy := legacyRecordPath(mnt, "pvc-1")
+			if mock.hasLegacy {
+				conf, _ := getISCSIInfo(vol)
+				conf.Iface = mock.legacyIface
+				data, _ := json.Marshal(conf)
+				if err = ioutil.WriteFile(legacy, data, 0600); err != nil {
+					t.Fatalf("failed to write legacy record: %v", err)
+				}
+			}
+
+			mounter := &mount.FakeMounter{}
+			if mock.isMounted {
+				mounter.MountPoints = []mount.MountPoint{{Device: "/dev/sdz", Path: mnt}}
+			}
+			if err = MigrateRecords(mounter, []*apis.CSIVolume{vol}); err != nil {
+				t.Fatalf("expected no error got: %v", err)
+			}
+
+			conf := &iscsiDisk{VolName: "pvc-1"}
+			if err = (&ISCSIUtil{}).loadISCSI(conf, ""); err != nil {
+				t.Fatalf("expected record to be migrated got: %v", err)
+			}
+			if conf.Iface != mock.expectedIface {
+				t.Fatalf("expected iface {%s} got {%s}", mock.expectedIface, conf.Iface)
+			}
+			if conf.Iqn != vol.Spec.ISCSI.Iqn {
+				t.Fatalf("expected iqn {%s} got {%s}", vol.Spec.ISCSI.Iqn, conf.Iqn)
+			}
+			if _, err = os.Stat(legacy); mock.isLegacyKept != (err == nil) {
+				t.Fatalf("expected legacy record kept {%t} got: %v", mock.isLegacyKept, err)
+			}
+		})
+	}
+}
+
+func TestRecordLifecycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csi-iscsi-record")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	RecordDir = dir
+
+	util := &ISCSIUtil{}
+	conf, _ := getISCSIInfo(fakeVolume("pvc-1", ""))
+	if err = util.persistISCSI(*conf); err != nil {
+		t.Fatalf("failed to persist record: %v", err)
+	}
+	if !HasRecord("pvc-1") {
+		t.Fatalf("expected record of pvc-1 to exist")
+	}
+
+	if err = util.removeRecord("pvc-1"); err != nil {
+		t.Fatalf("failed to remove record: %v", err)
+	}
+	if HasRecord("pvc-1") {
+		t.Fatalf("expected record of pvc-1 to be removed")
+	}
+	if err = util.removeRecord("pvc-1"); err != nil {
+		t.Fatalf("expected removal of missing record to succeed got: %v", err)
+	}
+}
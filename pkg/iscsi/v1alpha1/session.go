@@ -0,0 +1,289 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	metrics "github.com/openebs/csi/pkg/metrics/v1alpha1"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+// noActiveSessions is reported by iscsiadm when this
+// node has not logged in to any target
+const noActiveSessions = "No active sessions"
+
+// SysfsRoot is the path where sysfs is mounted
+var SysfsRoot = "/sys"
+
+// Session represents an active iSCSI session
+// of this node
+type Session struct {
+	// Transport used by the session e.g. tcp
+	Transport string
+
+	// ID of the session as reported by iscsiadm
+	ID string
+
+	// Portal of the target in ip:port format
+	Portal string
+
+	// Iqn of the target
+	Iqn string
+}
+
+// ListSessions returns the active iSCSI sessions
+// of this node
+func ListSessions() ([]Session, error) {
+	out, err := mount.NewOsExec().Run("iscsiadm", "-m", "session")
+	if err != nil {
+		if strings.Contains(string(out), noActiveSessions) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("iscsi: failed to list sessions: %s (%v)", string(out), err)
+	}
+	return parseSessions(string(out)), nil
+}
+
+// parseSessions parses the output of iscsiadm -m session
+// which is of below format:
+//
+// tcp: [1] 10.0.0.1:3260,1 iqn.2016-09.com.openebs.cstor:pvc-1 (non-flash)
+func parseSessions(out string) []Session {
+	var sessions []Session
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+
+		portal := fields[2]
+		// remove the target portal group tag
+		if i := strings.LastIndex(portal, ","); i != -1 {
+			portal = portal[:i]
+		}
+		sessions = append(sessions, Session{
+			Transport: strings.TrimSuffix(fields[0], ":"),
+			ID:        strings.Trim(fields[1], "[]"),
+			Portal:    portal,
+			Iqn:       fields[3],
+		})
+	}
+	return sessions
+}
+
+// HasSession returns true if this node has an active
+// iSCSI session to the provided volume
+func HasSession(vol *apis.CSIVolume) (bool, error) {
+	sessions, err := ListSessions()
+	if err != nil {
+		return false, err
+	}
+
+	for _, session := range sessions {
+		if session.Iqn == vol.Spec.ISCSI.Iqn {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListSysfsSessions returns the iSCSI sessions of this
+// node as found in sysfs. Unlike ListSessions this
+// does not depend on iscsiadm and its node records.
+func ListSysfsSessions() ([]Session, error) {
+	dirs, err := filepath.Glob(filepath.Join(SysfsRoot, "class", "iscsi_session", "session*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+	for _, dir := range dirs {
+		id := strings.TrimPrefix(filepath.Base(dir), "session")
+		iqn, err := readSysfs(filepath.Join(dir, "targetname"))
+		if err != nil {
+			return nil, err
+		}
+
+		// connection of a session N is named connectionN:M
+		conns, _ := filepath.Glob(filepath.Join(
+			SysfsRoot, "class", "iscsi_connection", "connection"+id+":*"))
+		var portal string
+		if len(conns) > 0 {
+			address, _ := readSysfs(filepath.Join(conns[0], "persistent_address"))
+			port, _ := readSysfs(filepath.Join(conns[0], "persistent_port"))
+			if address != "" && port != "" {
+				portal = net.JoinHostPort(address, port)
+			}
+		}
+
+		sessions = append(sessions, Session{
+			ID:     id,
+			Portal: portal,
+			Iqn:    iqn,
+		})
+	}
+	return sessions, nil
+}
+
+// SessionDevices returns the paths of the disks of
+// the LUNs of the provided session as found in sysfs
+// e.g. /dev/sdb
+func SessionDevices(session Session) ([]string, error) {
+	blocks, err := filepath.Glob(filepath.Join(SysfsRoot, "class", "iscsi_session",
+		"session"+session.ID, "device", "target*", "*", "block", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		devices = append(devices, filepath.Join("/dev", filepath.Base(block)))
+	}
+	return devices, nil
+}
+
+// DeviceHolders returns the devices which are stacked
+// on top of the provided disk e.g. the multipath map
+// or the device mapper target built over it. Each
+// device mapper holder is returned both as /dev/dm-N
+// & as /dev/mapper/<name> since it can be mounted by
+// either path.
+func DeviceHolders(device string) ([]string, error) {
+	var holders []string
+	seen := map[string]bool{}
+
+	var walk func(name string) error
+	walk = func(name string) error {
+		dirs, err := filepath.Glob(filepath.Join(SysfsRoot, "class", "block", name, "holders", "*"))
+		if err != nil {
+			return err
+		}
+		for _, dir := range dirs {
+			holder := filepath.Base(dir)
+			if seen[holder] {
+				continue
+			}
+			seen[holder] = true
+
+			holders = append(holders, filepath.Join("/dev", holder))
+			dmName, err := readSysfs(filepath.Join(SysfsRoot, "class", "block", holder, "dm", "name"))
+			if err == nil && dmName != "" {
+				holders = append(holders, filepath.Join("/dev", "mapper", dmName))
+			}
+			if err = walk(holder); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(filepath.Base(device)); err != nil {
+		return nil, err
+	}
+	return holders, nil
+}
+
+// multipathMap returns the name of the multipath map
+// if the provided device is one e.g. /dev/dm-0 or
+// /dev/mapper/mpatha. Empty string is returned for
+// any other device including the device mapper
+// targets which are not multipath maps.
+func multipathMap(device string) string {
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+
+	dm := filepath.Join(SysfsRoot, "class", "block", filepath.Base(device), "dm")
+	uuid, err := readSysfs(filepath.Join(dm, "uuid"))
+	if err != nil || !strings.HasPrefix(uuid, "mpath-") {
+		return ""
+	}
+	name, err := readSysfs(filepath.Join(dm, "name"))
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// readSysfs returns the trimmed content of the
+// provided sysfs attribute
+func readSysfs(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("iscsi: failed to read %s: %v", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// LogoutSession logs out of the provided session and
+// deletes the node record & the persisted config of
+// the volume served over it
+func LogoutSession(session Session, volName string) error {
+	exec := mount.NewOsExec()
+
+	args := []string{"-m", "node", "-T", session.Iqn}
+	if session.Portal != "" {
+		args = append(args, "-p", session.Portal)
+	}
+
+	start := time.Now()
+	out, err := exec.Run("iscsiadm", append(args, "--logout")...)
+	metrics.ObserveISCSIOperation(metrics.OperationLogout, time.Since(start), err)
+	if err != nil {
+		return fmt.Errorf("iscsi: failed to logout of %s: %s (%v)", session.Iqn, string(out), err)
+	}
+
+	out, err = exec.Run("iscsiadm", append(args, "-o", "delete")...)
+	if err != nil {
+		return fmt.Errorf("iscsi: failed to delete node record of %s: %s (%v)",
+			session.Iqn, string(out), err)
+	}
+	return (&ISCSIUtil{}).removeRecord(volName)
+}
+
+// PathStates returns the state of every iSCSI path
+// of the volume i.e. if the node has a session to
+// each of its target portals
+func PathStates(vol *apis.CSIVolume) ([]apis.CSIVolumePath, error) {
+	sessions, err := ListSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	active := map[string]bool{}
+	for _, session := range sessions {
+		if session.Iqn == vol.Spec.ISCSI.Iqn {
+			active[session.Portal] = true
+		}
+	}
+
+	var paths []apis.CSIVolumePath
+	for _, portal := range targetPortals(vol) {
+		paths = append(paths, apis.CSIVolumePath{
+			Portal: portal,
+			Active: active[portal],
+		})
+	}
+	return paths, nil
+}
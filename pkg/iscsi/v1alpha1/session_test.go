@@ -0,0 +1,295 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseSessions(t *testing.T) {
+	tests := map[string]struct {
+		output   string
+		expected []Session
+	}{
+		"no sessions": {
+			output:   "",
+			expected: nil,
+		},
+		"single session": {
+			output: "tcp: [1] 10.0.0.1:3260,1 iqn.2016-09.com.openebs.cstor:pvc-1 (non-flash)\n",
+			expected: []Session{
+				{Transport: "tcp", ID: "1", Portal: "10.0.0.1:3260", Iqn: "iqn.2016-09.com.openebs.cstor:pvc-1"},
+			},
+		},
+		"multiple sessions with ipv6 portal": {
+			output: "tcp: [1] 10.0.0.1:3260,1 iqn.2016-09.com.openebs.cstor:pvc-1 (non-flash)\n" +
+				"tcp: [2] [fd00::1]:3260,1 iqn.2016-09.com.openebs.cstor:pvc-2 (non-flash)\n",
+			expected: []Session{
+				{Transport: "tcp", ID: "1", Portal: "10.0.0.1:3260", Iqn: "iqn.2016-09.com.openebs.cstor:pvc-1"},
+				{Transport: "tcp", ID: "2", Portal: "[fd00::1]:3260", Iqn: "iqn.2016-09.com.openebs.cstor:pvc-2"},
+			},
+		},
+		"malformed line is skipped": {
+			output:   "iscsiadm: some warning\n",
+			expected: nil,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			got := parseSessions(mock.output)
+			if !reflect.DeepEqual(got, mock.expected) {
+				t.Fatalf("expected sessions {%+v} got {%+v}", mock.expected, got)
+			}
+		})
+	}
+}
+
+func TestListSysfsSessions(t *testing.T) {
+	tests := map[string]struct {
+		sessions map[string][]string
+		expected []Session
+	}{
+		"no sessions": {
+			expected: nil,
+		},
+		"sessions with ipv4 and ipv6 portals": {
+			sessions: map[string][]string{
+				"1": {"iqn.2016-09.com.openebs.cstor:pvc-1", "10.0.0.1", "3260"},
+				"2": {"iqn.2016-09.com.openebs.cstor:pvc-2", "fd00::1", "3260"},
+			},
+			expected: []Session{
+				{ID: "1", Portal: "10.0.0.1:3260", Iqn: "iqn.2016-09.com.openebs.cstor:pvc-1"},
+				{ID: "2", Portal: "[fd00::1]:3260", Iqn: "iqn.2016-09.com.openebs.cstor:pvc-2"},
+			},
+		},
+		"session without connection": {
+			sessions: map[string][]string{
+				"3": {"iqn.2016-09.com.openebs.cstor:pvc-3"},
+			},
+			expected: []Session{
+				{ID: "3", Iqn: "iqn.2016-09.com.openebs.cstor:pvc-3"},
+			},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "csi-sysfs")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(root)
+			SysfsRoot = root
+
+			write := func(path, value string) {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("failed to create %s: %v", path, err)
+				}
+				if err := ioutil.WriteFile(path, []byte(value+"\n"), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", path, err)
+				}
+			}
+			for id, attrs := range mock.sessions {
+				write(filepath.Join(root, "class", "iscsi_session", "session"+id, "targetname"), attrs[0])
+				if len(attrs) < 3 {
+					continue
+				}
+				conn := filepath.Join(root, "class", "iscsi_connection", "connection"+id+":0")
+				write(filepath.Join(conn, "persistent_address"), attrs[1])
+				write(filepath.Join(conn, "persistent_port"), attrs[2])
+			}
+
+			got, err := ListSysfsSessions()
+			if err != nil {
+				t.Fatalf("expected no error got: %v", err)
+			}
+			if !reflect.DeepEqual(got, mock.expected) {
+				t.Fatalf("expected sessions {%+v} got {%+v}", mock.expected, got)
+			}
+		})
+	}
+}
+
+func TestSessionDevices(t *testing.T) {
+	tests := map[string]struct {
+		luns     []string
+		expected []string
+	}{
+		"session without luns": {
+			expected: []string{},
+		},
+		"session with luns": {
+			luns:     []string{"sdb", "sdc"},
+			expected: []string{"/dev/sdb", "/dev/sdc"},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "csi-sysfs")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(root)
+			SysfsRoot = root
+
+			session := filepath.Join(root, "class", "iscsi_session", "session1")
+			if err = os.MkdirAll(session, 0755); err != nil {
+				t.Fatalf("failed to create %s: %v", session, err)
+			}
+			for i, lun := range mock.luns {
+				block := filepath.Join(session, "device", "target2:0:0",
+					"2:0:0:"+strconv.Itoa(i), "block", lun)
+				if err = os.MkdirAll(block, 0755); err != nil {
+					t.Fatalf("failed to create %s: %v", block, err)
+				}
+			}
+
+			got, err := SessionDevices(Session{ID: "1"})
+			if err != nil {
+				t.Fatalf("expected no error got: %v", err)
+			}
+			if !reflect.DeepEqual(got, mock.expected) {
+				t.Fatalf("expected devices {%v} got {%v}", mock.expected, got)
+			}
+		})
+	}
+}
+
+func TestDeviceHolders(t *testing.T) {
+	tests := map[string]struct {
+		// holders of each device
+		holders map[string][]string
+		// names of the device mapper targets
+		dmNames  map[string]string
+		expected []string
+	}{
+		"disk without holders": {},
+		"disk held by a multipath map": {
+			holders:  map[string][]string{"sdb": {"dm-0"}},
+			dmNames:  map[string]string{"dm-0": "mpatha"},
+			expected: []string{"/dev/dm-0", "/dev/mapper/mpatha"},
+		},
+		"stacked device mapper targets": {
+			holders: map[string][]string{"sdb": {"dm-0"}, "dm-0": {"dm-1"}},
+			dmNames: map[string]string{"dm-0": "mpatha", "dm-1": "vg-lv"},
+			expected: []string{
+				"/dev/dm-0", "/dev/mapper/mpatha", "/dev/dm-1", "/dev/mapper/vg-lv",
+			},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "csi-sysfs")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(root)
+			SysfsRoot = root
+
+			block := filepath.Join(root, "class", "block")
+			if err = os.MkdirAll(filepath.Join(block, "sdb"), 0755); err != nil {
+				t.Fatalf("failed to create %s: %v", block, err)
+			}
+			for device, holders := range mock.holders {
+				for _, holder := range holders {
+					dir := filepath.Join(block, device, "holders", holder)
+					if err = os.MkdirAll(dir, 0755); err != nil {
+						t.Fatalf("failed to create %s: %v", dir, err)
+					}
+				}
+			}
+			for device, dmName := range mock.dmNames {
+				dir := filepath.Join(block, device, "dm")
+				if err = os.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("failed to create %s: %v", dir, err)
+				}
+				if err = ioutil.WriteFile(filepath.Join(dir, "name"), []byte(dmName+"\n"), 0644); err != nil {
+					t.Fatalf("failed to write dm name: %v", err)
+				}
+			}
+
+			got, err := DeviceHolders("/dev/sdb")
+			if err != nil {
+				t.Fatalf("Test {%s} failed: expected no error got: %v", name, err)
+			}
+			if !reflect.DeepEqual(got, mock.expected) {
+				t.Fatalf("Test {%s} failed: expected holders {%v} got {%v}", name, mock.expected, got)
+			}
+		})
+	}
+}
+
+func TestMultipathMap(t *testing.T) {
+	tests := map[string]struct {
+		device   string
+		uuid     string
+		expected string
+	}{
+		"disk": {
+			device: "/dev/sdb",
+		},
+		"multipath map": {
+			device:   "/dev/dm-0",
+			uuid:     "mpath-36001405",
+			expected: "mpatha",
+		},
+		"other device mapper target": {
+			device: "/dev/dm-0",
+			uuid:   "LVM-abcd",
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "csi-sysfs")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(root)
+			SysfsRoot = root
+
+			if mock.uuid != "" {
+				dm := filepath.Join(root, "class", "block", "dm-0", "dm")
+				if err = os.MkdirAll(dm, 0755); err != nil {
+					t.Fatalf("failed to create %s: %v", dm, err)
+				}
+				for file, value := range map[string]string{"uuid": mock.uuid, "name": "mpatha"} {
+					if err = ioutil.WriteFile(filepath.Join(dm, file), []byte(value+"\n"), 0644); err != nil {
+						t.Fatalf("failed to write %s: %v", file, err)
+					}
+				}
+			}
+
+			if got := multipathMap(mock.device); got != mock.expected {
+				t.Fatalf("Test {%s} failed: expected map {%s} got {%s}", name, mock.expected, got)
+			}
+		})
+	}
+}
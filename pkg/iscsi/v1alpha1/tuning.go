@@ -0,0 +1,164 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// sessionTunable is an iSCSI session setting which
+// can be tuned per volume
+type sessionTunable struct {
+	// key is the name of the setting in the node
+	// records of iscsiadm
+	key string
+
+	// defaultValue is used if the volume does not
+	// tune this setting
+	defaultValue string
+
+	// validate checks if the given value can be set
+	validate func(value string) error
+}
+
+// sessionTunables are the settings which can be
+// tuned via the StorageClass parameters or the
+// volume context, keyed by the parameter name
+//
+// NOTE:
+//  Defaults suit replicated cStor targets. Target of
+// such a volume can take a while to be rescheduled,
+// IOs are queued till the replacement timeout after
+// which the volume goes read only. Noop-outs detect
+// a failed connection in about 10s.
+var sessionTunables = map[string]sessionTunable{
+	"replacementTimeout": {
+		key:          "node.session.timeo.replacement_timeout",
+		defaultValue: "120",
+		validate:     intInRange(0, 3600),
+	},
+	"noopOutInterval": {
+		key:          "node.conn[0].timeo.noop_out_interval",
+		defaultValue: "5",
+		validate:     intInRange(0, 3600),
+	},
+	"noopOutTimeout": {
+		key:          "node.conn[0].timeo.noop_out_timeout",
+		defaultValue: "5",
+		validate:     intInRange(1, 3600),
+	},
+	"queueDepth": {
+		key:          "node.session.queue_depth",
+		defaultValue: "32",
+		validate:     intInRange(1, 1024),
+	},
+	"startup": {
+		// node plugin logs in to the volumes itself,
+		// hence iscsid need not log in on boot
+		key:          "node.startup",
+		defaultValue: "manual",
+		validate:     oneOf("manual", "automatic"),
+	},
+}
+
+// intInRange returns a validator which accepts the
+// integers in the given range
+func intInRange(min, max int) func(string) error {
+	return func(value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("{%s} is not an integer", value)
+		}
+		if i < min || i > max {
+			return fmt.Errorf("{%d} is not in range [%d, %d]", i, min, max)
+		}
+		return nil
+	}
+}
+
+// oneOf returns a validator which accepts only the
+// given values
+func oneOf(allowed ...string) func(string) error {
+	return func(value string) error {
+		for _, a := range allowed {
+			if value == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("{%s} is not one of %v", value, allowed)
+	}
+}
+
+// SessionParameters returns the session tuning
+// parameters present in the given StorageClass
+// parameters or volume context. An error is
+// returned if any of these is invalid.
+func SessionParameters(params map[string]string) (map[string]string, error) {
+	tuned := map[string]string{}
+	for name, tunable := range sessionTunables {
+		value, ok := params[name]
+		if !ok {
+			continue
+		}
+		if err := tunable.validate(value); err != nil {
+			return nil, fmt.Errorf("invalid iSCSI session parameter {%s}: %v", name, err)
+		}
+		tuned[name] = value
+	}
+	return tuned, nil
+}
+
+// SessionSettings returns the iscsiadm node settings
+// to log in to a volume with the given volume context.
+// Defaults are used for the settings which are not
+// tuned.
+func SessionSettings(volumeContext map[string]string) (map[string]string, error) {
+	tuned, err := SessionParameters(volumeContext)
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]string{}
+	for name, tunable := range sessionTunables {
+		value, ok := tuned[name]
+		if !ok {
+			value = tunable.defaultValue
+		}
+		settings[tunable.key] = value
+	}
+	return settings, nil
+}
+
+// updateISCSISession applies the session settings of
+// the disk to its node record. These take effect on
+// the next login.
+func updateISCSISession(b iscsiDiskMounter, tp string) error {
+	keys := make([]string, 0, len(b.SessionSettings))
+	for k := range b.SessionSettings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		out, err := b.exec.Run("iscsiadm", "-m", "node", "-p", tp, "-T", b.Iqn, "-I", b.Iface, "-o", "update", "-n", k, "-v", b.SessionSettings[k])
+		if err != nil {
+			return fmt.Errorf("iscsi: failed to update node session key %q error: %v", k, string(out))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iscsi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+func TestSessionSettings(t *testing.T) {
+	defaults := map[string]string{
+		"node.session.timeo.replacement_timeout": "120",
+		"node.conn[0].timeo.noop_out_interval":   "5",
+		"node.conn[0].timeo.noop_out_timeout":    "5",
+		"node.session.queue_depth":               "32",
+		"node.startup":                           "manual",
+	}
+	with := func(k, v string) map[string]string {
+		settings := map[string]string{}
+		for dk, dv := range defaults {
+			settings[dk] = dv
+		}
+		settings[k] = v
+		return settings
+	}
+
+	tests := map[string]struct {
+		context  map[string]string
+		expected map[string]string
+		isErr    bool
+	}{
+		"defaults": {
+			context:  map[string]string{"iqn": "iqn.2016-09.com.openebs.cstor:pvc-1"},
+			expected: defaults,
+		},
+		"tuned replacement timeout": {
+			context:  map[string]string{"replacementTimeout": "30"},
+			expected: with("node.session.timeo.replacement_timeout", "30"),
+		},
+		"tuned startup": {
+			context:  map[string]string{"startup": "automatic"},
+			expected: with("node.startup", "automatic"),
+		},
+		"non integer queue depth": {
+			context: map[string]string{"queueDepth": "deep"},
+			isErr:   true,
+		},
+		"queue depth out of range": {
+			context: map[string]string{"queueDepth": "0"},
+			isErr:   true,
+		},
+		"invalid startup": {
+			context: map[string]string{"startup": "onboot"},
+			isErr:   true,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			settings, err := SessionSettings(mock.context)
+			if mock.isErr != (err != nil) {
+				t.Fatalf("Test {%s} failed: expected error {%v} got {%v}", name, mock.isErr, err)
+			}
+			if !mock.isErr && !reflect.DeepEqual(settings, mock.expected) {
+				t.Fatalf("Test {%s} failed: expected {%v} got {%v}", name, mock.expected, settings)
+			}
+		})
+	}
+}
+
+func TestSessionParameters(t *testing.T) {
+	params := map[string]string{
+		"queueDepth": "64",
+		"fsType":     "ext4",
+	}
+	tuned, err := SessionParameters(params)
+	if err != nil {
+		t.Fatalf("failed to get session parameters: %v", err)
+	}
+	expected := map[string]string{"queueDepth": "64"}
+	if !reflect.DeepEqual(tuned, expected) {
+		t.Fatalf("expected {%v} got {%v}", expected, tuned)
+	}
+}
+
+func TestUpdateISCSISession(t *testing.T) {
+	var cmds []string
+	b := iscsiDiskMounter{
+		iscsiDisk: &iscsiDisk{
+			Iqn:   "iqn.2016-09.com.openebs.cstor:pvc-1",
+			Iface: DefaultIface,
+			SessionSettings: map[string]string{
+				"node.startup":             "manual",
+				"node.session.queue_depth": "64",
+			},
+		},
+		exec: mount.NewFakeExec(func(cmd string, args ...string) ([]byte, error) {
+			cmds = append(cmds, strings.Join(args, " "))
+			return nil, nil
+		}),
+	}
+	if err := updateISCSISession(b, "10.0.0.1:3260"); err != nil {
+		t.Fatalf("failed to update session: %v", err)
+	}
+	expected := []string{
+		"-m node -p 10.0.0.1:3260 -T iqn.2016-09.com.openebs.cstor:pvc-1 -I default -o update -n node.session.queue_depth -v 64",
+		"-m node -p 10.0.0.1:3260 -T iqn.2016-09.com.openebs.cstor:pvc-1 -I default -o update -n node.startup -v manual",
+	}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Fatalf("expected commands {%v} got {%v}", expected, cmds)
+	}
+}
@@ -0,0 +1,308 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	"github.com/pkg/errors"
+)
+
+// journalFile is the name of the journal file
+// in the state directory
+const journalFile = "journal"
+
+// Op is a typed string to represent the
+// operations recorded in the journal
+type Op string
+
+const (
+	// OpPublish represents NodePublishVolume
+	OpPublish Op = "publish"
+
+	// OpUnpublish represents NodeUnpublishVolume
+	OpUnpublish Op = "unpublish"
+)
+
+// Step is a typed string to represent the
+// steps of an operation
+type Step string
+
+const (
+	// StepBegin is recorded before the operation
+	// makes any change
+	StepBegin Step = "begin"
+
+	// StepCRCreated is recorded once the CSIVolume
+	// CR of the node has been created
+	StepCRCreated Step = "cr-created"
+
+	// StepMounted is recorded once the node has
+	// logged in to the volume & mounted it
+	StepMounted Step = "mounted"
+
+	// StepUnmounted is recorded once the node has
+	// unmounted & logged out of the volume
+	StepUnmounted Step = "unmounted"
+
+	// StepDone is recorded once the operation
+	// has completed irrespective of its result
+	StepDone Step = "done"
+)
+
+// Record is a single entry of the journal
+type Record struct {
+	// Op that recorded this entry
+	Op Op `json:"op"`
+
+	// Step of the op that has been reached
+	Step Step `json:"step"`
+
+	// VolumeID of the volume being operated upon
+	VolumeID string `json:"volumeID"`
+
+	// Volume holds the details of the volume
+	// required to finish or roll back the op.
+	// This is recorded only at StepBegin.
+	Volume *apis.CSIVolume `json:"volume,omitempty"`
+
+	// Time when this entry was recorded
+	Time time.Time `json:"time"`
+}
+
+// Pending is an operation that did not complete
+// e.g. due to a crash of the driver
+type Pending struct {
+	// Op that did not complete
+	Op Op
+
+	// LastStep is the last step of the op that
+	// was recorded
+	LastStep Step
+
+	// Volume being operated upon
+	Volume *apis.CSIVolume
+}
+
+// Journal records the intent and completion of the
+// steps of node operations in a file so that half
+// done operations can be finished or rolled back
+// after a crash
+//
+// NOTE:
+//  Every record is synced to disk before the step
+// it represents is performed
+type Journal struct {
+	sync.Mutex
+
+	path string
+	file *os.File
+
+	// pending holds the records of the operations
+	// in flight, keyed by volume id
+	pending map[string][]Record
+}
+
+// Open opens the journal present in the provided
+// state directory. The journal is created if it
+// does not exist.
+func Open(stateDir string) (*Journal, error) {
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "failed to create state dir {%s}", stateDir)
+	}
+
+	j := &Journal{
+		path:    filepath.Join(stateDir, journalFile),
+		pending: map[string][]Record{},
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+
+	// rewrite the journal so that it starts with only
+	// the operations that did not complete
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// load replays the journal file to find the
+// operations that did not complete
+func (j *Journal) load() error {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to open journal {%s}", j.path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// a crash while appending leaves a partial
+			// record at the end which is ignored
+			continue
+		}
+		j.apply(r)
+	}
+	return scanner.Err()
+}
+
+// apply updates the in flight operations as
+// per the provided record
+func (j *Journal) apply(r Record) {
+	if r.Step == StepBegin {
+		j.pending[r.VolumeID] = []Record{r}
+		return
+	}
+	if _, ok := j.pending[r.VolumeID]; !ok {
+		return
+	}
+	if r.Step == StepDone {
+		delete(j.pending, r.VolumeID)
+		return
+	}
+	j.pending[r.VolumeID] = append(j.pending[r.VolumeID], r)
+}
+
+// compact rewrites the journal with the records of
+// the in flight operations only. The new journal
+// replaces the old one atomically.
+func (j *Journal) compact() error {
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create journal {%s}", tmp)
+	}
+
+	enc := json.NewEncoder(f)
+	for _, records := range j.pending {
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				f.Close()
+				return errors.Wrapf(err, "failed to write journal {%s}", tmp)
+			}
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "failed to sync journal {%s}", tmp)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return errors.Wrapf(err, "failed to replace journal {%s}", j.path)
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open journal {%s}", j.path)
+	}
+	return nil
+}
+
+// Pending returns the operations that are yet to
+// complete. Right after the journal is opened these
+// are the operations interrupted by a crash.
+func (j *Journal) Pending() []Pending {
+	j.Lock()
+	defer j.Unlock()
+
+	var ops []Pending
+	for _, records := range j.pending {
+		begin, last := records[0], records[len(records)-1]
+		ops = append(ops, Pending{
+			Op:       begin.Op,
+			LastStep: last.Step,
+			Volume:   begin.Volume,
+		})
+	}
+	return ops
+}
+
+// Begin records the intent to perform the provided
+// operation against the volume
+func (j *Journal) Begin(op Op, vol *apis.CSIVolume) error {
+	return j.append(Record{
+		Op:       op,
+		Step:     StepBegin,
+		VolumeID: vol.Spec.Volume.Name,
+		Volume:   vol,
+	})
+}
+
+// Step records the completion of the provided step
+// of the operation against the volume
+func (j *Journal) Step(op Op, volumeID string, step Step) error {
+	return j.append(Record{Op: op, Step: step, VolumeID: volumeID})
+}
+
+// Done records the completion of the operation
+// against the volume
+func (j *Journal) Done(op Op, volumeID string) error {
+	return j.append(Record{Op: op, Step: StepDone, VolumeID: volumeID})
+}
+
+// append writes the record to the journal and syncs
+// it to the disk
+func (j *Journal) append(r Record) error {
+	j.Lock()
+	defer j.Unlock()
+
+	r.Time = time.Now()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return errors.Wrapf(err, "failed to write journal {%s}", j.path)
+	}
+	if err := j.file.Sync(); err != nil {
+		return errors.Wrapf(err, "failed to sync journal {%s}", j.path)
+	}
+
+	j.apply(r)
+	// keep the journal small by rewriting it once
+	// no operation is in flight
+	if len(j.pending) == 0 {
+		return j.compact()
+	}
+	return nil
+}
+
+// Close closes the journal
+func (j *Journal) Close() error {
+	j.Lock()
+	defer j.Unlock()
+
+	return j.file.Close()
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+)
+
+func fakeVolume(name string) *apis.CSIVolume {
+	vol := &apis.CSIVolume{}
+	vol.Spec.Volume.Name = name
+	return vol
+}
+
+func TestJournalReplay(t *testing.T) {
+	tests := map[string]struct {
+		record        func(j *Journal)
+		corruptTail   bool
+		expectedOps   int
+		expectedOp    Op
+		expectedStep  Step
+		expectedEmpty bool
+	}{
+		"completed operation is not pending": {
+			record: func(j *Journal) {
+				_ = j.Begin(OpPublish, fakeVolume("pvc-1"))
+				_ = j.Step(OpPublish, "pvc-1", StepCRCreated)
+				_ = j.Done(OpPublish, "pvc-1")
+			},
+			expectedOps:   0,
+			expectedEmpty: true,
+		},
+		"interrupted publish is pending": {
+			record: func(j *Journal) {
+				_ = j.Begin(OpPublish, fakeVolume("pvc-1"))
+				_ = j.Step(OpPublish, "pvc-1", StepCRCreated)
+			},
+			expectedOps:  1,
+			expectedOp:   OpPublish,
+			expectedStep: StepCRCreated,
+		},
+		"interrupted unpublish with partial record": {
+			record: func(j *Journal) {
+				_ = j.Begin(OpPublish, fakeVolume("pvc-2"))
+				_ = j.Done(OpPublish, "pvc-2")
+				_ = j.Begin(OpUnpublish, fakeVolume("pvc-1"))
+			},
+			corruptTail:  true,
+			expectedOps:  1,
+			expectedOp:   OpUnpublish,
+			expectedStep: StepBegin,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "csi-journal")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			j, err := Open(dir)
+			if err != nil {
+				t.Fatalf("failed to open journal: %v", err)
+			}
+			mock.record(j)
+			// simulate a crash i.e. the journal is not
+			// closed gracefully
+			if mock.corruptTail {
+				_, _ = j.file.WriteString(`{"op":"unpublish","st`)
+			}
+
+			j, err = Open(dir)
+			if err != nil {
+				t.Fatalf("failed to reopen journal: %v", err)
+			}
+			defer j.Close()
+
+			pending := j.Pending()
+			if len(pending) != mock.expectedOps {
+				t.Fatalf("expected {%d} pending ops got {%d}: %+v", mock.expectedOps, len(pending), pending)
+			}
+			if mock.expectedOps == 1 {
+				if pending[0].Op != mock.expectedOp || pending[0].LastStep != mock.expectedStep {
+					t.Fatalf("expected {%s/%s} got {%s/%s}",
+						mock.expectedOp, mock.expectedStep, pending[0].Op, pending[0].LastStep)
+				}
+				if pending[0].Volume == nil || pending[0].Volume.Spec.Volume.Name != "pvc-1" {
+					t.Fatalf("expected volume pvc-1 got %+v", pending[0].Volume)
+				}
+			}
+
+			info, err := os.Stat(filepath.Join(dir, journalFile))
+			if err != nil {
+				t.Fatalf("failed to stat journal: %v", err)
+			}
+			if isEmpty := info.Size() == 0; isEmpty != mock.expectedEmpty {
+				t.Fatalf("expected journal empty {%t} got {%t}", mock.expectedEmpty, isEmpty)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// Formats of the log output
+const (
+	// FormatJSON writes every log as a json object
+	FormatJSON = "json"
+
+	// FormatText writes every log as key=value pairs
+	FormatText = "text"
+)
+
+// Levels of the logs which can be enabled
+const (
+	LevelDebug   = "debug"
+	LevelInfo    = "info"
+	LevelWarning = "warning"
+	LevelError   = "error"
+)
+
+// Fields are the structured context of a log e.g.
+// the volume being operated upon
+type Fields map[string]interface{}
+
+// Logger writes leveled & structured logs
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+
+	// Fatalf logs and exits the driver
+	Fatalf(format string, args ...interface{})
+
+	// With returns a logger which adds the given
+	// fields to every log
+	With(fields Fields) Logger
+}
+
+// entry implements Logger on logrus
+type entry struct {
+	*logrus.Entry
+}
+
+// With implements Logger
+func (e entry) With(fields Fields) Logger {
+	return entry{e.Entry.WithFields(logrus.Fields(fields))}
+}
+
+var (
+	// std is the logger of this driver, its level and
+	// format are shared by all the derived loggers
+	std = logrus.New()
+
+	// base is the logger with the fields common to
+	// all the logs of this driver
+	base Logger = entry{logrus.NewEntry(std)}
+)
+
+func init() {
+	std.SetOutput(os.Stderr)
+	std.SetFormatter(&logrus.JSONFormatter{})
+	std.SetLevel(logrus.InfoLevel)
+}
+
+// Init sets the fields common to all the logs of
+// this driver e.g. the node it runs on
+//
+// NOTE:
+//  This is expected to be called before the driver
+// starts serving
+func Init(fields Fields) {
+	base = entry{logrus.NewEntry(std).WithFields(logrus.Fields(fields))}
+}
+
+// SetFormat sets the format of the log output i.e.
+// json or text
+func SetFormat(format string) error {
+	switch format {
+	case FormatJSON:
+		std.SetFormatter(&logrus.JSONFormatter{})
+	case FormatText:
+		std.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	default:
+		return fmt.Errorf("invalid log format {%s}: should be one of %s or %s", format, FormatJSON, FormatText)
+	}
+	return nil
+}
+
+// SetOutput sets where the logs are written
+func SetOutput(w io.Writer) {
+	std.SetOutput(w)
+}
+
+// SetLevel sets the min level of the logs which are
+// written. This can be changed while the driver runs.
+func SetLevel(level string) error {
+	switch strings.ToLower(level) {
+	case LevelDebug:
+		std.SetLevel(logrus.DebugLevel)
+	case LevelInfo:
+		std.SetLevel(logrus.InfoLevel)
+	case LevelWarning, "warn":
+		std.SetLevel(logrus.WarnLevel)
+	case LevelError:
+		std.SetLevel(logrus.ErrorLevel)
+	default:
+		return fmt.Errorf(
+			"invalid log level {%s}: should be one of %s, %s, %s or %s",
+			level, LevelDebug, LevelInfo, LevelWarning, LevelError,
+		)
+	}
+	return nil
+}
+
+// GetLevel returns the min level of the logs which
+// are written
+func GetLevel() string {
+	switch std.GetLevel() {
+	case logrus.DebugLevel, logrus.TraceLevel:
+		return LevelDebug
+	case logrus.InfoLevel:
+		return LevelInfo
+	case logrus.WarnLevel:
+		return LevelWarning
+	}
+	return LevelError
+}
+
+// With returns a logger which adds the given fields
+// to every log
+func With(fields Fields) Logger {
+	return base.With(fields)
+}
+
+type loggerKey struct{}
+
+// NewContext returns a context which carries the
+// given logger
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger in the given context
+// e.g. the logger of a request, else the base logger
+func FromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return l
+	}
+	return base
+}
+
+// Debugf logs at debug level
+func Debugf(format string, args ...interface{}) {
+	base.Debugf(format, args...)
+}
+
+// Infof logs at info level
+func Infof(format string, args ...interface{}) {
+	base.Infof(format, args...)
+}
+
+// Warningf logs at warning level
+func Warningf(format string, args ...interface{}) {
+	base.Warningf(format, args...)
+}
+
+// Errorf logs at error level
+func Errorf(format string, args ...interface{}) {
+	base.Errorf(format, args...)
+}
+
+// Fatalf logs at fatal level and exits the driver
+func Fatalf(format string, args ...interface{}) {
+	base.Fatalf(format, args...)
+}
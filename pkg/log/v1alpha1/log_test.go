@@ -0,0 +1,121 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestStructuredLogs(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(os.Stderr)
+	if err := SetFormat(FormatJSON); err != nil {
+		t.Fatalf("Test {format} failed: %v", err)
+	}
+	Init(Fields{"node": "node1"})
+	defer Init(nil)
+
+	l := With(Fields{"method": "/csi.v1.Node/NodePublishVolume", "volume": "pvc-1"})
+	ctx := NewContext(context.Background(), l)
+	FromContext(ctx).Infof("volume {%s} is mounted", "pvc-1")
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Test {json} failed: expected json log got {%s}: %v", buf.String(), err)
+	}
+	expected := map[string]string{
+		"level":  "info",
+		"msg":    "volume {pvc-1} is mounted",
+		"node":   "node1",
+		"method": "/csi.v1.Node/NodePublishVolume",
+		"volume": "pvc-1",
+	}
+	for k, v := range expected {
+		if got[k] != v {
+			t.Fatalf("Test {fields} failed: expected {%s} to be {%s} got {%v}", k, v, got[k])
+		}
+	}
+
+	// logger of the driver is used if the context has
+	// none
+	if FromContext(context.Background()) != base {
+		t.Fatalf("Test {default} failed: expected base logger")
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(os.Stderr)
+	defer func() { _ = SetLevel(LevelInfo) }()
+
+	tests := map[string]struct {
+		method       string
+		target       string
+		expectedCode int
+		expectedBody string
+	}{
+		"get level": {
+			method:       "GET",
+			target:       "/loglevel",
+			expectedCode: 200,
+			expectedBody: `{"level":"info"}`,
+		},
+		"set debug level": {
+			method:       "PUT",
+			target:       "/loglevel?level=debug",
+			expectedCode: 200,
+			expectedBody: `{"level":"debug"}`,
+		},
+		"invalid level": {
+			method:       "PUT",
+			target:       "/loglevel?level=verbose",
+			expectedCode: 400,
+			expectedBody: "invalid log level {verbose}",
+		},
+		"invalid method": {
+			method:       "DELETE",
+			target:       "/loglevel",
+			expectedCode: 405,
+		},
+	}
+	// cases are run in order since they change the level
+	for _, name := range []string{"get level", "set debug level", "invalid level", "invalid method"} {
+		mock := tests[name]
+		rec := httptest.NewRecorder()
+		LevelHandler().ServeHTTP(rec, httptest.NewRequest(mock.method, mock.target, nil))
+		if rec.Code != mock.expectedCode {
+			t.Fatalf("Test {%s} failed: expected code {%d} got {%d}", name, mock.expectedCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), mock.expectedBody) {
+			t.Fatalf("Test {%s} failed: expected {%s} in {%s}", name, mock.expectedBody, rec.Body.String())
+		}
+	}
+
+	Debugf("visible at debug level")
+	if !strings.Contains(buf.String(), "visible at debug level") {
+		t.Fatalf("Test {runtime level} failed: expected debug log got {%s}", buf.String())
+	}
+}
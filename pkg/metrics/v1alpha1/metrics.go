@@ -0,0 +1,193 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of all the metrics
+// of this driver
+const namespace = "openebs_csi"
+
+// Operations on iSCSI sessions
+const (
+	// OperationLogin is a login to a target portal
+	OperationLogin = "login"
+
+	// OperationLogout is a logout of a target portal
+	OperationLogout = "logout"
+)
+
+var (
+	// Registry holds the metrics of this driver
+	//
+	// NOTE:
+	//  This is not the default registry so that only
+	// the metrics of this driver are exposed
+	Registry = prometheus.NewRegistry()
+
+	grpcRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_requests_total",
+			Help:      "Number of CSI requests handled, by method and gRPC code",
+		},
+		[]string{"method", "code"},
+	)
+
+	grpcRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Time taken to handle CSI requests, by method and gRPC code",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 20, 30, 60},
+		},
+		[]string{"method", "code"},
+	)
+
+	iscsiDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "iscsi_operation_duration_seconds",
+			Help:      "Time taken by iSCSI logins and logouts, by operation",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30},
+		},
+		[]string{"operation"},
+	)
+
+	iscsiFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "iscsi_operation_failures_total",
+			Help:      "Number of failed iSCSI logins and logouts, by operation",
+		},
+		[]string{"operation"},
+	)
+
+	// MonitoredVolumes is the number of volumes whose
+	// mounts are monitored by the node plugin
+	MonitoredVolumes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "monitored_volumes",
+			Help:      "Number of volumes whose mounts are monitored",
+		},
+	)
+
+	// PendingRemounts is the number of volumes being
+	// remounted by the node plugin
+	PendingRemounts = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "pending_remounts",
+			Help:      "Number of volumes being remounted",
+		},
+	)
+
+	remounts = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "remounts_total",
+			Help:      "Number of attempts to remount volumes",
+		},
+	)
+
+	remountFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "remount_failures_total",
+			Help:      "Number of failed attempts to remount volumes",
+		},
+	)
+
+	mapiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "maya_apiserver_request_duration_seconds",
+			Help:      "Time taken by requests to maya apiserver, by operation and http code",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"operation", "code"},
+	)
+)
+
+func init() {
+	Registry.MustRegister(
+		grpcRequests,
+		grpcRequestDuration,
+		iscsiDuration,
+		iscsiFailures,
+		MonitoredVolumes,
+		PendingRemounts,
+		remounts,
+		remountFailures,
+		mapiRequestDuration,
+	)
+}
+
+// ObserveGRPCRequest records a CSI request which was
+// handled with the given gRPC code
+func ObserveGRPCRequest(method, code string, took time.Duration) {
+	grpcRequests.WithLabelValues(method, code).Inc()
+	grpcRequestDuration.WithLabelValues(method, code).Observe(took.Seconds())
+}
+
+// ObserveISCSIOperation records an iSCSI login or
+// logout which failed if err is not nil
+func ObserveISCSIOperation(operation string, took time.Duration, err error) {
+	iscsiDuration.WithLabelValues(operation).Observe(took.Seconds())
+	if err != nil {
+		iscsiFailures.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveRemount records an attempt to remount a
+// volume which failed if err is not nil
+func ObserveRemount(err error) {
+	remounts.Inc()
+	if err != nil {
+		remountFailures.Inc()
+	}
+}
+
+// ObserveMAPIRequest records a request to maya
+// apiserver which got the given http code
+func ObserveMAPIRequest(operation, code string, took time.Duration) {
+	mapiRequestDuration.WithLabelValues(operation, code).Observe(took.Seconds())
+}
+
+// errorLogger logs the errors of the metrics handler
+type errorLogger struct{}
+
+// Println implements promhttp.Logger
+func (errorLogger) Println(v ...interface{}) {
+	log.Errorf("failed to serve metrics: %s", strings.TrimSpace(fmt.Sprintln(v...)))
+}
+
+// Handler serves the metrics of this driver in the
+// format negotiated with the scraper
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{ErrorLog: errorLogger{}})
+}
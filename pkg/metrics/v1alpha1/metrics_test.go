@@ -0,0 +1,109 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape returns the metrics served by Handler
+func scrape() string {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+// sample returns the value of the given series in the
+// given metrics, zero if the series is missing
+func sample(t *testing.T, body, series string) float64 {
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, series+" ") {
+			value, err := strconv.ParseFloat(strings.TrimPrefix(line, series+" "), 64)
+			if err != nil {
+				t.Fatalf("invalid value of series {%s}: %v", series, err)
+			}
+			return value
+		}
+	}
+	return 0
+}
+
+// NOTE:
+//  Metrics are registered globally, hence the change
+// in their values is asserted so that the test can be
+// run repeatedly
+func TestHandler(t *testing.T) {
+	before := scrape()
+	ObserveGRPCRequest("/csi.v1.Node/NodePublishVolume", "OK", 2*time.Second)
+	ObserveISCSIOperation(OperationLogin, time.Second, errors.New("login failed"))
+	ObserveRemount(nil)
+	ObserveMAPIRequest("create", "200", 100*time.Millisecond)
+	MonitoredVolumes.Set(3)
+	after := scrape()
+
+	tests := map[string]struct {
+		series   string
+		expected float64
+	}{
+		"grpc requests": {
+			series:   `openebs_csi_grpc_requests_total{code="OK",method="/csi.v1.Node/NodePublishVolume"}`,
+			expected: 1,
+		},
+		"grpc latency": {
+			series:   `openebs_csi_grpc_request_duration_seconds_count{code="OK",method="/csi.v1.Node/NodePublishVolume"}`,
+			expected: 1,
+		},
+		"iscsi failures": {
+			series:   `openebs_csi_iscsi_operation_failures_total{operation="login"}`,
+			expected: 1,
+		},
+		"remounts": {
+			series:   `openebs_csi_remounts_total`,
+			expected: 1,
+		},
+		"remount failures": {
+			series:   `openebs_csi_remount_failures_total`,
+			expected: 0,
+		},
+		"maya latency": {
+			series:   `openebs_csi_maya_apiserver_request_duration_seconds_count{code="200",operation="create"}`,
+			expected: 1,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			if !strings.Contains(after, mock.series+" ") {
+				t.Fatalf("Test {%s} failed: expected {%s} in metrics:\n%s", name, mock.series, after)
+			}
+			got := sample(t, after, mock.series) - sample(t, before, mock.series)
+			if got != mock.expected {
+				t.Fatalf("Test {%s} failed: expected change {%v} got {%v}", name, mock.expected, got)
+			}
+		})
+	}
+
+	if got := sample(t, after, "openebs_csi_monitored_volumes"); got != 3 {
+		t.Fatalf("Test {monitored volumes} failed: expected {3} got {%v}", got)
+	}
+}
@@ -0,0 +1,278 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ReplicaModeHealthy is the mode of a replica which
+// is in sync with the target
+const ReplicaModeHealthy = "Healthy"
+
+// VolumeHealth is the health of a volume as reported
+// by its target
+type VolumeHealth struct {
+	// Name of the volume i.e. the PV name
+	Name string
+
+	// ReplicationFactor is the number of replicas
+	// the volume is provisioned with
+	ReplicationFactor int
+
+	// ConsistencyFactor is the number of replicas
+	// required for the quorum
+	ConsistencyFactor int
+
+	// Replicas is the number of replicas by mode
+	Replicas map[string]int
+
+	// QuorumReplicas is the number of replicas
+	// which are part of the quorum
+	QuorumReplicas int
+
+	// CapacityBytes is the provisioned capacity
+	CapacityBytes float64
+}
+
+// HealthyReplicas returns the number of replicas
+// which are in sync with the target
+func (v VolumeHealth) HealthyReplicas() int {
+	n := 0
+	for mode, count := range v.Replicas {
+		if strings.EqualFold(mode, ReplicaModeHealthy) {
+			n += count
+		}
+	}
+	return n
+}
+
+// HasQuorum returns true if enough replicas are part
+// of the quorum to serve IOs
+func (v VolumeHealth) HasQuorum() bool {
+	return v.ConsistencyFactor > 0 && v.QuorumReplicas >= v.ConsistencyFactor
+}
+
+// IsDegraded returns true if fewer replicas than the
+// replication factor are healthy
+func (v VolumeHealth) IsDegraded() bool {
+	return v.HealthyReplicas() < v.ReplicationFactor
+}
+
+// VolumeHealthLister lists the health of all the
+// volumes, it is called on every scrape
+type VolumeHealthLister func() ([]VolumeHealth, error)
+
+var (
+	volumeReplicasDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "volume", "replicas"),
+		"Number of replicas of the volume, by mode",
+		[]string{"volume", "mode"}, nil,
+	)
+
+	volumeReplicationFactorDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "volume", "replication_factor"),
+		"Number of replicas the volume is provisioned with",
+		[]string{"volume"}, nil,
+	)
+
+	volumeQuorumDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "volume", "quorum"),
+		"1 if enough replicas of the volume are part of the quorum, 0 otherwise",
+		[]string{"volume"}, nil,
+	)
+
+	volumeDegradedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "volume", "degraded_seconds"),
+		"Time since the volume was seen with fewer healthy replicas than its replication factor, 0 if it is not degraded",
+		[]string{"volume"}, nil,
+	)
+
+	volumeCapacityDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "volume", "capacity_bytes"),
+		"Provisioned capacity of the volume",
+		[]string{"volume"}, nil,
+	)
+)
+
+// VolumeHealthCollector exports the replica health
+// of the volumes listed on every scrape
+type VolumeHealthCollector struct {
+	sync.Mutex
+
+	list VolumeHealthLister
+
+	// degradedSince holds the time when a volume
+	// was first seen degraded
+	degradedSince map[string]time.Time
+
+	// now is the clock, it is a field to be able
+	// to test the degraded duration
+	now func() time.Time
+}
+
+// NewVolumeHealthCollector returns a collector which
+// exports the health of the volumes listed by the
+// given lister
+func NewVolumeHealthCollector(list VolumeHealthLister) *VolumeHealthCollector {
+	return &VolumeHealthCollector{
+		list:          list,
+		degradedSince: map[string]time.Time{},
+		now:           time.Now,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *VolumeHealthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- volumeReplicasDesc
+	ch <- volumeReplicationFactorDesc
+	ch <- volumeQuorumDesc
+	ch <- volumeDegradedDesc
+	ch <- volumeCapacityDesc
+}
+
+// Collect implements prometheus.Collector
+//
+// NOTE:
+//  A failure to list the volumes is only logged so
+// that the other metrics of the driver are still
+// served
+func (c *VolumeHealthCollector) Collect(ch chan<- prometheus.Metric) {
+	vols, err := c.list()
+	if err != nil {
+		log.Errorf("failed to list volume health: %v", err)
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.now()
+	seen := map[string]bool{}
+	for _, vol := range vols {
+		seen[vol.Name] = true
+
+		for mode, count := range vol.Replicas {
+			ch <- prometheus.MustNewConstMetric(volumeReplicasDesc,
+				prometheus.GaugeValue, float64(count), vol.Name, mode)
+		}
+		ch <- prometheus.MustNewConstMetric(volumeReplicationFactorDesc,
+			prometheus.GaugeValue, float64(vol.ReplicationFactor), vol.Name)
+
+		quorum := 0.0
+		if vol.HasQuorum() {
+			quorum = 1
+		}
+		ch <- prometheus.MustNewConstMetric(volumeQuorumDesc,
+			prometheus.GaugeValue, quorum, vol.Name)
+
+		degraded := 0.0
+		if vol.IsDegraded() {
+			since, ok := c.degradedSince[vol.Name]
+			if !ok {
+				since = now
+				c.degradedSince[vol.Name] = since
+			}
+			degraded = now.Sub(since).Seconds()
+		} else {
+			delete(c.degradedSince, vol.Name)
+		}
+		ch <- prometheus.MustNewConstMetric(volumeDegradedDesc,
+			prometheus.GaugeValue, degraded, vol.Name)
+
+		ch <- prometheus.MustNewConstMetric(volumeCapacityDesc,
+			prometheus.GaugeValue, vol.CapacityBytes, vol.Name)
+	}
+
+	// Volumes which are deleted are not tracked
+	// any longer
+	for name := range c.degradedSince {
+		if !seen[name] {
+			delete(c.degradedSince, name)
+		}
+	}
+}
+
+// VolumeUsage is the usage of the filesystem of a
+// volume published on this node
+type VolumeUsage struct {
+	// Name of the volume i.e. the PV name
+	Name string
+
+	// UsedBytes is the space used on the filesystem
+	UsedBytes float64
+
+	// TotalBytes is the size of the filesystem
+	TotalBytes float64
+}
+
+// VolumeUsageLister lists the usage of the volumes,
+// it is called on every scrape
+type VolumeUsageLister func() []VolumeUsage
+
+var (
+	volumeUsedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "volume", "used_bytes"),
+		"Space used on the filesystem of the volume",
+		[]string{"volume"}, nil,
+	)
+
+	volumeFilesystemDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "volume", "filesystem_bytes"),
+		"Size of the filesystem of the volume",
+		[]string{"volume"}, nil,
+	)
+)
+
+// VolumeUsageCollector exports the usage of the
+// volumes listed on every scrape
+//
+// NOTE:
+//  The target does not report the space used by a
+// volume, this is hence exported by the node plugin
+// where the filesystem of the volume is mounted
+type VolumeUsageCollector struct {
+	list VolumeUsageLister
+}
+
+// NewVolumeUsageCollector returns a collector which
+// exports the usage of the volumes listed by the
+// given lister
+func NewVolumeUsageCollector(list VolumeUsageLister) *VolumeUsageCollector {
+	return &VolumeUsageCollector{list: list}
+}
+
+// Describe implements prometheus.Collector
+func (c *VolumeUsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- volumeUsedDesc
+	ch <- volumeFilesystemDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *VolumeUsageCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, vol := range c.list() {
+		ch <- prometheus.MustNewConstMetric(volumeUsedDesc,
+			prometheus.GaugeValue, vol.UsedBytes, vol.Name)
+		ch <- prometheus.MustNewConstMetric(volumeFilesystemDesc,
+			prometheus.GaugeValue, vol.TotalBytes, vol.Name)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// gather returns the metrics of the given collector
+// in text format
+func gather(t *testing.T, c prometheus.Collector) string {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtText)
+	for _, family := range families {
+		if err := enc.Encode(family); err != nil {
+			t.Fatalf("failed to encode metrics: %v", err)
+		}
+	}
+	return buf.String()
+}
+
+func TestVolumeHealthCollector(t *testing.T) {
+	vols := []VolumeHealth{
+		{
+			Name:              "pvc-healthy",
+			ReplicationFactor: 3,
+			ConsistencyFactor: 2,
+			Replicas:          map[string]int{"Healthy": 3},
+			QuorumReplicas:    3,
+			CapacityBytes:     5368709120,
+		},
+		{
+			Name:              "pvc-degraded",
+			ReplicationFactor: 3,
+			ConsistencyFactor: 2,
+			Replicas:          map[string]int{"Healthy": 1, "Degraded": 2},
+			QuorumReplicas:    1,
+		},
+	}
+	c := NewVolumeHealthCollector(func() ([]VolumeHealth, error) { return vols, nil })
+	start := time.Now()
+	c.now = func() time.Time { return start }
+	gather(t, c)
+
+	// second scrape a minute later
+	c.now = func() time.Time { return start.Add(time.Minute) }
+	body := gather(t, c)
+
+	tests := map[string]struct {
+		expected string
+	}{
+		"healthy replicas": {
+			expected: `openebs_csi_volume_replicas{mode="Healthy",volume="pvc-healthy"} 3`,
+		},
+		"degraded replicas": {
+			expected: `openebs_csi_volume_replicas{mode="Degraded",volume="pvc-degraded"} 2`,
+		},
+		"replication factor": {
+			expected: `openebs_csi_volume_replication_factor{volume="pvc-degraded"} 3`,
+		},
+		"quorum": {
+			expected: `openebs_csi_volume_quorum{volume="pvc-healthy"} 1`,
+		},
+		"no quorum": {
+			expected: `openebs_csi_volume_quorum{volume="pvc-degraded"} 0`,
+		},
+		"degraded since a minute": {
+			expected: `openebs_csi_volume_degraded_seconds{volume="pvc-degraded"} 60`,
+		},
+		"not degraded": {
+			expected: `openebs_csi_volume_degraded_seconds{volume="pvc-healthy"} 0`,
+		},
+		"capacity": {
+			expected: `openebs_csi_volume_capacity_bytes{volume="pvc-healthy"} 5.36870912e+09`,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			if !strings.Contains(body, mock.expected) {
+				t.Fatalf("Test {%s} failed: expected {%s} in metrics:\n%s", name, mock.expected, body)
+			}
+		})
+	}
+
+	// recovered volume is not tracked any longer
+	vols[1].Replicas = map[string]int{"Healthy": 3}
+	gather(t, c)
+	if _, ok := c.degradedSince["pvc-degraded"]; ok {
+		t.Fatalf("Test {recovered} failed: expected degraded time of {pvc-degraded} to be reset")
+	}
+}
+
+func TestVolumeUsageCollector(t *testing.T) {
+	c := NewVolumeUsageCollector(func() []VolumeUsage {
+		return []VolumeUsage{{Name: "pvc-1", UsedBytes: 1024, TotalBytes: 4096}}
+	})
+	body := gather(t, c)
+
+	for _, expected := range []string{
+		`openebs_csi_volume_used_bytes{volume="pvc-1"} 1024`,
+		`openebs_csi_volume_filesystem_bytes{volume="pvc-1"} 4096`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("Test {usage} failed: expected {%s} in metrics:\n%s", expected, body)
+		}
+	}
+}
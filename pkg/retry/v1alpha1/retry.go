@@ -0,0 +1,134 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Policy defines how an operation is retried till
+// it succeeds
+//
+// NOTE:
+//  The interval between retries starts at
+// InitialInterval & grows by Multiplier after every
+// retry till it reaches MaxInterval
+type Policy struct {
+	// InitialInterval is the time to wait before
+	// the first retry
+	InitialInterval time.Duration
+
+	// MaxInterval caps the time to wait between
+	// retries
+	MaxInterval time.Duration
+
+	// Multiplier is the factor by which the
+	// interval grows after every retry
+	Multiplier float64
+
+	// Jitter is the fraction of the interval that
+	// is randomized e.g. 0.2 implies the interval
+	// varies by +/- 20%
+	Jitter float64
+
+	// MaxElapsedTime is the time after which the
+	// operation is no more retried. Operation is
+	// retried till the context is done if this is
+	// zero.
+	MaxElapsedTime time.Duration
+}
+
+// permanentError is an error that should
+// not be retried
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string {
+	return p.err.Error()
+}
+
+// Permanent wraps the provided error to stop
+// further retries
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Do invokes the provided function till it succeeds,
+// returns a permanent error, the max elapsed time
+// is reached or the context is done. The last error
+// is returned if the function never succeeded.
+func (p Policy) Do(ctx context.Context, fn func() error) error {
+	start := time.Now()
+	interval := p.InitialInterval
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if perr, ok := err.(*permanentError); ok {
+			return perr.err
+		}
+
+		wait := p.jitter(interval)
+		if p.MaxElapsedTime > 0 && time.Since(start)+wait > p.MaxElapsedTime {
+			return fmt.Errorf("gave up after %d attempts in %v: %v",
+				attempt, time.Since(start).Round(time.Millisecond), err)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("gave up after %d attempts: %v: %v",
+				attempt, ctx.Err(), err)
+		case <-timer.C:
+		}
+
+		interval = p.next(interval)
+	}
+}
+
+// next returns the interval to be used after the
+// provided interval
+func (p Policy) next(interval time.Duration) time.Duration {
+	if p.Multiplier > 1 {
+		interval = time.Duration(float64(interval) * p.Multiplier)
+	}
+	if p.MaxInterval > 0 && interval > p.MaxInterval {
+		interval = p.MaxInterval
+	}
+	return interval
+}
+
+// jitter randomizes the provided interval as per
+// the jitter of this policy
+func (p Policy) jitter(interval time.Duration) time.Duration {
+	if p.Jitter <= 0 || interval <= 0 {
+		return interval
+	}
+	delta := p.Jitter * float64(interval)
+	return time.Duration(float64(interval) - delta + rand.Float64()*2*delta)
+}
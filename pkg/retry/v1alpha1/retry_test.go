@@ -0,0 +1,116 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestPolicyDo(t *testing.T) {
+	policy := Policy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     4 * time.Millisecond,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxElapsedTime:  200 * time.Millisecond,
+	}
+	failing := errors.New("not ready")
+
+	tests := map[string]struct {
+		policy           Policy
+		timeout          time.Duration
+		succeedOnAttempt int
+		permanentAt      int
+		isErr            bool
+		expectedAttempts int
+	}{
+		"succeeds at first attempt": {
+			policy:           policy,
+			succeedOnAttempt: 1,
+			expectedAttempts: 1,
+		},
+		"succeeds after retries": {
+			policy:           policy,
+			succeedOnAttempt: 4,
+			expectedAttempts: 4,
+		},
+		"permanent error stops retries": {
+			policy:           policy,
+			permanentAt:      2,
+			isErr:            true,
+			expectedAttempts: 2,
+		},
+		"max elapsed time is reached": {
+			policy: policy,
+			isErr:  true,
+		},
+		"context deadline is reached": {
+			policy:  Policy{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond},
+			timeout: 20 * time.Millisecond,
+			isErr:   true,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if mock.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, mock.timeout)
+				defer cancel()
+			}
+
+			attempts := 0
+			err := mock.policy.Do(ctx, func() error {
+				attempts++
+				if attempts == mock.permanentAt {
+					return Permanent(failing)
+				}
+				if attempts == mock.succeedOnAttempt {
+					return nil
+				}
+				return failing
+			})
+			if mock.isErr && err == nil {
+				t.Fatalf("expected error got nil after %d attempts", attempts)
+			}
+			if !mock.isErr && err != nil {
+				t.Fatalf("expected no error got: %v", err)
+			}
+			if mock.expectedAttempts > 0 && attempts != mock.expectedAttempts {
+				t.Fatalf("expected {%d} attempts got {%d}", mock.expectedAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestPolicyNext(t *testing.T) {
+	policy := Policy{InitialInterval: time.Second, MaxInterval: 5 * time.Second, Multiplier: 2}
+
+	interval := policy.InitialInterval
+	for _, expected := range []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		interval = policy.next(interval)
+		if interval != expected {
+			t.Fatalf("expected interval {%v} got {%v}", expected, interval)
+		}
+	}
+}
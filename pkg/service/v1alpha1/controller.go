@@ -19,10 +19,13 @@ package v1alpha1
 import (
 	"fmt"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	event "github.com/openebs/csi/pkg/event/v1alpha1"
 	errors "github.com/openebs/csi/pkg/generated/maya/errors/v1alpha1"
+	iscsi "github.com/openebs/csi/pkg/iscsi/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
 	csipayload "github.com/openebs/csi/pkg/payload/v1alpha1"
+	trace "github.com/openebs/csi/pkg/trace/v1alpha1"
 	"github.com/openebs/csi/pkg/utils/v1alpha1"
 	csivolume "github.com/openebs/csi/pkg/volume/v1alpha1"
 	"golang.org/x/net/context"
@@ -108,12 +111,24 @@ func (cs *controller) validateRequest(c csi.ControllerServiceCapability_RPC_Type
 	)
 }
 
+// pvcRefs returns the claim for which the volume of
+// the given request is being created, the events of
+// provisioning are recorded against it
+func pvcRefs(req *csi.CreateVolumeRequest) event.Refs {
+	params := req.GetParameters()
+	pvc := event.PersistentVolumeClaim(params["namespace"], params["persistentvolumeclaim"])
+	if pvc == nil {
+		return nil
+	}
+	return event.Refs{pvc}
+}
+
 // CreateVolume provisions a volume
 func (cs *controller) CreateVolume(
 	ctx context.Context,
 	req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
 
-	logrus.Infof("received request to create volume {%s}", req.GetName())
+	log.FromContext(ctx).Infof("received request to create volume {%s}", req.GetName())
 
 	err := cs.validateRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME)
 	if err != nil {
@@ -132,6 +147,11 @@ func (cs *controller) CreateVolume(
 		)
 	}
 
+	if err = cs.driver.lockVolume(volName); err != nil {
+		return nil, err
+	}
+	defer cs.driver.unlockVolume(volName)
+
 	volCapabilities := req.GetVolumeCapabilities()
 	if volCapabilities == nil {
 		return nil, status.Error(
@@ -149,6 +169,24 @@ func (cs *controller) CreateVolume(
 		}
 	}
 
+	// iSCSI session of the volume is tuned as per
+	// the parameters of its StorageClass
+	sessionParams, err := iscsi.SessionParameters(req.GetParameters())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"failed to handle create volume request for {%s}: %v", volName, err)
+	}
+
+	if _, err = utils.ParseRepairPolicy(req.GetParameters()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"failed to handle create volume request for {%s}: %v", volName, err)
+	}
+
+	if _, err = utils.ParseDegradedPolicy(req.GetParameters()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"failed to handle create volume request for {%s}: %v", volName, err)
+	}
+
 	// verify if the volume has already been created
 	_, err = utils.GetVolumeByName(volName)
 	if err == nil {
@@ -165,10 +203,13 @@ func (cs *controller) CreateVolume(
 	// reconciliation
 	//
 	// Send volume creation request to maya apiserver
-	casvol, err := utils.ProvisionVolume(req)
+	casvol, err := utils.ProvisionVolume(ctx, req)
 	if err != nil {
+		pvcRefs(req).Warning("ProvisioningFailed",
+			"failed to provision volume {%s}: %v", volName, err)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	pvcRefs(req).Normal("Provisioned", "volume {%s} is provisioned", volName)
 
 	// Create a csi vol object from maya apiserver's
 	// create volume request
@@ -180,20 +221,30 @@ func (cs *controller) CreateVolume(
 	// to catch duplicate requests
 	utils.Volumes[volName] = csivol
 
+	// VolumeContext is essential for publishing
+	// volumes at nodes, for iscsi login, this
+	// will be stored in PV CR
+	volContext := map[string]string{
+		"volname":        volName,
+		"iqn":            casvol.Spec.Iqn,
+		"targetPortal":   casvol.Spec.TargetPortal,
+		"lun":            "0",
+		"iscsiInterface": "default",
+	}
+	for k, v := range sessionParams {
+		volContext[k] = v
+	}
+	if policy := req.GetParameters()[utils.RepairPolicyKey]; policy != "" {
+		volContext[utils.RepairPolicyKey] = policy
+	}
+	if policy := req.GetParameters()[utils.DegradedPolicyKey]; policy != "" {
+		volContext[utils.DegradedPolicyKey] = policy
+	}
+
 	return csipayload.NewCreateVolumeResponseBuilder().
 		WithName(volName).
 		WithCapacity(req.GetCapacityRange().GetRequiredBytes()).
-		// VolumeContext is essential for publishing
-		// volumes at nodes, for iscsi login, this
-		// will be stored in PV CR
-		WithContext(map[string]string{
-			"volname":        volName,
-			"iqn":            casvol.Spec.Iqn,
-			"targetPortal":   casvol.Spec.TargetPortal,
-			"lun":            "0",
-			"iscsiInterface": "default",
-			"portals":        casvol.Spec.TargetPortal,
-		}).
+		WithContext(volContext).
 		Build(), nil
 }
 
@@ -202,7 +253,7 @@ func (cs *controller) DeleteVolume(
 	ctx context.Context,
 	req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
 
-	logrus.Infof("received request to delete volume {%s}", req.VolumeId)
+	log.FromContext(ctx).Infof("received request to delete volume {%s}", req.VolumeId)
 
 	if req.VolumeId == "" {
 		return nil, status.Error(
@@ -220,8 +271,15 @@ func (cs *controller) DeleteVolume(
 		)
 	}
 
+	if err = cs.driver.lockVolume(req.VolumeId); err != nil {
+		return nil, err
+	}
+	defer cs.driver.unlockVolume(req.VolumeId)
+
 	// this call is made just to fetch pvc namespace
+	_, span := trace.Start(ctx, "k8s.GetPersistentVolume")
 	pv, err := utils.FetchPVDetails(req.VolumeId)
+	trace.End(span, err)
 	if err != nil {
 		return nil, errors.Wrapf(
 			err,
@@ -233,7 +291,7 @@ func (cs *controller) DeleteVolume(
 	pvcNamespace := pv.Spec.ClaimRef.Namespace
 
 	// send delete request to maya apiserver
-	err = utils.DeleteVolume(req.VolumeId, pvcNamespace)
+	err = utils.DeleteVolume(ctx, req.VolumeId, pvcNamespace)
 	if err != nil {
 		return nil, errors.Wrapf(
 			err,
@@ -388,3 +446,14 @@ func (cs *controller) ListVolumes(
 
 	return nil, status.Error(codes.Unimplemented, "")
 }
+
+// ControllerGetVolume fetches the given volume
+//
+// This implements csi.ControllerServer
+func (cs *controller) ControllerGetVolume(
+	ctx context.Context,
+	req *csi.ControllerGetVolumeRequest,
+) (*csi.ControllerGetVolumeResponse, error) {
+
+	return nil, status.Error(codes.Unimplemented, "")
+}
@@ -0,0 +1,480 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	listers "github.com/openebs/csi/pkg/generated/lister/core/v1alpha1"
+	iscsi "github.com/openebs/csi/pkg/iscsi/v1alpha1"
+	journal "github.com/openebs/csi/pkg/journal/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	"github.com/openebs/csi/pkg/utils/v1alpha1"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+const (
+	// openebsIqnPrefix is the prefix of the IQNs of
+	// OpenEBS targets. Sessions to any other target
+	// are never garbage collected.
+	openebsIqnPrefix = "iqn.2016-09.com.openebs"
+
+	// gcAuditLog is the name of the file in the state
+	// dir where the actions of the garbage collector
+	// are recorded
+	gcAuditLog = "gc-audit.log"
+)
+
+var (
+	// kubeletPodsDir is the directory where kubelet
+	// creates the volume directories of the pods
+	kubeletPodsDir = "/var/lib/kubelet/pods"
+
+	// byPathDir is the directory where udev creates
+	// the links to the disks of the iSCSI LUNs
+	byPathDir = "/dev/disk/by-path"
+)
+
+// orphan is an iSCSI session of this node that is
+// not owned by any volume
+type orphan struct {
+	session iscsi.Session
+	volName string
+}
+
+// gcAuditEntry is a single entry of the audit log
+// of the garbage collector
+type gcAuditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Volume string    `json:"volume"`
+	Iqn    string    `json:"iqn"`
+	Portal string    `json:"portal"`
+	Path   string    `json:"path,omitempty"`
+	DryRun bool      `json:"dryRun"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// orphanCollector logs out of the iSCSI sessions of
+// this node which are left behind e.g. by a failed
+// unpublish or a crash of the node. Disks of such
+// sessions which are still mounted are unmounted
+// before the logout & links to the disks of the
+// OpenEBS volumes which are gone are removed.
+//
+// NOTE:
+//  A session is an orphan only if it was logged in to
+// by this driver i.e. its volume has an iSCSI record or
+// a pending operation in the journal of this driver,
+// its volume is not published by this driver, the
+// volume has no CSIVolume CR of this node & kubelet
+// has no directory for the volume in any pod. Sessions
+// of other initiators e.g. the in-tree iSCSI plugin or
+// an admin are never collected.
+type orphanCollector struct {
+	driver *CSIDriver
+	lister listers.CSIVolumeLister
+
+	// mounter lists & unmounts the mounts of the
+	// disks of the orphaned sessions
+	mounter mount.Interface
+
+	// logout logs out of the orphaned session of
+	// the given volume
+	logout func(session iscsi.Session, volName string) error
+
+	// hasRecord returns true if the volume has an
+	// iSCSI record of this driver
+	hasRecord func(volName string) bool
+
+	// dryRun only reports the orphans
+	dryRun bool
+
+	// audit is the path of the audit log
+	audit string
+
+	// reported & lastReported hold the entries which
+	// are audited during the current & the previous
+	// collection so that an orphan which is left as
+	// is e.g. in dry run is audited only once
+	reported     map[string]bool
+	lastReported map[string]bool
+}
+
+// newOrphanCollector returns a new instance of
+// orphanCollector
+func newOrphanCollector(d *CSIDriver) *orphanCollector {
+	return &orphanCollector{
+		driver:    d,
+		lister:    d.reconciler.lister,
+		mounter:   mount.New(""),
+		logout:    iscsi.LogoutSession,
+		hasRecord: iscsi.HasRecord,
+
+		dryRun: d.config.GCDryRun,
+		audit:  filepath.Join(d.config.StateDir, gcAuditLog),
+
+		reported:     map[string]bool{},
+		lastReported: map[string]bool{},
+	}
+}
+
+// Run garbage collects the orphaned sessions every
+// gc interval till the context is done. This should
+// be run as a goroutine.
+func (c *orphanCollector) Run(ctx context.Context) {
+	log.Infof("gc: collecting orphaned iSCSI sessions, mounts & links every %v, dry run: %t",
+		c.driver.config.GCInterval, c.dryRun)
+
+	ticker := time.NewTicker(c.driver.config.GCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("stopping orphaned iSCSI session collector")
+			return
+		case <-ticker.C:
+		}
+
+		// ownership of the sessions can be decided only
+		// once the published volumes & their CRs are known
+		if !c.driver.recovered.IsSet() || !c.driver.reconciler.informer.HasSynced() {
+			continue
+		}
+		if err := c.collect(); err != nil {
+			log.Errorf("gc: failed to collect orphaned iSCSI sessions: %v", err)
+		}
+	}
+}
+
+// collect logs out of the orphaned sessions and
+// removes the stale links of the volumes
+func (c *orphanCollector) collect() error {
+	c.lastReported, c.reported = c.reported, map[string]bool{}
+
+	sessions, err := iscsi.ListSysfsSessions()
+	if err != nil {
+		return err
+	}
+
+	owned, err := c.owned()
+	if err != nil {
+		return err
+	}
+
+	for _, o := range c.orphans(owned, sessions) {
+		// volume may get published in the meantime
+		if !c.driver.locks.TryAcquire(o.volName) {
+			continue
+		}
+		c.release(o)
+		c.driver.locks.Release(o.volName)
+	}
+	c.removeStaleLinks(owned)
+	return nil
+}
+
+// owned returns the IQNs & the names of the volumes
+// which are owned by this node
+func (c *orphanCollector) owned() (map[string]bool, error) {
+	csivols, err := c.lister.CSIVolumes(utils.OpenEBSNamespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	owned := map[string]bool{}
+	for _, csivol := range csivols {
+		owned[csivol.Spec.ISCSI.Iqn] = true
+		owned[csivol.Spec.Volume.Name] = true
+	}
+
+	utils.VolumesListLock.RLock()
+	for name, vol := range utils.Volumes {
+		owned[vol.Spec.ISCSI.Iqn] = true
+		owned[name] = true
+	}
+	utils.VolumesListLock.RUnlock()
+	return owned, nil
+}
+
+// orphans returns the sessions which are not owned
+// by any volume
+func (c *orphanCollector) orphans(owned map[string]bool, sessions []iscsi.Session) []orphan {
+	var orphans []orphan
+	for _, session := range sessions {
+		if !strings.HasPrefix(session.Iqn, openebsIqnPrefix) {
+			continue
+		}
+		// IQN of an OpenEBS target ends with the
+		// name of its volume
+		volName := volumeOfIqn(session.Iqn)
+		if owned[session.Iqn] || owned[volName] || isUsedByPod(volName) {
+			continue
+		}
+		if !c.isCreated(volName) {
+			continue
+		}
+		orphans = append(orphans, orphan{session: session, volName: volName})
+	}
+	return orphans
+}
+
+// volumeOfIqn returns the name of the volume of the
+// provided OpenEBS target IQN
+func volumeOfIqn(iqn string) string {
+	return iqn[strings.LastIndex(iqn, ":")+1:]
+}
+
+// isCreated returns true if the session of the
+// provided volume was logged in to by this driver
+func (c *orphanCollector) isCreated(volName string) bool {
+	if c.hasRecord(volName) {
+		return true
+	}
+	for _, op := range []journal.Op{journal.OpPublish, journal.OpUnpublish} {
+		if _, ok := c.driver.pendingOp(op, volName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isUsedByPod returns true if kubelet has a volume
+// directory for the provided volume in any pod, be it
+// a volume of this driver or of the in-tree iSCSI
+// plugin
+func isUsedByPod(volName string) bool {
+	for _, plugin := range []string{"kubernetes.io~csi", "kubernetes.io~iscsi"} {
+		dirs, err := filepath.Glob(filepath.Join(
+			kubeletPodsDir, "*", "volumes", plugin, volName))
+		// err is returned only for a malformed pattern,
+		// the session is kept to be on the safer side
+		if err != nil || len(dirs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// release unmounts the disks of the orphaned session,
+// logs out of it and records the same in the audit
+// log. Session is kept if any of its disks could not
+// be unmounted.
+func (c *orphanCollector) release(o orphan) {
+	if !c.unmount(o) {
+		return
+	}
+
+	entry := gcAuditEntry{
+		Action: "logout",
+		Volume: o.volName,
+		Iqn:    o.session.Iqn,
+		Portal: o.session.Portal,
+		DryRun: c.dryRun,
+	}
+
+	if c.dryRun {
+		if !c.isNew(entry) {
+			return
+		}
+		log.Infof("gc: dry run: would log out of orphaned session {%s} of volume {%s}",
+			o.session.Iqn, o.volName)
+	} else {
+		log.Infof("gc: logging out of orphaned session {%s} of volume {%s}",
+			o.session.Iqn, o.volName)
+		if err := c.logout(o.session, o.volName); err != nil {
+			log.Errorf("gc: failed to log out of orphaned session {%s}: %v", o.session.Iqn, err)
+			entry.Error = err.Error()
+		}
+	}
+	c.audited(entry)
+}
+
+// unmount unmounts the disks of the orphaned session
+// which are still mounted e.g. by a crash in the
+// middle of an unpublish. It returns false if any
+// of the disks could not be unmounted.
+func (c *orphanCollector) unmount(o orphan) bool {
+	devices, err := iscsi.SessionDevices(o.session)
+	if err != nil {
+		log.Errorf("gc: failed to get disks of orphaned session {%s}: %v", o.session.Iqn, err)
+		return false
+	}
+	if len(devices) == 0 {
+		return true
+	}
+
+	mounts, err := c.mounter.List()
+	if err != nil {
+		log.Errorf("gc: failed to list mounts: %v", err)
+		return false
+	}
+
+	// disk can be mounted through the multipath map
+	// or the device mapper target stacked on top of it
+	isDisk := map[string]bool{}
+	for _, device := range devices {
+		isDisk[device] = true
+		holders, err := iscsi.DeviceHolders(device)
+		if err != nil {
+			log.Errorf("gc: failed to get holders of disk {%s}: %v", device, err)
+			return false
+		}
+		for _, holder := range holders {
+			isDisk[holder] = true
+		}
+	}
+
+	ok := true
+	for _, mnt := range mounts {
+		if !isDisk[mnt.Device] {
+			continue
+		}
+
+		entry := gcAuditEntry{
+			Action: "unmount",
+			Volume: o.volName,
+			Iqn:    o.session.Iqn,
+			Portal: o.session.Portal,
+			Path:   mnt.Path,
+			DryRun: c.dryRun,
+		}
+		if c.dryRun {
+			if !c.isNew(entry) {
+				continue
+			}
+			log.Infof("gc: dry run: would unmount {%s} of orphaned volume {%s}", mnt.Path, o.volName)
+		} else {
+			log.Infof("gc: unmounting {%s} of orphaned volume {%s}", mnt.Path, o.volName)
+			if err := c.mounter.Unmount(mnt.Path); err != nil {
+				log.Errorf("gc: failed to unmount {%s}: %v", mnt.Path, err)
+				entry.Error = err.Error()
+				ok = false
+			}
+		}
+		c.audited(entry)
+	}
+	return ok
+}
+
+// removeStaleLinks removes the links to the disks of
+// the OpenEBS volumes which are not owned by this
+// node and whose disks are gone e.g. links which
+// are left behind when udev misses the removal of
+// the disk
+func (c *orphanCollector) removeStaleLinks(owned map[string]bool) {
+	links, err := filepath.Glob(filepath.Join(byPathDir, "*-iscsi-"+openebsIqnPrefix+"*"))
+	if err != nil {
+		log.Errorf("gc: failed to list links in {%s}: %v", byPathDir, err)
+		return
+	}
+
+	for _, link := range links {
+		// link is named <path>-iscsi-<iqn>-lun-<lun>
+		name := filepath.Base(link)
+		iqn := name[strings.Index(name, "-iscsi-")+len("-iscsi-"):]
+		if i := strings.LastIndex(iqn, "-lun-"); i != -1 {
+			iqn = iqn[:i]
+		}
+		volName := volumeOfIqn(iqn)
+		if owned[iqn] || owned[volName] {
+			continue
+		}
+		// link whose disk still exists belongs to
+		// a session which is collected as an orphan
+		if _, err := os.Stat(link); !os.IsNotExist(err) {
+			continue
+		}
+		if !c.driver.locks.TryAcquire(volName) {
+			continue
+		}
+
+		entry := gcAuditEntry{
+			Action: "removeLink",
+			Volume: volName,
+			Iqn:    iqn,
+			Path:   link,
+			DryRun: c.dryRun,
+		}
+		if c.dryRun {
+			if !c.isNew(entry) {
+				c.driver.locks.Release(volName)
+				continue
+			}
+			log.Infof("gc: dry run: would remove stale link {%s} of volume {%s}", link, volName)
+		} else {
+			log.Infof("gc: removing stale link {%s} of volume {%s}", link, volName)
+			if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+				log.Errorf("gc: failed to remove stale link {%s}: %v", link, err)
+				entry.Error = err.Error()
+			}
+		}
+		c.driver.locks.Release(volName)
+		c.audited(entry)
+	}
+}
+
+// isNew returns false if the provided entry was
+// already audited during the previous collection
+// i.e. nothing has changed since then
+func (c *orphanCollector) isNew(entry gcAuditEntry) bool {
+	key := strings.Join([]string{
+		entry.Action, entry.Volume, entry.Iqn, entry.Portal,
+		entry.Path, strconv.FormatBool(entry.DryRun), entry.Error,
+	}, "|")
+	c.reported[key] = true
+	return !c.lastReported[key]
+}
+
+// audited records the provided entry in the audit
+// log unless it was already audited during the
+// previous collection, failure to do so is only
+// logged
+func (c *orphanCollector) audited(entry gcAuditEntry) {
+	if !c.isNew(entry) {
+		return
+	}
+	if err := c.record(entry); err != nil {
+		log.Warningf("gc: failed to write audit log {%s}: %v", c.audit, err)
+	}
+}
+
+// record appends the provided entry to the
+// audit log
+func (c *orphanCollector) record(entry gcAuditEntry) error {
+	entry.Time = time.Now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(c.audit, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
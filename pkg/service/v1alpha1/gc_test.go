@@ -0,0 +1,489 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	config "github.com/openebs/csi/pkg/config/v1alpha1"
+	listers "github.com/openebs/csi/pkg/generated/lister/core/v1alpha1"
+	iscsi "github.com/openebs/csi/pkg/iscsi/v1alpha1"
+	journal "github.com/openebs/csi/pkg/journal/v1alpha1"
+	"github.com/openebs/csi/pkg/utils/v1alpha1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+func fakeSession(volName string) iscsi.Session {
+	return iscsi.Session{
+		ID:     volName,
+		Portal: "10.0.0.1:3260",
+		Iqn:    "iqn.2016-09.com.openebs.cstor:" + volName,
+	}
+}
+
+// fakeCollector returns a dry run orphan collector whose
+// lister holds the CSIVolumes of the provided volumes
+func fakeCollector(t *testing.T, stateDir string, crs ...string) *orphanCollector {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, name := range crs {
+		csivol := &apis.CSIVolume{}
+		csivol.Name = name + "-node1"
+		csivol.Namespace = utils.OpenEBSNamespace
+		csivol.Spec.Volume.Name = name
+		csivol.Spec.ISCSI.Iqn = fakeSession(name).Iqn
+		if err := indexer.Add(csivol); err != nil {
+			t.Fatalf("failed to add csivolume {%s}: %v", name, err)
+		}
+	}
+
+	c := config.Default()
+	c.StateDir = stateDir
+	c.GCDryRun = true
+	d := &CSIDriver{config: c, locks: utils.NewVolumeLocks()}
+	d.reconciler = &volumeReconciler{lister: listers.NewCSIVolumeLister(indexer)}
+	collector := newOrphanCollector(d)
+	collector.mounter = &mount.FakeMounter{}
+	collector.logout = func(session iscsi.Session, volName string) error { return nil }
+	collector.hasRecord = func(volName string) bool { return true }
+	return collector
+}
+
+func TestOrphanCollector(t *testing.T) {
+	tests := map[string]struct {
+		sessions        []iscsi.Session
+		crs             []string
+		published       []string
+		podVolumes      []string
+		podPlugin       string
+		unrecorded      []string
+		journaled       []string
+		expectedOrphans []string
+	}{
+		"session owned by csivolume": {
+			sessions: []iscsi.Session{fakeSession("pvc-1")},
+			crs:      []string{"pvc-1"},
+		},
+		"session owned by published volume": {
+			sessions:  []iscsi.Session{fakeSession("pvc-1")},
+			published: []string{"pvc-1"},
+		},
+		"session used by a pod": {
+			sessions:   []iscsi.Session{fakeSession("pvc-1")},
+			podVolumes: []string{"pvc-1"},
+		},
+		"session used by a pod via in-tree iscsi": {
+			sessions:   []iscsi.Session{fakeSession("pvc-1")},
+			podVolumes: []string{"pvc-1"},
+			podPlugin:  "kubernetes.io~iscsi",
+		},
+		"session not logged in to by this driver": {
+			sessions:   []iscsi.Session{fakeSession("pvc-1")},
+			unrecorded: []string{"pvc-1"},
+		},
+		"session of a journaled operation": {
+			sessions:        []iscsi.Session{fakeSession("pvc-1")},
+			unrecorded:      []string{"pvc-1"},
+			journaled:       []string{"pvc-1"},
+			expectedOrphans: []string{"pvc-1"},
+		},
+		"session of other target is ignored": {
+			sessions: []iscsi.Session{{Iqn: "iqn.2003-01.org.linux-iscsi:target"}},
+		},
+		"orphaned sessions": {
+			sessions: []iscsi.Session{
+				fakeSession("pvc-1"), fakeSession("pvc-2"), fakeSession("pvc-3"),
+			},
+			crs:             []string{"pvc-2"},
+			expectedOrphans: []string{"pvc-1", "pvc-3"},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "csi-gc")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			kubeletPodsDir = filepath.Join(dir, "pods")
+			iscsi.SysfsRoot = filepath.Join(dir, "sys")
+			plugin := mock.podPlugin
+			if plugin == "" {
+				plugin = "kubernetes.io~csi"
+			}
+			for _, volName := range mock.podVolumes {
+				path := filepath.Join(kubeletPodsDir, "pod-uid", "volumes", plugin, volName)
+				if err = os.MkdirAll(path, 0750); err != nil {
+					t.Fatalf("failed to create pod volume dir: %v", err)
+				}
+			}
+
+			utils.VolumesListLock.Lock()
+			for _, volName := range mock.published {
+				vol := &apis.CSIVolume{}
+				vol.Spec.ISCSI.Iqn = fakeSession(volName).Iqn
+				utils.Volumes[volName] = vol
+			}
+			utils.VolumesListLock.Unlock()
+			defer func() {
+				utils.VolumesListLock.Lock()
+				for _, volName := range mock.published {
+					delete(utils.Volumes, volName)
+				}
+				utils.VolumesListLock.Unlock()
+			}()
+
+			c := fakeCollector(t, dir, mock.crs...)
+			unrecorded := map[string]bool{}
+			for _, volName := range mock.unrecorded {
+				unrecorded[volName] = true
+			}
+			c.hasRecord = func(volName string) bool { return !unrecorded[volName] }
+			if len(mock.journaled) != 0 {
+				j, err := journal.Open(filepath.Join(dir, "journal"))
+				if err != nil {
+					t.Fatalf("failed to open journal: %v", err)
+				}
+				defer j.Close()
+				for _, volName := range mock.journaled {
+					vol := &apis.CSIVolume{}
+					vol.Spec.Volume.Name = volName
+					if err = j.Begin(journal.OpUnpublish, vol); err != nil {
+						t.Fatalf("failed to journal volume {%s}: %v", volName, err)
+					}
+				}
+				c.driver.journal = j
+			}
+			owned, err := c.owned()
+			if err != nil {
+				t.Fatalf("expected no error got: %v", err)
+			}
+			orphans := c.orphans(owned, mock.sessions)
+			if len(orphans) != len(mock.expectedOrphans) {
+				t.Fatalf("expected orphans {%v} got {%+v}", mock.expectedOrphans, orphans)
+			}
+			for i, o := range orphans {
+				if o.volName != mock.expectedOrphans[i] {
+					t.Fatalf("expected orphan {%s} got {%s}", mock.expectedOrphans[i], o.volName)
+				}
+				// dry run only records the orphan
+				c.release(o)
+			}
+
+			f, err := os.Open(filepath.Join(dir, gcAuditLog))
+			if os.IsNotExist(err) && len(orphans) == 0 {
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to open audit log: %v", err)
+			}
+			defer f.Close()
+
+			var entries []gcAuditEntry
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				var entry gcAuditEntry
+				if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+					t.Fatalf("invalid audit entry {%s}: %v", scanner.Text(), err)
+				}
+				if !entry.DryRun || entry.Error != "" {
+					t.Fatalf("expected successful dry run entry got %+v", entry)
+				}
+				entries = append(entries, entry)
+			}
+			if len(entries) != len(mock.expectedOrphans) {
+				t.Fatalf("expected {%d} audit entries got {%d}", len(mock.expectedOrphans), len(entries))
+			}
+		})
+	}
+}
+
+// readAudit returns the entries of the audit log of
+// the garbage collector in the provided state dir
+func readAudit(t *testing.T, stateDir string) []gcAuditEntry {
+	f, err := os.Open(filepath.Join(stateDir, gcAuditLog))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	var entries []gcAuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry gcAuditEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid audit entry {%s}: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// failingUnmounter fails to unmount any path
+type failingUnmounter struct {
+	*mount.FakeMounter
+}
+
+func (m failingUnmounter) Unmount(target string) error {
+	return errors.New("target is busy")
+}
+
+func TestOrphanCollectorRelease(t *testing.T) {
+	tests := map[string]struct {
+		dryRun          bool
+		failUnmount     bool
+		device          string
+		expectedActions []string
+		expectedMounted bool
+		expectedLogout  bool
+	}{
+		"dry run only reports": {
+			dryRun:          true,
+			expectedActions: []string{"unmount", "logout"},
+			expectedMounted: true,
+		},
+		"disk is unmounted before logout": {
+			expectedActions: []string{"unmount", "logout"},
+			expectedLogout:  true,
+		},
+		"disk mounted through multipath map is unmounted": {
+			device:          "/dev/mapper/mpatha",
+			expectedActions: []string{"unmount", "logout"},
+			expectedLogout:  true,
+		},
+		"disk mounted through device mapper is unmounted": {
+			device:          "/dev/dm-3",
+			expectedActions: []string{"unmount", "logout"},
+			expectedLogout:  true,
+		},
+		"session is kept if unmount fails": {
+			failUnmount:     true,
+			expectedActions: []string{"unmount"},
+			expectedMounted: true,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "csi-gc")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			iscsi.SysfsRoot = filepath.Join(dir, "sys")
+			block := filepath.Join(iscsi.SysfsRoot, "class", "iscsi_session", "session1",
+				"device", "target2:0:0", "2:0:0:0", "block", "sdz")
+			if err = os.MkdirAll(block, 0755); err != nil {
+				t.Fatalf("failed to create %s: %v", block, err)
+			}
+			// multipath map dm-3 is stacked on top of sdz
+			holder := filepath.Join(iscsi.SysfsRoot, "class", "block", "sdz", "holders", "dm-3")
+			dm := filepath.Join(iscsi.SysfsRoot, "class", "block", "dm-3", "dm")
+			for _, dir := range []string{holder, dm} {
+				if err = os.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("failed to create %s: %v", dir, err)
+				}
+			}
+			if err = ioutil.WriteFile(filepath.Join(dm, "name"), []byte("mpatha\n"), 0644); err != nil {
+				t.Fatalf("failed to write dm name: %v", err)
+			}
+
+			device := mock.device
+			if device == "" {
+				device = "/dev/sdz"
+			}
+			c := fakeCollector(t, dir)
+			c.dryRun = mock.dryRun
+			fake := &mount.FakeMounter{MountPoints: []mount.MountPoint{
+				{Device: device, Path: "/mnt/pvc-9"},
+				{Device: "/dev/sda", Path: "/"},
+			}}
+			c.mounter = fake
+			if mock.failUnmount {
+				c.mounter = failingUnmounter{fake}
+			}
+			var loggedOut bool
+			c.logout = func(session iscsi.Session, volName string) error {
+				loggedOut = true
+				return nil
+			}
+
+			session := fakeSession("pvc-9")
+			session.ID = "1"
+			c.release(orphan{session: session, volName: "pvc-9"})
+
+			var actions []string
+			for _, entry := range readAudit(t, dir) {
+				actions = append(actions, entry.Action)
+			}
+			if !reflect.DeepEqual(actions, mock.expectedActions) {
+				t.Fatalf("Test {%s} failed: expected actions {%v} got {%v}", name, mock.expectedActions, actions)
+			}
+			if loggedOut != mock.expectedLogout {
+				t.Fatalf("Test {%s} failed: expected logout {%t} got {%t}", name, mock.expectedLogout, loggedOut)
+			}
+			mounted := false
+			for _, mp := range fake.MountPoints {
+				mounted = mounted || mp.Path == "/mnt/pvc-9"
+			}
+			if mounted != mock.expectedMounted {
+				t.Fatalf("Test {%s} failed: expected mounted {%t} got {%t}", name, mock.expectedMounted, mounted)
+			}
+		})
+	}
+}
+
+func TestOrphanCollectorAuditsChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csi-gc")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	kubeletPodsDir = filepath.Join(dir, "pods")
+	byPathDir = filepath.Join(dir, "by-path")
+	iscsi.SysfsRoot = filepath.Join(dir, "sys")
+	session := filepath.Join(iscsi.SysfsRoot, "class", "iscsi_session", "session1")
+	block := filepath.Join(session, "device", "target2:0:0", "2:0:0:0", "block", "sdz")
+	if err = os.MkdirAll(block, 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", block, err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(session, "targetname"),
+		[]byte(fakeSession("pvc-9").Iqn+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write targetname: %v", err)
+	}
+
+	c := fakeCollector(t, dir)
+	c.mounter = &mount.FakeMounter{MountPoints: []mount.MountPoint{
+		{Device: "/dev/sdz", Path: "/mnt/pvc-9"},
+	}}
+
+	// orphan which is left as is by the dry run is
+	// audited only once
+	for i := 0; i < 3; i++ {
+		if err = c.collect(); err != nil {
+			t.Fatalf("expected no error got: %v", err)
+		}
+	}
+	if entries := readAudit(t, dir); len(entries) != 2 {
+		t.Fatalf("expected unmount & logout in audit got %+v", entries)
+	}
+
+	// orphan is released once dry run is disabled
+	c.dryRun = false
+	if err = c.collect(); err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	entries := readAudit(t, dir)
+	if len(entries) != 4 || entries[2].DryRun || entries[3].DryRun {
+		t.Fatalf("expected unmount & logout to be audited again got %+v", entries)
+	}
+}
+
+func TestRemoveStaleLinks(t *testing.T) {
+	tests := map[string]struct {
+		dryRun          bool
+		expectedRemoved []string
+		expectedActions int
+	}{
+		"dry run only reports": {
+			dryRun:          true,
+			expectedActions: 1,
+		},
+		"stale link is removed": {
+			expectedRemoved: []string{"pvc-9"},
+			expectedActions: 1,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "csi-gc")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			byPathDir = filepath.Join(dir, "by-path")
+			if err = os.MkdirAll(byPathDir, 0755); err != nil {
+				t.Fatalf("failed to create %s: %v", byPathDir, err)
+			}
+			disk := filepath.Join(dir, "sdz")
+			if err = ioutil.WriteFile(disk, nil, 0600); err != nil {
+				t.Fatalf("failed to create %s: %v", disk, err)
+			}
+			links := map[string]string{
+				// disk is gone & volume is not owned
+				"pvc-9": filepath.Join(dir, "sdy"),
+				// disk is gone but volume is owned
+				"pvc-1": filepath.Join(dir, "sdx"),
+				// disk of an orphaned session
+				"pvc-8": disk,
+			}
+			path := func(volName string) string {
+				return filepath.Join(byPathDir, "ip-10.0.0.1:3260-iscsi-"+fakeSession(volName).Iqn+"-lun-0")
+			}
+			for volName, target := range links {
+				if err = os.Symlink(target, path(volName)); err != nil {
+					t.Fatalf("failed to create link: %v", err)
+				}
+			}
+
+			c := fakeCollector(t, dir, "pvc-1")
+			c.dryRun = mock.dryRun
+			owned, err := c.owned()
+			if err != nil {
+				t.Fatalf("expected no error got: %v", err)
+			}
+			c.removeStaleLinks(owned)
+
+			removed := map[string]bool{}
+			for _, volName := range mock.expectedRemoved {
+				removed[volName] = true
+			}
+			for volName := range links {
+				_, err := os.Lstat(path(volName))
+				if isRemoved := os.IsNotExist(err); isRemoved != removed[volName] {
+					t.Fatalf("Test {%s} failed: expected link of {%s} removed {%t} got {%t}",
+						name, volName, removed[volName], isRemoved)
+				}
+			}
+			entries := readAudit(t, dir)
+			if len(entries) != mock.expectedActions || entries[0].Volume != "pvc-9" {
+				t.Fatalf("Test {%s} failed: expected removal of pvc-9 link in audit got %+v", name, entries)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/openebs/csi/pkg/version"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
@@ -64,10 +65,15 @@ func (id *identity) GetPluginInfo(
 	}, nil
 }
 
-// TODO
-// Need to implement this
+// Probe checks if the plugin is ready to serve
+// requests i.e. all its dependencies are usable
 //
-// Probe checks if the plugin is running or not
+// NOTE:
+//  The reason for not being ready is logged by the
+// readiness checker & is also available at the
+// health endpoint. Outcome of the last run of the
+// readiness checks is served, probe never waits for
+// the checks.
 //
 // This implements csi.IdentityServer
 func (id *identity) Probe(
@@ -75,7 +81,10 @@ func (id *identity) Probe(
 	req *csi.ProbeRequest,
 ) (*csi.ProbeResponse, error) {
 
-	return &csi.ProbeResponse{}, nil
+	ready, _ := id.driver.health.Status()
+	return &csi.ProbeResponse{
+		Ready: &wrappers.BoolValue{Value: ready},
+	}, nil
 }
 
 // GetPluginCapabilities returns supported capabilities
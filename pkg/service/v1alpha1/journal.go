@@ -0,0 +1,165 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	iscsi "github.com/openebs/csi/pkg/iscsi/v1alpha1"
+	journal "github.com/openebs/csi/pkg/journal/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	"github.com/openebs/csi/pkg/utils/v1alpha1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// journalBegin records the intent to perform the
+// provided operation against the volume
+func (d *CSIDriver) journalBegin(op journal.Op, vol *apis.CSIVolume) error {
+	if d.journal == nil {
+		return nil
+	}
+	if err := d.journal.Begin(op, vol); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to journal %s of volume {%s}: %v", op, vol.Spec.Volume.Name, err)
+	}
+	return nil
+}
+
+// journalStep records the completion of the provided
+// step of the operation against the volume
+//
+// NOTE:
+//  Failure to record a step is only logged since the
+// replay of an op handles its earlier steps as well
+func (d *CSIDriver) journalStep(op journal.Op, volumeID string, step journal.Step) {
+	if d.journal == nil {
+		return
+	}
+	if err := d.journal.Step(op, volumeID, step); err != nil {
+		log.Warningf("failed to journal step {%s} of %s of volume {%s}: %v",
+			step, op, volumeID, err)
+	}
+}
+
+// journalDone records the completion of the
+// operation against the volume
+func (d *CSIDriver) journalDone(op journal.Op, volumeID string) {
+	if d.journal == nil {
+		return
+	}
+	if err := d.journal.Done(op, volumeID); err != nil {
+		log.Warningf("failed to journal completion of %s of volume {%s}: %v",
+			op, volumeID, err)
+	}
+}
+
+// replayJournal finishes or rolls back the node
+// operations which were interrupted by a crash of
+// the driver
+//
+// NOTE:
+//  This is run before the driver serves any RPC.
+// Operations that fail to replay are left in the
+// journal & are retried on the next start.
+func (d *CSIDriver) replayJournal() {
+	for _, op := range d.journal.Pending() {
+		if op.Volume == nil {
+			continue
+		}
+		volumeID := op.Volume.Spec.Volume.Name
+		d.ownVolume(op)
+
+		log.Infof("journal: replaying %s of volume {%s} interrupted after step {%s}",
+			op.Op, volumeID, op.LastStep)
+
+		var err error
+		switch op.Op {
+		case journal.OpPublish:
+			err = rollbackPublish(op)
+		case journal.OpUnpublish:
+			err = finishUnpublish(op)
+		}
+		if err != nil {
+			log.Errorf("journal: failed to replay %s of volume {%s}: %v",
+				op.Op, volumeID, err)
+			continue
+		}
+		d.journalDone(op.Op, volumeID)
+	}
+}
+
+// ownVolume sets this node as the owner of the volume
+// of the provided operation. Owner node is set only
+// while the CR is created but is needed to find the
+// CR of this node.
+func (d *CSIDriver) ownVolume(op journal.Pending) {
+	op.Volume.Spec.Volume.OwnerNodeID = d.config.NodeID
+}
+
+// pendingOp returns the provided operation against
+// the volume if it is yet to complete
+func (d *CSIDriver) pendingOp(op journal.Op, volumeID string) (journal.Pending, bool) {
+	if d.journal == nil {
+		return journal.Pending{}, false
+	}
+	for _, pending := range d.journal.Pending() {
+		if pending.Op == op && pending.Volume != nil &&
+			pending.Volume.Spec.Volume.Name == volumeID {
+			d.ownVolume(pending)
+			return pending, true
+		}
+	}
+	return journal.Pending{}, false
+}
+
+// rollbackPublish undoes an interrupted publish.
+// Kubelet retries the publish since it never got
+// a response for it.
+func rollbackPublish(op journal.Pending) error {
+	vol := op.Volume
+	if op.LastStep == journal.StepMounted {
+		// publish had completed but for its response,
+		// the volume gets recovered from its CR
+		return nil
+	}
+
+	if op.LastStep != journal.StepBegin {
+		// login or mount may have been done partially
+		// hence cleaning them up is only best effort
+		err := iscsi.UnmountAndDetachDisk(vol, vol.Spec.Volume.MountPath)
+		if err != nil {
+			log.Warningf("journal: failed to unmount volume {%s} from {%s}: %v",
+				vol.Spec.Volume.Name, vol.Spec.Volume.MountPath, err)
+		}
+	}
+	iscsi.ClearCredentials(vol.Spec.Volume.Name)
+	return utils.DeleteCSIVolumeCR(vol)
+}
+
+// finishUnpublish completes an interrupted
+// unpublish
+func finishUnpublish(op journal.Pending) error {
+	vol := op.Volume
+	if op.LastStep == journal.StepBegin {
+		err := iscsi.UnmountAndDetachDisk(vol, vol.Spec.Volume.MountPath)
+		if err != nil {
+			return err
+		}
+	}
+	iscsi.ClearCredentials(vol.Spec.Volume.Name)
+	return utils.DeleteCSIVolumeCR(vol)
+}
@@ -17,29 +17,129 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"time"
+	"fmt"
+	"os"
+	"strings"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	config "github.com/openebs/csi/pkg/config/v1alpha1"
 	iscsi "github.com/openebs/csi/pkg/iscsi/v1alpha1"
+	journal "github.com/openebs/csi/pkg/journal/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	trace "github.com/openebs/csi/pkg/trace/v1alpha1"
 	"github.com/openebs/csi/pkg/utils/v1alpha1"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/kubernetes/pkg/util/mount"
+	"k8s.io/kubernetes/pkg/volume/util/fs"
 )
 
+// nodeFeatureCapabilities maps the feature gates
+// to the node capabilities they enable
+//
+// NOTE:
+//  STAGE_UNSTAGE_VOLUME is never advertised since the
+// volume is logged in, formatted and mounted as part
+// of NodePublishVolume
+var nodeFeatureCapabilities = []struct {
+	feature config.Feature
+	rpc     csi.NodeServiceCapability_RPC_Type
+}{
+	{config.VolumeStats, csi.NodeServiceCapability_RPC_GET_VOLUME_STATS},
+	{config.VolumeExpansion, csi.NodeServiceCapability_RPC_EXPAND_VOLUME},
+	{config.VolumeCondition, csi.NodeServiceCapability_RPC_VOLUME_CONDITION},
+}
+
+// newNodeCapabilities returns a list of this
+// node's capabilities based on the enabled
+// feature gates
+func newNodeCapabilities(c *config.Config) []*csi.NodeServiceCapability {
+	fromType := func(cap csi.NodeServiceCapability_RPC_Type) *csi.NodeServiceCapability {
+		return &csi.NodeServiceCapability{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: cap,
+				},
+			},
+		}
+	}
+
+	var capabilities []*csi.NodeServiceCapability
+	for _, fc := range nodeFeatureCapabilities {
+		if !c.IsFeatureEnabled(fc.feature) {
+			continue
+		}
+		log.Infof("enabling node capability: %s", fc.rpc.String())
+		capabilities = append(capabilities, fromType(fc.rpc))
+	}
+	return capabilities
+}
+
 // node is the server implementation
 // for CSI NodeServer
 type node struct {
-	driver *CSIDriver
+	driver       *CSIDriver
+	capabilities []*csi.NodeServiceCapability
+
+	// mounter is used to verify mount points
+	// while serving volume stats
+	mounter mount.Interface
+
+	// resizeDisk rescans the disk of the volume and
+	// grows the filesystem mounted at the given path
+	resizeDisk func(vol *apis.CSIVolume, path string) error
+
+	// detachDisk unmounts the volume from the given
+	// path and logs out of it
+	detachDisk func(vol *apis.CSIVolume, path string) error
+
+	// pathStates returns the state of every iSCSI
+	// path of the volume
+	pathStates func(vol *apis.CSIVolume) ([]apis.CSIVolumePath, error)
 }
 
 // NewNode returns a new instance
 // of CSI NodeServer
 func NewNode(d *CSIDriver) csi.NodeServer {
 	return &node{
-		driver: d,
+		driver:       d,
+		capabilities: newNodeCapabilities(d.config),
+		mounter:      mount.New(""),
+		resizeDisk:   iscsi.ResizeDisk,
+		detachDisk:   iscsi.UnmountAndDetachDisk,
+		pathStates:   iscsi.PathStates,
+	}
+}
+
+// validateRequest validates if the requested service is
+// supported by this node
+func (ns *node) validateRequest(c csi.NodeServiceCapability_RPC_Type) error {
+	for _, cap := range ns.capabilities {
+		if c == cap.GetRpc().GetType() {
+			return nil
+		}
+	}
+
+	return status.Error(
+		codes.Unimplemented,
+		fmt.Sprintf("failed to validate request: {%s} is not supported", c),
+	)
+}
+
+// waitError returns the grpc error for a failed wait
+// on the volume. DeadlineExceeded or Canceled is
+// returned if the request was done before the volume
+// got ready.
+func waitError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
 	}
+	return status.Error(codes.Internal, err.Error())
 }
 
 // NodePublishVolume publishes (mounts) the volume
@@ -53,7 +153,6 @@ func (ns *node) NodePublishVolume(
 
 	var (
 		err        error
-		reVerified bool
 		devicePath string
 	)
 
@@ -71,59 +170,69 @@ func (ns *node) NodePublishVolume(
 	volumeID := req.GetVolumeId()
 	mountOptions := req.GetVolumeCapability().GetMount().GetMountFlags()
 
+	// Duplicate requests from kubernetes while the mount
+	// is in progress are rejected right away, kubernetes
+	// retries them later
+	if err = ns.driver.lockVolume(volumeID); err != nil {
+		return nil, err
+	}
+	defer ns.driver.unlockVolume(volumeID)
+
+	utils.VolumesListLock.Lock()
+	// Check if the volume has already been published(mounted)
+	if info, ok := utils.Volumes[volumeID]; ok {
+		// Once the devicePath is set implies the volume mount has been
+		// completed, a success response can be sent back
+		if info.Spec.Volume.DevicePath != "" {
+			utils.VolumesListLock.Unlock()
+			return &csi.NodePublishVolumeResponse{}, nil
+		}
+		// Since no other operation is in flight against the volume,
+		// the earlier attempt to publish it has failed & hence it
+		// is retried
+		delete(utils.Volumes, volumeID)
+	}
+	utils.VolumesListLock.Unlock()
+
 	//TODO get this info from our own CRs
+	_, span := trace.Start(ctx, "k8s.GetPersistentVolume")
 	vol, err := utils.GetVolumeDetails(volumeID, mountPath, req.Readonly, mountOptions)
+	trace.End(span, err)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	// iface of the node takes precedence over the one
+	// set by the controller, this gets recorded in the
+	// CSIVolume CR which is used to log out later
+	if iscsi.NodeIface != "" {
+		vol.Spec.ISCSI.IscsiInterface = iscsi.NodeIface
+	}
+	vol.Spec.ISCSI.InitiatorName = iscsi.NodeInitiator
+	vol.Spec.Volume.Pod = utils.PodFromContext(req.GetVolumeContext())
 
 	//Check if volume is ready to serve IOs,
 	//info is fetched from the cstorvolume CR
-	if err := utils.WaitForVolumeToBeReady(volumeID); err != nil {
-		return nil,
-			status.Error(codes.Internal, err.Error())
+	if err := utils.WaitForVolumeToBeReady(ctx, volumeID,
+		utils.DegradedPolicy(vol.Spec.Volume.DegradedPolicy)); err != nil {
+		return nil, waitError(ctx, err)
 	}
 
 	// A temporary TCP connection is made to the volume to check if its
 	// reachable
-	if err := utils.WaitForVolumeToBeReachable(vol.Spec.ISCSI.TargetPortal); err != nil {
-		return nil,
-			status.Error(codes.Internal, err.Error())
+	if err := utils.WaitForVolumeToBeReachable(ctx, vol.Spec.ISCSI.TargetPortal); err != nil {
+		return nil, waitError(ctx, err)
 	}
 
-	// TODO put this tag in a function and defer to unlock in this function
-verifyPublish:
-	utils.VolumesListLock.Lock()
-	// Check if the volume has already been published(mounted) or if the mount
-	// is in progress
-	if info, ok := utils.Volumes[volumeID]; ok {
-		// The volume appears to be present in the inmomory list of volumes
-		// which implies that either the mount operation is complete
-		// or under progress.
-		// Lets verify if the mount is already completed
-		if info.Spec.Volume.DevicePath != "" {
-			// Once the devicePath is set implies the volume mount has been
-			// completed, a success response can be sent back
-			utils.VolumesListLock.Unlock()
-			return &csi.NodePublishVolumeResponse{}, nil
-		}
-		// The mount appears to be under progress lets wait for 13 seconds and
-		// reverify. 13s was decided based on the kubernetes timeout values
-		// which is 15s. Lets reply to kubernetes before it reattempts a
-		// duplicate request
-		utils.VolumesListLock.Unlock()
-		if !reVerified {
-			time.Sleep(utils.VolumeWaitRetryCount * utils.VolumeWaitTimeout * time.Second)
-			reVerified = true
-			goto verifyPublish
-		}
-		// It appears that the mount will still take some more time,
-		// lets convey the same to kubernetes. The message responded will be
-		// added to the app description which has requested this volume
-
-		return nil, status.Error(codes.Internal, "Mount under progress")
+	// Publish is recorded in the journal before any
+	// change is made so that it gets rolled back if
+	// the driver crashes midway
+	if err = ns.driver.journalBegin(journal.OpPublish, vol); err != nil {
+		return nil, err
 	}
+	defer ns.driver.journalDone(journal.OpPublish, volumeID)
 
+	_, span = trace.Start(ctx, "k8s.CreateCSIVolume")
+	utils.VolumesListLock.Lock()
 	// This helps in cases when the node on which the volume was originally
 	// mounted is down. When that node is down, kubelet would not have been able
 	// to trigger an unpublish event on that node due to which when it comes up
@@ -131,6 +240,7 @@ verifyPublish:
 	// for deletion that node will not reattempt to mount this volume again.
 	if err = utils.DeleteOldCSIVolumeCR(vol, ns.driver.config.NodeID); err != nil {
 		utils.VolumesListLock.Unlock()
+		trace.End(span, err)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
@@ -138,12 +248,20 @@ verifyPublish:
 	// the current owner node of the volume and accordingly the target will
 	// allow only that node to login to the volume
 	err = utils.CreateCSIVolumeCR(vol, ns.driver.config.NodeID, mountPath)
+	trace.End(span, err)
 	if err != nil {
 		utils.VolumesListLock.Unlock()
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	utils.Volumes[volumeID] = vol
 	utils.VolumesListLock.Unlock()
+	ns.driver.journalStep(journal.OpPublish, volumeID, journal.StepCRCreated)
+
+	utils.UpdateCSIVolumeStatus(vol,
+		utils.WithPhase(apis.CSIVolumePhaseAttaching),
+		utils.WithCondition(apis.CSIVolumeReady, apis.ConditionTrue,
+			"VolumeReachable", "volume is ready to serve IOs and reachable"),
+	)
 
 	// Permission is changed for the local directory before the volume is
 	// mounted on the node. This helps to resolve cases when the CSI driver
@@ -154,12 +272,24 @@ verifyPublish:
 	// And as soon as it is unmounted permissions change
 	// back to what we are setting over here.
 	if err = utils.ChmodMountPath(vol.Spec.Volume.MountPath); err != nil {
+		ns.abortPublish(ctx, vol, false)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	// CHAP credentials are received via the node publish
+	// secrets of the StorageClass & are written only right
+	// before the login which uses them
+	if err = iscsi.SetCredentials(volumeID, req.GetSecrets()); err != nil {
+		ns.abortPublish(ctx, vol, false)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	// Login to the volume and attempt mount operation on the requested path
-	if devicePath, err = iscsi.AttachAndMountDisk(vol); err != nil {
+	if devicePath, err = iscsi.AttachAndMountDisk(ctx, vol); err != nil {
+		utils.VolumeRefs(vol).Warning("AttachOrMountFailed",
+			"failed to log in to volume {%s} or mount it on node {%s}: %v", volumeID, ns.driver.config.NodeID, err)
+		ns.abortPublish(ctx, vol, true)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	ns.driver.journalStep(journal.OpPublish, volumeID, journal.StepMounted)
 
 	// Setting the devicePath in the volume spec is an indication that the mount
 	// operation for the volume has been completed for the first time. This
@@ -173,9 +303,54 @@ verifyPublish:
 	vol.Spec.Volume.DevicePath = devicePath
 	utils.VolumesListLock.Unlock()
 
+	utils.UpdateCSIVolumeStatus(vol,
+		utils.WithPhase(apis.CSIVolumePhaseMounted),
+		utils.WithCondition(apis.CSIVolumeAttached, apis.ConditionTrue,
+			"LoggedIn", "logged in to the volume at "+devicePath),
+		utils.WithCondition(apis.CSIVolumeMounted, apis.ConditionTrue,
+			"Mounted", "volume is mounted at "+mountPath),
+	)
+
+	ns.driver.monitor.Register(vol)
+	utils.VolumeRefs(vol).Normal("Mounted",
+		"volume {%s} is mounted on node {%s}", volumeID, ns.driver.config.NodeID)
+
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
+// abortPublish undoes a publish of the volume which
+// failed after the CSIVolume CR of this node was
+// created. The CR is deleted so that the retry of
+// the publish by kubelet starts afresh.
+//
+// NOTE:
+//  Login or mount may have been done partially, hence
+// cleaning them up is only best effort
+func (ns *node) abortPublish(ctx context.Context, vol *apis.CSIVolume, isAttached bool) {
+	volumeID := vol.Spec.Volume.Name
+
+	utils.VolumesListLock.Lock()
+	if utils.Volumes[volumeID] == vol {
+		delete(utils.Volumes, volumeID)
+	}
+	utils.VolumesListLock.Unlock()
+
+	if isAttached {
+		if err := iscsi.UnmountAndDetachDisk(vol, vol.Spec.Volume.MountPath); err != nil {
+			log.FromContext(ctx).Warningf("failed to unmount volume {%s} from {%s}: %v",
+				volumeID, vol.Spec.Volume.MountPath, err)
+		}
+	}
+	// CHAP secrets, if any, are not left behind on
+	// the node for a volume which is not published
+	iscsi.ClearCredentials(volumeID)
+	if err := utils.DeleteCSIVolumeCR(vol); err != nil {
+		// CR left behind is deleted by the retry of
+		// the publish before it creates a new one
+		log.FromContext(ctx).Warningf("failed to delete csivolume of volume {%s}: %v", volumeID, err)
+	}
+}
+
 // NodeUnpublishVolume unpublishes (unmounts) the volume
 // from the corresponding node from the given path
 //
@@ -199,16 +374,41 @@ func (ns *node) NodeUnpublishVolume(
 
 	targetPath := req.GetTargetPath()
 	volumeID := req.GetVolumeId()
+
+	if err = ns.driver.lockVolume(volumeID); err != nil {
+		return nil, err
+	}
+	defer ns.driver.unlockVolume(volumeID)
+
 	utils.VolumesListLock.Lock()
 	vol, ok := utils.Volumes[volumeID]
 	if !ok {
 		utils.VolumesListLock.Unlock()
+		// Unpublish which released the volume but failed
+		// to delete its CR is finished by the retry
+		if err = ns.finishPendingUnpublish(volumeID); err != nil {
+			return nil, err
+		}
 		return &csi.NodeUnpublishVolumeResponse{}, nil
 	}
 
 	delete(utils.Volumes, volumeID)
 	utils.VolumesListLock.Unlock()
 
+	// Unpublish is recorded in the journal so that it
+	// gets completed if the driver crashes midway since
+	// the volume is no more present in memory
+	if err = ns.driver.journalBegin(journal.OpUnpublish, vol); err != nil {
+		utils.VolumesListLock.Lock()
+		utils.Volumes[volumeID] = vol
+		utils.VolumesListLock.Unlock()
+		return nil, err
+	}
+
+	// Stop monitoring the volume before unmounting it,
+	// else the monitor would attempt to remount it
+	ns.driver.monitor.Unregister(volumeID)
+
 	// if node driver restarts before this step Kubelet will trigger the
 	// NodeUnpublish command again so there is no need to worry that when this
 	// driver restarts it will pick up the CSIVolume CR and start monitoring
@@ -223,39 +423,77 @@ func (ns *node) NodeUnpublishVolume(
 	// immediately other node deleted this node's CR, in that case iSCSI
 	// target(istgt) will pick up the new one and allow only that node to login,
 	// so all the cases are handled
-	if err = iscsi.UnmountAndDetachDisk(vol, req.GetTargetPath()); err != nil {
-		// TODO If this error occurs then the stale entry will never get deleted
+	utils.UpdateCSIVolumeStatus(vol,
+		utils.WithCondition(apis.CSIVolumeMounted, apis.ConditionFalse,
+			"Unpublishing", "volume is being unmounted from "+targetPath),
+	)
+	if err = ns.detachDisk(vol, req.GetTargetPath()); err != nil {
+		// Volume is remembered so that the retry of the
+		// unpublish by kubelet attempts the unmount again.
+		// Unpublish is left pending in the journal so that
+		// it is completed after a restart of the driver.
+		utils.VolumesListLock.Lock()
+		utils.Volumes[volumeID] = vol
+		utils.VolumesListLock.Unlock()
+		utils.UpdateCSIVolumeStatus(vol,
+			utils.WithError(err),
+			utils.WithCondition(apis.CSIVolumeMounted, apis.ConditionUnknown,
+				"UnmountOrLogoutFailed", err.Error()),
+		)
 		return nil, status.Error(codes.Internal,
 			err.Error())
 	}
 
+	ns.driver.journalStep(journal.OpUnpublish, volumeID, journal.StepUnmounted)
+	iscsi.ClearCredentials(volumeID)
+
 	// It is safe to delete the CSIVolume CR now since the volume has already
-	// been unmounted and logged out
+	// been unmounted and logged out. Unpublish is left pending in the journal
+	// if the deletion fails so that the retry deletes the CR.
 	err = utils.DeleteCSIVolumeCR(vol)
 	if err != nil {
 		return nil, status.Error(codes.Internal,
 			err.Error())
 	}
+	ns.driver.journalDone(journal.OpUnpublish, volumeID)
 
-	logrus.Infof("hostpath: volume %s/%s has been unmounted.",
+	log.FromContext(ctx).Infof("hostpath: volume %s/%s has been unmounted.",
 		targetPath, volumeID)
 
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
-// TODO
-// This needs to be implemented
-//
-// NodeStageVolume mounts the volume on the staging
+// finishPendingUnpublish completes the unpublish of
+// the volume which is no longer tracked but is still
+// pending in the journal i.e. whose CSIVolume CR could
+// not be deleted after the volume was released
+func (ns *node) finishPendingUnpublish(volumeID string) error {
+	op, ok := ns.driver.pendingOp(journal.OpUnpublish, volumeID)
+	if !ok {
+		return nil
+	}
+	if err := finishUnpublish(op); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	ns.driver.journalDone(journal.OpUnpublish, volumeID)
+	return nil
+}
+
+// NodeStageVolume mounts the volume on a staging
 // path
 //
+// NOTE:
+//  iSCSI login and mount of the volume are performed
+// as part of NodePublishVolume, hence staging is not
+// supported
+//
 // This implements csi.NodeServer
 func (ns *node) NodeStageVolume(
 	ctx context.Context,
 	req *csi.NodeStageVolumeRequest,
 ) (*csi.NodeStageVolumeResponse, error) {
 
-	return &csi.NodeStageVolumeResponse{}, nil
+	return nil, ns.validateRequest(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME)
 }
 
 // NodeUnstageVolume unmounts the volume from
@@ -267,7 +505,7 @@ func (ns *node) NodeUnstageVolume(
 	req *csi.NodeUnstageVolumeRequest,
 ) (*csi.NodeUnstageVolumeResponse, error) {
 
-	return &csi.NodeUnstageVolumeResponse{}, nil
+	return nil, ns.validateRequest(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME)
 }
 
 // NodeGetInfo returns node details
@@ -284,9 +522,6 @@ func (ns *node) NodeGetInfo(
 	}, nil
 }
 
-// TODO
-// Verify if this needs to be implemented
-//
 // NodeExpandVolume resizes the filesystem if required
 //
 // If ControllerExpandVolumeResponse returns true in
@@ -300,7 +535,53 @@ func (ns *node) NodeExpandVolume(
 	req *csi.NodeExpandVolumeRequest,
 ) (*csi.NodeExpandVolumeResponse, error) {
 
-	return nil, nil
+	err := ns.validateRequest(csi.NodeServiceCapability_RPC_EXPAND_VOLUME)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.GetVolumeId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument,
+			"Volume ID missing in request")
+	}
+
+	if len(req.GetVolumePath()) == 0 {
+		return nil, status.Error(codes.InvalidArgument,
+			"Volume path missing in request")
+	}
+
+	if err = ns.driver.lockVolume(req.GetVolumeId()); err != nil {
+		return nil, err
+	}
+	defer ns.driver.unlockVolume(req.GetVolumeId())
+
+	utils.VolumesListLock.RLock()
+	vol, ok := utils.Volumes[req.GetVolumeId()]
+	utils.VolumesListLock.RUnlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound,
+			"Volume %s is not published on this node", req.GetVolumeId())
+	}
+
+	// Rescan the iSCSI session so that the new size of
+	// the LUN is visible at the node and then grow the
+	// filesystem
+	if err := ns.resizeDisk(vol, req.GetVolumePath()); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	// Size of the filesystem after the resize is
+	// reported since the requested capacity is
+	// optional and need not match the grown size
+	_, capacity, _, _, _, _, err := fs.FsInfo(req.GetVolumePath())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"failed to get size of volume %s after resize: %v", req.GetVolumeId(), err)
+	}
+
+	return &csi.NodeExpandVolumeResponse{
+		CapacityBytes: capacity,
+	}, nil
 }
 
 // NodeGetCapabilities returns capabilities supported
@@ -313,15 +594,7 @@ func (ns *node) NodeGetCapabilities(
 ) (*csi.NodeGetCapabilitiesResponse, error) {
 
 	return &csi.NodeGetCapabilitiesResponse{
-		Capabilities: []*csi.NodeServiceCapability{
-			{
-				Type: &csi.NodeServiceCapability_Rpc{
-					Rpc: &csi.NodeServiceCapability_RPC{
-						Type: csi.NodeServiceCapability_RPC_UNKNOWN,
-					},
-				},
-			},
-		},
+		Capabilities: ns.capabilities,
 	}, nil
 }
 
@@ -331,8 +604,99 @@ func (ns *node) NodeGetCapabilities(
 // This implements csi.NodeServer
 func (ns *node) NodeGetVolumeStats(
 	ctx context.Context,
-	in *csi.NodeGetVolumeStatsRequest,
+	req *csi.NodeGetVolumeStatsRequest,
 ) (*csi.NodeGetVolumeStatsResponse, error) {
 
-	return nil, status.Error(codes.Unimplemented, "")
+	err := ns.validateRequest(csi.NodeServiceCapability_RPC_GET_VOLUME_STATS)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.GetVolumeId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument,
+			"Volume ID missing in request")
+	}
+
+	volumePath := req.GetVolumePath()
+	if len(volumePath) == 0 {
+		return nil, status.Error(codes.InvalidArgument,
+			"Volume path missing in request")
+	}
+
+	notMnt, err := ns.mounter.IsLikelyNotMountPoint(volumePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, status.Errorf(codes.NotFound,
+				"Volume path %s does not exist", volumePath)
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if notMnt {
+		return nil, status.Errorf(codes.NotFound,
+			"Volume %s is not mounted at %s", req.GetVolumeId(), volumePath)
+	}
+
+	available, capacity, used, inodes, inodesFree, inodesUsed, err := fs.FsInfo(volumePath)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &csi.NodeGetVolumeStatsResponse{
+		Usage: []*csi.VolumeUsage{
+			{
+				Unit:      csi.VolumeUsage_BYTES,
+				Available: available,
+				Total:     capacity,
+				Used:      used,
+			},
+			{
+				Unit:      csi.VolumeUsage_INODES,
+				Available: inodesFree,
+				Total:     inodes,
+				Used:      inodesUsed,
+			},
+		},
+	}
+	if ns.driver.config.IsFeatureEnabled(config.VolumeCondition) {
+		resp.VolumeCondition = ns.volumeCondition(ctx, req.GetVolumeId())
+	}
+	return resp, nil
+}
+
+// volumeCondition returns the condition of the volume
+// as per its iSCSI paths. Volume is abnormal if any
+// of its paths is inactive. Condition is unknown i.e.
+// nil if the volume is not published on this node or
+// its paths can not be listed.
+func (ns *node) volumeCondition(ctx context.Context, volumeID string) *csi.VolumeCondition {
+	utils.VolumesListLock.RLock()
+	vol := utils.Volumes[volumeID]
+	utils.VolumesListLock.RUnlock()
+	if vol == nil {
+		return nil
+	}
+
+	paths, err := ns.pathStates(vol)
+	if err != nil {
+		log.FromContext(ctx).Warningf("failed to get paths of volume {%s}: %v", volumeID, err)
+		return nil
+	}
+
+	var inactive []string
+	for _, path := range paths {
+		if !path.Active {
+			inactive = append(inactive, path.Portal)
+		}
+	}
+	if len(inactive) != 0 {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message: fmt.Sprintf("%d of %d iSCSI paths are inactive: %s",
+				len(inactive), len(paths), strings.Join(inactive, ",")),
+		}
+	}
+	return &csi.VolumeCondition{
+		Message: fmt.Sprintf("all %d iSCSI paths are active", len(paths)),
+	}
 }
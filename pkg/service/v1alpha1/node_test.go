@@ -0,0 +1,791 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	config "github.com/openebs/csi/pkg/config/v1alpha1"
+	client "github.com/openebs/csi/pkg/generated/maya/kubernetes/client/v1alpha1"
+	iscsi "github.com/openebs/csi/pkg/iscsi/v1alpha1"
+	journal "github.com/openebs/csi/pkg/journal/v1alpha1"
+	"github.com/openebs/csi/pkg/utils/v1alpha1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubernetes/pkg/util/mount"
+	"k8s.io/kubernetes/pkg/volume/util/fs"
+)
+
+// csivolumesPath is the path of the CSIVolumes of
+// the openebs namespace served by fakeAPIServer
+const csivolumesPath = "/apis/openebs.io/v1alpha1/namespaces/openebs/csivolumes"
+
+// fakeAPIServer serves the nodes and the CSIVolumes
+// of the openebs namespace the way kubernetes does.
+// A CSIVolume with finalizers is only marked for
+// deletion when it is deleted.
+type fakeAPIServer struct {
+	sync.Mutex
+	csivols map[string]*apis.CSIVolume
+	server  *httptest.Server
+
+	// failDelete fails the deletion of the CSIVolumes
+	failDelete bool
+}
+
+// setFailDelete sets whether the deletion of the
+// CSIVolumes fails
+func (f *fakeAPIServer) setFailDelete(fail bool) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.failDelete = fail
+}
+
+// newFakeAPIServer starts a fakeAPIServer with the
+// given CSIVolumes and points the kubernetes clients
+// of the driver to it, the returned func stops it
+func newFakeAPIServer(t *testing.T, csivols ...*apis.CSIVolume) (*fakeAPIServer, func()) {
+	f := &fakeAPIServer{csivols: map[string]*apis.CSIVolume{}}
+	for _, csivol := range csivols {
+		f.csivols[csivol.Name] = csivol
+	}
+	f.server = httptest.NewServer(f)
+
+	namespace := utils.OpenEBSNamespace
+	master := os.Getenv(string(client.K8sMasterIPEnvironmentKey))
+	utils.OpenEBSNamespace = "openebs"
+	if err := os.Setenv(string(client.K8sMasterIPEnvironmentKey), f.server.URL); err != nil {
+		t.Fatalf("failed to set kubernetes master: %v", err)
+	}
+	return f, func() {
+		f.server.Close()
+		utils.OpenEBSNamespace = namespace
+		_ = os.Setenv(string(client.K8sMasterIPEnvironmentKey), master)
+	}
+}
+
+// fakeCSIVolume returns a CSIVolume of the volume
+// owned by the given node
+func fakeCSIVolume(volName, nodeID string) *apis.CSIVolume {
+	csivol := &apis.CSIVolume{}
+	csivol.Name = volName + "-" + nodeID
+	csivol.Namespace = "openebs"
+	csivol.Labels = map[string]string{"Volname": volName, "nodeID": nodeID}
+	csivol.Finalizers = []string{nodeID}
+	csivol.Spec.Volume.Name = volName
+	csivol.Spec.Volume.OwnerNodeID = nodeID
+	return csivol
+}
+
+// get returns the CSIVolume with the given name
+func (f *fakeAPIServer) get(name string) (*apis.CSIVolume, bool) {
+	f.Lock()
+	defer f.Unlock()
+
+	csivol, ok := f.csivols[name]
+	return csivol, ok
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	reply := func(code int, obj interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(obj)
+	}
+	replyErr := func(err *k8serror.StatusError) {
+		status := err.ErrStatus
+		status.Kind, status.APIVersion = "Status", "v1"
+		reply(int(status.Code), status)
+	}
+	withKind := func(csivol *apis.CSIVolume) *apis.CSIVolume {
+		csivol.Kind, csivol.APIVersion = "CSIVolume", "openebs.io/v1alpha1"
+		return csivol
+	}
+	resource := apis.Resource("csivolumes")
+
+	if strings.HasPrefix(r.URL.Path, "/api/v1/nodes/") {
+		name := strings.TrimPrefix(r.URL.Path, "/api/v1/nodes/")
+		n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID("uid-" + name)}}
+		n.Kind, n.APIVersion = "Node", "v1"
+		reply(http.StatusOK, n)
+		return
+	}
+
+	if r.URL.Path == csivolumesPath {
+		switch r.Method {
+		case http.MethodGet:
+			selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+			if err != nil {
+				replyErr(k8serror.NewBadRequest(err.Error()))
+				return
+			}
+			list := &apis.CSIVolumeList{}
+			list.Kind, list.APIVersion = "CSIVolumeList", "openebs.io/v1alpha1"
+			for _, csivol := range f.csivols {
+				if selector.Matches(labels.Set(csivol.Labels)) {
+					list.Items = append(list.Items, *withKind(csivol.DeepCopy()))
+				}
+			}
+			reply(http.StatusOK, list)
+		case http.MethodPost:
+			csivol := &apis.CSIVolume{}
+			if err := json.NewDecoder(r.Body).Decode(csivol); err != nil {
+				replyErr(k8serror.NewBadRequest(err.Error()))
+				return
+			}
+			if _, ok := f.csivols[csivol.Name]; ok {
+				replyErr(k8serror.NewAlreadyExists(resource, csivol.Name))
+				return
+			}
+			f.csivols[csivol.Name] = csivol
+			reply(http.StatusCreated, withKind(csivol.DeepCopy()))
+		}
+		return
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, csivolumesPath+"/"), "/status")
+	csivol, ok := f.csivols[name]
+	if !ok {
+		replyErr(k8serror.NewNotFound(resource, name))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		reply(http.StatusOK, withKind(csivol.DeepCopy()))
+	case http.MethodPut:
+		updated := &apis.CSIVolume{}
+		if err := json.NewDecoder(r.Body).Decode(updated); err != nil {
+			replyErr(k8serror.NewBadRequest(err.Error()))
+			return
+		}
+		updated.DeletionTimestamp = csivol.DeletionTimestamp
+		if updated.DeletionTimestamp != nil && len(updated.Finalizers) == 0 {
+			delete(f.csivols, name)
+		} else {
+			f.csivols[name] = updated
+		}
+		reply(http.StatusOK, withKind(updated.DeepCopy()))
+	case http.MethodDelete:
+		if f.failDelete {
+			replyErr(k8serror.NewInternalError(fmt.Errorf("etcdserver: request timed out")))
+			return
+		}
+		if len(csivol.Finalizers) == 0 {
+			delete(f.csivols, name)
+		} else if csivol.DeletionTimestamp == nil {
+			now := metav1.Now()
+			csivol.DeletionTimestamp = &now
+		}
+		reply(http.StatusOK, &metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusSuccess,
+		})
+	}
+}
+
+// fakeNode returns a node server with the provided
+// feature gates whose mounter reports mountPath as
+// mounted
+func fakeNode(t *testing.T, gates, mountPath string) *node {
+	c := config.Default()
+	if err := c.SetFeatureGates(gates); err != nil {
+		t.Fatalf("failed to set feature gates {%s}: %v", gates, err)
+	}
+
+	ns := NewNode(&CSIDriver{config: c, locks: utils.NewVolumeLocks()}).(*node)
+	ns.mounter = &mount.FakeMounter{
+		MountPoints: []mount.MountPoint{{Device: "/dev/sdz", Path: mountPath}},
+	}
+	ns.resizeDisk = func(vol *apis.CSIVolume, path string) error { return nil }
+	ns.detachDisk = func(vol *apis.CSIVolume, path string) error { return nil }
+	ns.pathStates = func(vol *apis.CSIVolume) ([]apis.CSIVolumePath, error) { return nil, nil }
+	return ns
+}
+
+// publishFake adds the volume to the list of volumes
+// published on this node, the returned func removes it
+func publishFake(volName, mountPath string) func() {
+	vol := &apis.CSIVolume{}
+	vol.Spec.Volume.Name = volName
+	vol.Spec.Volume.MountPath = mountPath
+
+	utils.VolumesListLock.Lock()
+	utils.Volumes[volName] = vol
+	utils.VolumesListLock.Unlock()
+	return func() {
+		utils.VolumesListLock.Lock()
+		delete(utils.Volumes, volName)
+		utils.VolumesListLock.Unlock()
+	}
+}
+
+func isAdvertised(ns *node, rpc csi.NodeServiceCapability_RPC_Type) bool {
+	resp, _ := ns.NodeGetCapabilities(context.Background(), &csi.NodeGetCapabilitiesRequest{})
+	for _, cap := range resp.GetCapabilities() {
+		if cap.GetRpc().GetType() == rpc {
+			return true
+		}
+	}
+	return false
+}
+
+// callNodeRPC invokes the node RPC corresponding to
+// the capability with a valid request and returns
+// the resulting error
+func callNodeRPC(ns *node, rpc csi.NodeServiceCapability_RPC_Type, path string) error {
+	ctx := context.Background()
+	capability := &csi.VolumeCapability{
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+
+	switch rpc {
+	case csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME:
+		_, err := ns.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+			VolumeId:          "pvc-1",
+			StagingTargetPath: filepath.Join(path, "staging"),
+			VolumeCapability:  capability,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = ns.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{
+			VolumeId:          "pvc-1",
+			StagingTargetPath: filepath.Join(path, "staging"),
+		})
+		return err
+	case csi.NodeServiceCapability_RPC_GET_VOLUME_STATS:
+		resp, err := ns.NodeGetVolumeStats(ctx, &csi.NodeGetVolumeStatsRequest{
+			VolumeId:   "pvc-1",
+			VolumePath: path,
+		})
+		if err == nil && len(resp.GetUsage()) != 2 {
+			return status.Errorf(codes.Internal, "expected 2 usages got %d", len(resp.GetUsage()))
+		}
+		return err
+	case csi.NodeServiceCapability_RPC_EXPAND_VOLUME:
+		defer publishFake("pvc-1", path)()
+		resp, err := ns.NodeExpandVolume(ctx, &csi.NodeExpandVolumeRequest{
+			VolumeId:   "pvc-1",
+			VolumePath: path,
+		})
+		if err == nil && resp.GetCapacityBytes() <= 0 {
+			return status.Errorf(codes.Internal, "expected capacity got %d", resp.GetCapacityBytes())
+		}
+		return err
+	}
+	return status.Errorf(codes.Unknown, "unexpected rpc %s", rpc)
+}
+
+func TestNodeGetCapabilities(t *testing.T) {
+	allRPCs := []csi.NodeServiceCapability_RPC_Type{
+		csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+		csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+	}
+
+	tests := map[string]struct {
+		gates      string
+		advertised map[csi.NodeServiceCapability_RPC_Type]bool
+		condition  bool
+	}{
+		"default feature gates": {
+			gates: "",
+			advertised: map[csi.NodeServiceCapability_RPC_Type]bool{
+				csi.NodeServiceCapability_RPC_GET_VOLUME_STATS: true,
+			},
+		},
+		"all features enabled": {
+			gates: "VolumeStats=true,VolumeExpansion=true,VolumeCondition=true",
+			advertised: map[csi.NodeServiceCapability_RPC_Type]bool{
+				csi.NodeServiceCapability_RPC_GET_VOLUME_STATS: true,
+				csi.NodeServiceCapability_RPC_EXPAND_VOLUME:    true,
+			},
+			condition: true,
+		},
+		"all features disabled": {
+			gates:      "VolumeStats=false,VolumeExpansion=false,VolumeCondition=false",
+			advertised: map[csi.NodeServiceCapability_RPC_Type]bool{},
+		},
+		"only expansion enabled": {
+			gates: "VolumeStats=false,VolumeExpansion=true",
+			advertised: map[csi.NodeServiceCapability_RPC_Type]bool{
+				csi.NodeServiceCapability_RPC_EXPAND_VOLUME: true,
+			},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "csi-node")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			ns := fakeNode(t, mock.gates, dir)
+			if got := isAdvertised(ns, csi.NodeServiceCapability_RPC_VOLUME_CONDITION); got != mock.condition {
+				t.Fatalf("expected volume condition advertised {%t} got {%t}", mock.condition, got)
+			}
+			for _, rpc := range allRPCs {
+				if got := isAdvertised(ns, rpc); got != mock.advertised[rpc] {
+					t.Fatalf("%s: expected advertised {%t} got {%t}", rpc, mock.advertised[rpc], got)
+				}
+
+				err := callNodeRPC(ns, rpc, dir)
+				if mock.advertised[rpc] && err != nil {
+					t.Fatalf("%s: expected advertised rpc to work got error: %v", rpc, err)
+				}
+				if !mock.advertised[rpc] && status.Code(err) != codes.Unimplemented {
+					t.Fatalf("%s: expected unadvertised rpc to be Unimplemented got: %v", rpc, err)
+				}
+			}
+		})
+	}
+}
+
+func TestNodeGetVolumeStatsNotMounted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csi-node")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		path string
+		code codes.Code
+	}{
+		"missing path":     {"", codes.InvalidArgument},
+		"non existing":     {filepath.Join(dir, "missing"), codes.NotFound},
+		"not a mountpoint": {dir, codes.NotFound},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			ns := fakeNode(t, "", "/some/other/path")
+			_, err := ns.NodeGetVolumeStats(context.Background(), &csi.NodeGetVolumeStatsRequest{
+				VolumeId:   "pvc-1",
+				VolumePath: mock.path,
+			})
+			if status.Code(err) != mock.code {
+				t.Fatalf("expected code {%s} got error: %v", mock.code, err)
+			}
+		})
+	}
+}
+
+func TestNodeGetVolumeStatsCondition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csi-node")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		gates     string
+		published bool
+		paths     []apis.CSIVolumePath
+		pathsErr  error
+		expected  *csi.VolumeCondition
+	}{
+		"condition disabled": {
+			gates:     "VolumeCondition=false",
+			published: true,
+			paths:     []apis.CSIVolumePath{{Portal: "10.0.0.1:3260"}},
+		},
+		"volume not published": {
+			gates: "VolumeCondition=true",
+		},
+		"paths can not be listed": {
+			gates:     "VolumeCondition=true",
+			published: true,
+			pathsErr:  fmt.Errorf("no iscsiadm"),
+		},
+		"all paths active": {
+			gates:     "VolumeCondition=true",
+			published: true,
+			paths: []apis.CSIVolumePath{
+				{Portal: "10.0.0.1:3260", Active: true},
+				{Portal: "10.0.0.2:3260", Active: true},
+			},
+			expected: &csi.VolumeCondition{Message: "all 2 iSCSI paths are active"},
+		},
+		"inactive path": {
+			gates:     "VolumeCondition=true",
+			published: true,
+			paths: []apis.CSIVolumePath{
+				{Portal: "10.0.0.1:3260", Active: true},
+				{Portal: "10.0.0.2:3260"},
+			},
+			expected: &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  "1 of 2 iSCSI paths are inactive: 10.0.0.2:3260",
+			},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			if mock.published {
+				defer publishFake("pvc-1", dir)()
+			}
+			ns := fakeNode(t, mock.gates, dir)
+			ns.pathStates = func(vol *apis.CSIVolume) ([]apis.CSIVolumePath, error) {
+				return mock.paths, mock.pathsErr
+			}
+
+			resp, err := ns.NodeGetVolumeStats(context.Background(), &csi.NodeGetVolumeStatsRequest{
+				VolumeId:   "pvc-1",
+				VolumePath: dir,
+			})
+			if err != nil {
+				t.Fatalf("Test {%s} failed: expected no error got: %v", name, err)
+			}
+			if !reflect.DeepEqual(resp.GetVolumeCondition(), mock.expected) {
+				t.Fatalf("Test {%s} failed: expected condition {%v} got {%v}",
+					name, mock.expected, resp.GetVolumeCondition())
+			}
+		})
+	}
+}
+
+func TestNodeExpandVolume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csi-node")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, size, _, _, _, _, err := fs.FsInfo(dir)
+	if err != nil {
+		t.Fatalf("failed to get size of {%s}: %v", dir, err)
+	}
+
+	tests := map[string]struct {
+		published        bool
+		resizeErr        error
+		requiredBytes    int64
+		expectedCode     codes.Code
+		expectedCapacity int64
+	}{
+		"volume not published": {
+			expectedCode: codes.NotFound,
+		},
+		"resize fails": {
+			published:    true,
+			resizeErr:    fmt.Errorf("rescan failed"),
+			expectedCode: codes.Internal,
+		},
+		"resized without required bytes": {
+			published:        true,
+			expectedCode:     codes.OK,
+			expectedCapacity: size,
+		},
+		"resized reports filesystem size": {
+			published:        true,
+			requiredBytes:    1,
+			expectedCode:     codes.OK,
+			expectedCapacity: size,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			ns := fakeNode(t, "VolumeExpansion=true", dir)
+			ns.resizeDisk = func(vol *apis.CSIVolume, path string) error { return mock.resizeErr }
+			if mock.published {
+				defer publishFake("pvc-1", dir)()
+			}
+
+			req := &csi.NodeExpandVolumeRequest{VolumeId: "pvc-1", VolumePath: dir}
+			if mock.requiredBytes != 0 {
+				req.CapacityRange = &csi.CapacityRange{RequiredBytes: mock.requiredBytes}
+			}
+			resp, err := ns.NodeExpandVolume(context.Background(), req)
+			if status.Code(err) != mock.expectedCode {
+				t.Fatalf("Test {%s} failed: expected code {%s} got error: %v", name, mock.expectedCode, err)
+			}
+			if resp.GetCapacityBytes() != mock.expectedCapacity {
+				t.Fatalf("Test {%s} failed: expected capacity {%d} got {%d}",
+					name, mock.expectedCapacity, resp.GetCapacityBytes())
+			}
+		})
+	}
+}
+
+func TestNodeVolumeOperationInFlight(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csi-node")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ns := fakeNode(t, "VolumeExpansion=true", dir)
+	capability := &csi.VolumeCapability{
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+
+	tests := map[string]struct {
+		call func() error
+	}{
+		"publish": {
+			call: func() error {
+				_, err := ns.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+					VolumeId:         "pvc-1",
+					TargetPath:       dir,
+					VolumeCapability: capability,
+				})
+				return err
+			},
+		},
+		"unpublish": {
+			call: func() error {
+				_, err := ns.NodeUnpublishVolume(context.Background(), &csi.NodeUnpublishVolumeRequest{
+					VolumeId:   "pvc-1",
+					TargetPath: dir,
+				})
+				return err
+			},
+		},
+		"expand": {
+			call: func() error {
+				_, err := ns.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+					VolumeId:   "pvc-1",
+					VolumePath: dir,
+				})
+				return err
+			},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			if !ns.driver.locks.TryAcquire("pvc-1") {
+				t.Fatalf("expected lock of pvc-1 to be free")
+			}
+			err := mock.call()
+			ns.driver.locks.Release("pvc-1")
+			if status.Code(err) != codes.Aborted {
+				t.Fatalf("expected code {%s} got error: %v", codes.Aborted, err)
+			}
+		})
+	}
+}
+
+func TestPublishRetryReplacesCSIVolume(t *testing.T) {
+	tests := map[string]struct {
+		csivols []*apis.CSIVolume
+	}{
+		"no csivolume": {},
+		"csivolume left behind by failed publish": {
+			csivols: []*apis.CSIVolume{fakeCSIVolume("pvc-1", "node1")},
+		},
+		"csivolume left behind being deleted": {
+			csivols: func() []*apis.CSIVolume {
+				csivol := fakeCSIVolume("pvc-1", "node1")
+				now := metav1.Now()
+				csivol.DeletionTimestamp = &now
+				return []*apis.CSIVolume{csivol}
+			}(),
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			f, stop := newFakeAPIServer(t, mock.csivols...)
+			defer stop()
+
+			vol := &apis.CSIVolume{}
+			vol.Spec.Volume.Name = "pvc-1"
+			if err := utils.DeleteOldCSIVolumeCR(vol, "node1"); err != nil {
+				t.Fatalf("Test {%s} failed: failed to delete old csivolume: %v", name, err)
+			}
+			if _, ok := f.get("pvc-1-node1"); ok {
+				t.Fatalf("Test {%s} failed: expected csivolume of node1 to be deleted", name)
+			}
+			if err := utils.CreateCSIVolumeCR(vol, "node1", "/mnt/pvc-1"); err != nil {
+				t.Fatalf("Test {%s} failed: failed to create csivolume: %v", name, err)
+			}
+			if _, ok := f.get("pvc-1-node1"); !ok {
+				t.Fatalf("Test {%s} failed: expected csivolume of node1 to be created", name)
+			}
+		})
+	}
+}
+
+func TestNodeUnpublishVolumeJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csi-node")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, stop := newFakeAPIServer(t, fakeCSIVolume("pvc-1", "node1"))
+	defer stop()
+
+	j, err := journal.Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	ns := fakeNode(t, "", dir)
+	ns.driver.config.NodeID = "node1"
+	ns.driver.journal = j
+	ns.driver.monitor = utils.NewMountMonitor(time.Minute, ns.driver.locks, ns.driver.goTask)
+
+	vol := fakeCSIVolume("pvc-1", "node1")
+	vol.Spec.Volume.MountPath = dir
+	vol.Spec.Volume.DevicePath = "/dev/sdz"
+	utils.VolumesListLock.Lock()
+	utils.Volumes["pvc-1"] = vol
+	utils.VolumesListLock.Unlock()
+	defer func() {
+		utils.VolumesListLock.Lock()
+		delete(utils.Volumes, "pvc-1")
+		utils.VolumesListLock.Unlock()
+	}()
+
+	unpublish := func() error {
+		_, err := ns.NodeUnpublishVolume(context.Background(), &csi.NodeUnpublishVolumeRequest{
+			VolumeId:   "pvc-1",
+			TargetPath: dir,
+		})
+		return err
+	}
+
+	// unmount fails, volume is kept for the retry
+	ns.detachDisk = func(vol *apis.CSIVolume, path string) error { return fmt.Errorf("device is busy") }
+	if err := unpublish(); status.Code(err) != codes.Internal {
+		t.Fatalf("expected code {%s} got error: %v", codes.Internal, err)
+	}
+	utils.VolumesListLock.RLock()
+	_, ok := utils.Volumes["pvc-1"]
+	utils.VolumesListLock.RUnlock()
+	if !ok {
+		t.Fatalf("expected volume to be remembered after failed unpublish")
+	}
+	if pending := j.Pending(); len(pending) != 1 || pending[0].Op != journal.OpUnpublish {
+		t.Fatalf("expected unpublish to be pending in journal got %+v", pending)
+	}
+	if _, ok := f.get("pvc-1-node1"); !ok {
+		t.Fatalf("expected csivolume to be present after failed unpublish")
+	}
+
+	// volume is released but its CR is not deleted,
+	// unpublish is kept pending for the retry
+	var detached bool
+	ns.detachDisk = func(vol *apis.CSIVolume, path string) error {
+		detached = true
+		return nil
+	}
+	f.setFailDelete(true)
+	if err := unpublish(); status.Code(err) != codes.Internal {
+		t.Fatalf("expected code {%s} got error: %v", codes.Internal, err)
+	}
+	if !detached {
+		t.Fatalf("expected retry of unpublish to unmount the volume")
+	}
+	if pending := j.Pending(); len(pending) != 1 || pending[0].LastStep != journal.StepUnmounted {
+		t.Fatalf("expected unmounted unpublish to be pending in journal got %+v", pending)
+	}
+	if _, ok := f.get("pvc-1-node1"); !ok {
+		t.Fatalf("expected csivolume to be present after failed deletion")
+	}
+
+	// retry of the unpublish deletes the CR
+	detached = false
+	f.setFailDelete(false)
+	if err := unpublish(); err != nil {
+		t.Fatalf("expected unpublish to succeed got error: %v", err)
+	}
+	if detached {
+		t.Fatalf("expected released volume not to be unmounted again")
+	}
+	if pending := j.Pending(); len(pending) != 0 {
+		t.Fatalf("expected no pending operation in journal got %+v", pending)
+	}
+	if _, ok := f.get("pvc-1-node1"); ok {
+		t.Fatalf("expected csivolume to be deleted after unpublish")
+	}
+}
+
+func TestAbortPublishClearsCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csi-node")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	recordDir := iscsi.RecordDir
+	iscsi.RecordDir = dir
+	defer func() { iscsi.RecordDir = recordDir }()
+
+	f, stop := newFakeAPIServer(t, fakeCSIVolume("pvc-1", "node1"))
+	defer stop()
+
+	ns := fakeNode(t, "", dir)
+	ns.driver.config.NodeID = "node1"
+
+	if err := iscsi.SetCredentials("pvc-1", map[string]string{
+		"node.session.auth.username": "user",
+		"node.session.auth.password": "secret",
+	}); err != nil {
+		t.Fatalf("failed to set credentials: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pvc-1.chap")); err != nil {
+		t.Fatalf("expected credentials to be persisted: %v", err)
+	}
+
+	ns.abortPublish(context.Background(), fakeCSIVolume("pvc-1", "node1"), false)
+	if _, err := os.Stat(filepath.Join(dir, "pvc-1.chap")); !os.IsNotExist(err) {
+		t.Fatalf("expected credentials to be removed after aborted publish got: %v", err)
+	}
+	if _, ok := f.get("pvc-1-node1"); ok {
+		t.Fatalf("expected csivolume to be deleted after aborted publish")
+	}
+}
@@ -0,0 +1,397 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	clientset "github.com/openebs/csi/pkg/generated/clientset/core/internalclientset"
+	informers "github.com/openebs/csi/pkg/generated/informer/core/externalversions"
+	listers "github.com/openebs/csi/pkg/generated/lister/core/v1alpha1"
+	client "github.com/openebs/csi/pkg/generated/maya/kubernetes/client/v1alpha1"
+	iscsi "github.com/openebs/csi/pkg/iscsi/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	"github.com/openebs/csi/pkg/utils/v1alpha1"
+	csivolume "github.com/openebs/csi/pkg/volume/v1alpha1"
+	"golang.org/x/net/context"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// reconcileResyncPeriod is the interval after which
+// all the CSIVolumes of this node are reconciled
+// irrespective of any changes to them
+const reconcileResyncPeriod = 5 * time.Minute
+
+// reconcileRetryInterval is the interval after which
+// a volume whose reconcile failed is reconciled again
+const reconcileRetryInterval = 10 * time.Second
+
+// volumeReconciler watches the CSIVolume CRs of this
+// node and reconciles the mounts and iSCSI sessions
+// of the node against them
+//
+// NOTE:
+//  CSIVolume CR of this node getting deleted while
+// the volume is still published implies that another
+// node has taken over the volume. Such volumes are
+// unmounted & logged out without waiting for kubelet.
+type volumeReconciler struct {
+	sync.Mutex
+
+	driver *CSIDriver
+
+	informer cache.SharedIndexInformer
+	lister   listers.CSIVolumeLister
+
+	// pending holds the names of the volumes
+	// waiting to be reconciled
+	pending map[string]bool
+
+	// wakeup signals the worker that there are
+	// pending volumes
+	wakeup chan struct{}
+
+	// get fetches the CSIVolume with the given name
+	// from kubernetes bypassing the cache
+	get func(name string) (*apis.CSIVolume, error)
+
+	// hasSession returns true if this node has an
+	// iSCSI session to the volume
+	hasSession func(vol *apis.CSIVolume) (bool, error)
+
+	// detach unmounts and logs out of the volume
+	// taken over by another node
+	detach func(vol *apis.CSIVolume) error
+
+	// removeFinalizer removes the finalizer of this
+	// node from the given CSIVolume
+	removeFinalizer func(csivol *apis.CSIVolume) error
+}
+
+// newVolumeReconciler returns a new instance of
+// volumeReconciler that watches the CSIVolumes
+// of this node
+func newVolumeReconciler(d *CSIDriver) (*volumeReconciler, error) {
+	cfg, err := client.GetConfig(client.New())
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		cs,
+		reconcileResyncPeriod,
+		informers.WithNamespace(utils.OpenEBSNamespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = "nodeID=" + d.config.NodeID
+		}),
+	)
+	csivolumes := factory.Openebs().V1alpha1().CSIVolumes()
+
+	r := &volumeReconciler{
+		driver:   d,
+		informer: csivolumes.Informer(),
+		lister:   csivolumes.Lister(),
+		pending:  map[string]bool{},
+		wakeup:   make(chan struct{}, 1),
+		get: func(name string) (*apis.CSIVolume, error) {
+			return csivolume.NewKubeclient().
+				WithNamespace(utils.OpenEBSNamespace).
+				Get(name, metav1.GetOptions{})
+		},
+		hasSession: iscsi.HasSession,
+		detach: func(vol *apis.CSIVolume) error {
+			return iscsi.UnmountAndDetachDisk(vol, vol.Spec.Volume.MountPath)
+		},
+		removeFinalizer: func(csivol *apis.CSIVolume) error {
+			return utils.RemoveCSIVolumeFinalizer(csivol.Name, d.config.NodeID)
+		},
+	}
+
+	r.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    r.enqueue,
+		UpdateFunc: func(old, new interface{}) { r.enqueue(new) },
+		DeleteFunc: r.enqueue,
+	})
+	return r, nil
+}
+
+// enqueue adds the volume of the provided CSIVolume
+// to the pending volumes
+func (r *volumeReconciler) enqueue(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	csivol, ok := obj.(*apis.CSIVolume)
+	if !ok {
+		log.Warningf("reconciler: ignoring unexpected object of type %T", obj)
+		return
+	}
+
+	r.add(csivol.Spec.Volume.Name)
+}
+
+// add adds the volume to the pending volumes
+func (r *volumeReconciler) add(volName string) {
+	r.Lock()
+	r.pending[volName] = true
+	r.Unlock()
+
+	select {
+	case r.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// retry adds the volume to the pending volumes
+// after reconcileRetryInterval
+func (r *volumeReconciler) retry(volName string) {
+	time.AfterFunc(reconcileRetryInterval, func() { r.add(volName) })
+}
+
+// dequeue returns the pending volumes and
+// resets them
+func (r *volumeReconciler) dequeue() []string {
+	r.Lock()
+	defer r.Unlock()
+
+	names := make([]string, 0, len(r.pending))
+	for name := range r.pending {
+		names = append(names, name)
+	}
+	r.pending = map[string]bool{}
+	return names
+}
+
+// Run starts watching the CSIVolumes & reconciles
+// them till the context is done. This should be
+// run as a goroutine.
+func (r *volumeReconciler) Run(ctx context.Context) {
+	go r.informer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), r.informer.HasSynced) {
+		log.Errorf("reconciler: failed to sync csivolume cache")
+		return
+	}
+	log.Infof("reconciler: watching csivolumes of node {%s}", r.driver.config.NodeID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("stopping csivolume reconciler")
+			return
+		case <-r.wakeup:
+			for _, name := range r.dequeue() {
+				if err := r.reconcile(name); err != nil {
+					log.Errorf("reconciler: failed to reconcile volume {%s}: %v", name, err)
+					r.retry(name)
+				}
+			}
+		}
+	}
+}
+
+// reconcile compares the desired state of the volume
+// i.e. its CSIVolume CR against its actual state on
+// this node and fixes the difference
+//
+// NOTE:
+//  Remount of the volume, if required, is started
+// only after the lock of the volume is released since
+// the remount locks the volume once it is ready
+func (r *volumeReconciler) reconcile(volName string) error {
+	// Volumes with an operation in flight are retried
+	// after the operation is likely to be done
+	if !r.driver.locks.TryAcquire(volName) {
+		return fmt.Errorf("an operation for volume {%s} is in progress", volName)
+	}
+	remount, err := r.sync(volName)
+	r.driver.locks.Release(volName)
+	if err != nil || remount == nil {
+		return err
+	}
+	return remount()
+}
+
+// sync fixes the difference between the desired and
+// the actual state of the volume. The returned func,
+// if any, remounts the volume.
+//
+// NOTE:
+//  This should be invoked with the lock of the volume
+// held
+func (r *volumeReconciler) sync(volName string) (func() error, error) {
+	name := volName + "-" + r.driver.config.NodeID
+	csivol, err := r.lister.CSIVolumes(utils.OpenEBSNamespace).Get(name)
+	if err != nil && !k8serror.IsNotFound(err) {
+		return nil, err
+	}
+	isRemoved := err != nil || csivol.DeletionTimestamp != nil
+	if err != nil {
+		csivol = nil
+	}
+
+	utils.VolumesListLock.RLock()
+	vol, ok := utils.Volumes[volName]
+	isPublished := ok && vol.Spec.Volume.DevicePath != ""
+	utils.VolumesListLock.RUnlock()
+
+	// Volumes which are not published or whose publish
+	// is still in progress are owned by NodePublishVolume.
+	// A CR of such a volume which is being deleted has
+	// nothing left on this node to wait for.
+	if !isPublished {
+		if csivol != nil && csivol.DeletionTimestamp != nil {
+			return nil, r.removeFinalizer(csivol)
+		}
+		return nil, nil
+	}
+
+	// Cache may be stale, hence removal of the CR is
+	// confirmed from kubernetes before the volume is
+	// unmounted & logged out
+	if isRemoved {
+		csivol, isRemoved, err = r.confirmRemoved(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if isRemoved {
+		return nil, r.release(vol, csivol)
+	}
+
+	hasSession, err := r.hasSession(vol)
+	if err != nil {
+		return nil, err
+	}
+	if !hasSession {
+		log.Warningf("reconciler: volume {%s} has no iSCSI session: will login again", volName)
+		utils.UpdateCSIVolumeStatus(vol,
+			utils.WithCondition(apis.CSIVolumeAttached, apis.ConditionFalse,
+				"SessionMissing", "node has no iSCSI session to the volume"),
+		)
+		r.driver.monitor.Register(vol)
+		return func() error {
+			r.driver.monitor.Reattach(vol)
+			return nil
+		}, nil
+	}
+
+	r.updatePaths(vol, csivol)
+
+	r.driver.monitor.Register(vol)
+	return func() error {
+		return r.driver.monitor.Verify(vol)
+	}, nil
+}
+
+// confirmRemoved fetches the CSIVolume with the given
+// name from kubernetes and returns true if it has been
+// deleted or is being deleted
+func (r *volumeReconciler) confirmRemoved(name string) (*apis.CSIVolume, bool, error) {
+	csivol, err := r.get(name)
+	if k8serror.IsNotFound(err) {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if csivol.DeletionTimestamp == nil {
+		log.Infof("reconciler: csivolume {%s} is present: ignoring stale cache", name)
+	}
+	return csivol, csivol.DeletionTimestamp != nil, nil
+}
+
+// updatePaths reports the state of the iSCSI paths
+// of the volume in its CSIVolume CR
+//
+// NOTE:
+//  Status is updated only if the paths have changed
+// since every update of the CR triggers reconcile
+func (r *volumeReconciler) updatePaths(vol, csivol *apis.CSIVolume) {
+	paths, err := iscsi.PathStates(vol)
+	if err != nil {
+		log.Warningf("reconciler: failed to get paths of volume {%s}: %v",
+			vol.Spec.Volume.Name, err)
+		return
+	}
+	if reflect.DeepEqual(paths, csivol.Status.Paths) {
+		return
+	}
+
+	for _, path := range paths {
+		if !path.Active {
+			log.Warningf("reconciler: volume {%s} has no session via portal {%s}",
+				vol.Spec.Volume.Name, path.Portal)
+		}
+	}
+	utils.UpdateCSIVolumeStatus(vol, utils.WithPaths(paths))
+}
+
+// release unmounts and logs out of the volume whose
+// CSIVolume CR of this node has been deleted by
+// another node that has taken over the volume. The
+// CR, if still present, is let go once the volume is
+// released.
+//
+// NOTE:
+//  Volume is forgotten only after it is detached so
+// that a failed detach is retried by the next
+// reconcile of the volume
+func (r *volumeReconciler) release(vol, csivol *apis.CSIVolume) error {
+	volName := vol.Spec.Volume.Name
+
+	log.Infof(
+		"reconciler: csivolume of volume {%s} was removed from node {%s}: releasing the volume",
+		volName,
+		r.driver.config.NodeID,
+	)
+
+	// volume is not monitored while being detached
+	// else it gets remounted by the monitor
+	r.driver.monitor.Unregister(volName)
+	if err := r.detach(vol); err != nil {
+		r.driver.monitor.Register(vol)
+		return err
+	}
+	iscsi.ClearCredentials(volName)
+
+	utils.VolumesListLock.Lock()
+	if utils.Volumes[volName] == vol {
+		delete(utils.Volumes, volName)
+	}
+	utils.VolumesListLock.Unlock()
+
+	log.Infof("reconciler: volume {%s} has been unmounted from {%s}",
+		volName, vol.Spec.Volume.MountPath)
+
+	if csivol == nil {
+		return nil
+	}
+	return r.removeFinalizer(csivol)
+}
@@ -0,0 +1,265 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"errors"
+	"testing"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	config "github.com/openebs/csi/pkg/config/v1alpha1"
+	listers "github.com/openebs/csi/pkg/generated/lister/core/v1alpha1"
+	"github.com/openebs/csi/pkg/utils/v1alpha1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestReconcileRelease(t *testing.T) {
+	namespace := utils.OpenEBSNamespace
+	utils.OpenEBSNamespace = "openebs"
+	defer func() { utils.OpenEBSNamespace = namespace }()
+
+	now := metav1.Now()
+	tests := map[string]struct {
+		csivol             *apis.CSIVolume
+		liveCSIVol         *apis.CSIVolume
+		published          bool
+		locked             bool
+		detachErr          error
+		finalizerErr       error
+		isErr              bool
+		expectedDetach     bool
+		expectedFinalizer  bool
+		expectedPublished  bool
+		expectedMonitoring bool
+	}{
+		"csivolume deleted": {
+			published:      true,
+			expectedDetach: true,
+		},
+		"csivolume being deleted": {
+			csivol:            &apis.CSIVolume{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}},
+			published:         true,
+			expectedDetach:    true,
+			expectedFinalizer: true,
+		},
+		"detach fails": {
+			csivol:             &apis.CSIVolume{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}},
+			published:          true,
+			detachErr:          errors.New("device is busy"),
+			isErr:              true,
+			expectedDetach:     true,
+			expectedPublished:  true,
+			expectedMonitoring: true,
+		},
+		"finalizer removal fails": {
+			csivol:            &apis.CSIVolume{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}},
+			published:         true,
+			finalizerErr:      errors.New("conflict"),
+			isErr:             true,
+			expectedDetach:    true,
+			expectedFinalizer: true,
+		},
+		"released volume being deleted": {
+			csivol:            &apis.CSIVolume{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}},
+			expectedFinalizer: true,
+		},
+		"csivolume of volume which is not published": {
+			csivol: &apis.CSIVolume{},
+		},
+		"stale cache": {
+			liveCSIVol:         &apis.CSIVolume{},
+			published:          true,
+			isErr:              true,
+			expectedPublished:  true,
+			expectedMonitoring: true,
+		},
+		"operation in flight": {
+			csivol:             &apis.CSIVolume{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}},
+			published:          true,
+			locked:             true,
+			isErr:              true,
+			expectedPublished:  true,
+			expectedMonitoring: true,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			volName := "pvc-1"
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+				cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if mock.csivol != nil {
+				mock.csivol.Name = volName + "-node1"
+				mock.csivol.Namespace = utils.OpenEBSNamespace
+				mock.csivol.Finalizers = []string{"node1"}
+				if err := indexer.Add(mock.csivol); err != nil {
+					t.Fatalf("failed to add csivolume: %v", err)
+				}
+			}
+
+			c := config.Default()
+			c.NodeID = "node1"
+			locks := utils.NewVolumeLocks()
+			d := &CSIDriver{config: c, locks: locks}
+			d.monitor = utils.NewMountMonitor(c.MountResyncInterval, locks, d.goTask)
+
+			var detached, finalized bool
+			r := &volumeReconciler{
+				driver:  d,
+				lister:  listers.NewCSIVolumeLister(indexer),
+				pending: map[string]bool{},
+				wakeup:  make(chan struct{}, 1),
+				get: func(name string) (*apis.CSIVolume, error) {
+					if mock.liveCSIVol != nil {
+						return mock.liveCSIVol, nil
+					}
+					if mock.csivol != nil {
+						return mock.csivol, nil
+					}
+					return nil, k8serror.NewNotFound(apis.Resource("csivolumes"), name)
+				},
+				hasSession: func(vol *apis.CSIVolume) (bool, error) {
+					return false, errors.New("iscsiadm not found")
+				},
+				detach: func(vol *apis.CSIVolume) error {
+					detached = true
+					return mock.detachErr
+				},
+				removeFinalizer: func(csivol *apis.CSIVolume) error {
+					finalized = true
+					return mock.finalizerErr
+				},
+			}
+
+			if mock.published {
+				vol := &apis.CSIVolume{}
+				vol.Spec.Volume.Name = volName
+				vol.Spec.Volume.DevicePath = "/dev/sdz"
+				utils.VolumesListLock.Lock()
+				utils.Volumes[volName] = vol
+				utils.VolumesListLock.Unlock()
+				d.monitor.Register(vol)
+			}
+			defer func() {
+				utils.VolumesListLock.Lock()
+				delete(utils.Volumes, volName)
+				utils.VolumesListLock.Unlock()
+			}()
+
+			if mock.locked {
+				d.locks.TryAcquire(volName)
+				defer d.locks.Release(volName)
+			}
+
+			err := r.reconcile(volName)
+			if mock.isErr != (err != nil) {
+				t.Fatalf("Test {%s} failed: expected error {%t} got: %v", name, mock.isErr, err)
+			}
+			if detached != mock.expectedDetach {
+				t.Fatalf("Test {%s} failed: expected detach {%t} got {%t}", name, mock.expectedDetach, detached)
+			}
+			if finalized != mock.expectedFinalizer {
+				t.Fatalf("Test {%s} failed: expected finalizer removal {%t} got {%t}",
+					name, mock.expectedFinalizer, finalized)
+			}
+
+			utils.VolumesListLock.RLock()
+			_, published := utils.Volumes[volName]
+			utils.VolumesListLock.RUnlock()
+			if published != mock.expectedPublished {
+				t.Fatalf("Test {%s} failed: expected published {%t} got {%t}",
+					name, mock.expectedPublished, published)
+			}
+			if monitoring := d.monitor.Len() == 1; monitoring != mock.expectedMonitoring {
+				t.Fatalf("Test {%s} failed: expected monitoring {%t} got {%t}",
+					name, mock.expectedMonitoring, monitoring)
+			}
+		})
+	}
+}
+
+func TestReconcileTakeover(t *testing.T) {
+	volName := "pvc-1"
+	f, stop := newFakeAPIServer(t, fakeCSIVolume(volName, "node1"))
+	defer stop()
+
+	// node2 takes over the volume published on node1
+	vol := &apis.CSIVolume{}
+	vol.Spec.Volume.Name = volName
+	if err := utils.DeleteOldCSIVolumeCR(vol, "node2"); err != nil {
+		t.Fatalf("failed to delete csivolume of node1: %v", err)
+	}
+	csivol, ok := f.get(volName + "-node1")
+	if !ok || csivol.DeletionTimestamp == nil {
+		t.Fatalf("expected csivolume of node1 to be marked for deletion")
+	}
+
+	// node1 notices the takeover & releases the volume
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := indexer.Add(csivol.DeepCopy()); err != nil {
+		t.Fatalf("failed to add csivolume: %v", err)
+	}
+
+	c := config.Default()
+	c.NodeID = "node1"
+	locks := utils.NewVolumeLocks()
+	d := &CSIDriver{config: c, locks: locks}
+	d.monitor = utils.NewMountMonitor(c.MountResyncInterval, locks, d.goTask)
+	r, err := newVolumeReconciler(d)
+	if err != nil {
+		t.Fatalf("failed to create reconciler: %v", err)
+	}
+	r.lister = listers.NewCSIVolumeLister(indexer)
+	var detached bool
+	r.detach = func(vol *apis.CSIVolume) error {
+		detached = true
+		return nil
+	}
+
+	published := &apis.CSIVolume{}
+	published.Spec.Volume.Name = volName
+	published.Spec.Volume.DevicePath = "/dev/sdz"
+	utils.VolumesListLock.Lock()
+	utils.Volumes[volName] = published
+	utils.VolumesListLock.Unlock()
+	defer func() {
+		utils.VolumesListLock.Lock()
+		delete(utils.Volumes, volName)
+		utils.VolumesListLock.Unlock()
+	}()
+	d.monitor.Register(published)
+
+	if err := r.reconcile(volName); err != nil {
+		t.Fatalf("failed to reconcile volume: %v", err)
+	}
+	if !detached {
+		t.Fatalf("expected volume to be detached from node1")
+	}
+	if _, ok := f.get(volName + "-node1"); ok {
+		t.Fatalf("expected csivolume of node1 to be deleted once released")
+	}
+	utils.VolumesListLock.RLock()
+	_, ok = utils.Volumes[volName]
+	utils.VolumesListLock.RUnlock()
+	if ok || d.monitor.Len() != 0 {
+		t.Fatalf("expected volume to be forgotten by node1")
+	}
+}
@@ -17,10 +17,30 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"github.com/Sirupsen/logrus"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
 	config "github.com/openebs/csi/pkg/config/v1alpha1"
+	event "github.com/openebs/csi/pkg/event/v1alpha1"
+	health "github.com/openebs/csi/pkg/health/v1alpha1"
+	iscsi "github.com/openebs/csi/pkg/iscsi/v1alpha1"
+	journal "github.com/openebs/csi/pkg/journal/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	metrics "github.com/openebs/csi/pkg/metrics/v1alpha1"
+	trace "github.com/openebs/csi/pkg/trace/v1alpha1"
 	"github.com/openebs/csi/pkg/utils/v1alpha1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/kubernetes/pkg/util/mount"
 )
 
 const (
@@ -30,8 +50,39 @@ const (
 	// This is the canonical, official name of this
 	// plugin
 	Name = "openebs-csi.openebs.io"
+
+	// recoveryRetryInterval is the time to wait before
+	// retrying recovery of volumes published on this
+	// node
+	recoveryRetryInterval = 5 * time.Second
+
+	// healthCheckInterval is the time between two runs
+	// of the readiness checks of the driver
+	healthCheckInterval = 10 * time.Second
+
+	// iscsiRecordDir is the directory within the state
+	// dir that holds the iSCSI config of the volumes
+	// attached to this node
+	iscsiRecordDir = "iscsi"
 )
 
+// requiredBinaries are the filesystem tools needed
+// by the node plugin to format, check and repair
+// volumes of the default filesystem i.e. ext4
+var requiredBinaries = []string{
+	"mkfs.ext4",
+	"fsck",
+	"fsck.ext4",
+}
+
+// xfsBinaries are the filesystem tools needed by
+// the node plugin only if xfs volumes are published
+// on the node
+var xfsBinaries = []string{
+	"mkfs.xfs",
+	"xfs_repair",
+}
+
 // volume can only be published once as
 // read/write on a single node, at any
 // given time
@@ -52,6 +103,53 @@ type CSIDriver struct {
 	cs     csi.ControllerServer
 
 	cap []*csi.VolumeCapability_AccessMode
+
+	// health reports if the dependencies of this
+	// driver are usable
+	health *health.Checker
+
+	// recovered is set once the volumes published
+	// on this node are loaded after a restart
+	recovered health.Flag
+
+	// monitor keeps the volumes published on this
+	// node mounted in their desired mode
+	monitor *utils.MountMonitor
+
+	// reconciler keeps the volumes published on
+	// this node in sync with their CSIVolume CRs
+	reconciler *volumeReconciler
+
+	// locks makes sure only one operation is
+	// performed against a volume at a time
+	locks *utils.VolumeLocks
+
+	// journal records the steps of the node
+	// operations so that they can be finished or
+	// rolled back after a crash
+	journal *journal.Journal
+
+	// ctx is cancelled when the driver stops,
+	// this in turn stops the background tasks
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// tasks tracks the background tasks of the
+	// driver so that they can be waited upon
+	// during shutdown
+	tasks sync.WaitGroup
+
+	// healthServer serves the readiness of this
+	// driver over http
+	healthServer *http.Server
+
+	// metricsServer serves the prometheus metrics
+	// of this driver over http
+	metricsServer *http.Server
+
+	// logLevelServer serves the log level of this
+	// driver over http
+	logLevelServer *http.Server
 }
 
 // GetVolumeCapabilityAccessModes fetches the access
@@ -63,7 +161,7 @@ func GetVolumeCapabilityAccessModes() []*csi.VolumeCapability_AccessMode {
 
 	var vcams []*csi.VolumeCapability_AccessMode
 	for _, vcam := range supported {
-		logrus.Infof("enabling volume access mode: %s", vcam.String())
+		log.Infof("enabling volume access mode: %s", vcam.String())
 		vcams = append(vcams, newVolumeCapabilityAccessMode(vcam))
 	}
 	return vcams
@@ -78,23 +176,81 @@ func New(config *config.Config) *CSIDriver {
 	driver := &CSIDriver{
 		config: config,
 		cap:    GetVolumeCapabilityAccessModes(),
+		health: health.NewChecker(healthCheckInterval),
+		locks:  utils.NewVolumeLocks(),
 	}
+	driver.ctx, driver.cancel = context.WithCancel(context.Background())
+
+	if err := utils.Init(); err != nil {
+		log.Fatalf("failed to initialize driver: %v", err)
+	}
+	utils.VolumeWaitPolicy = config.VolumeWaitPolicy()
+
+	exporter, err := trace.NewExporter(config.TraceExporter, config.TraceEndpoint)
+	if err != nil {
+		log.Fatalf("failed to initialize trace exporter: %v", err)
+	}
+	trace.Init(exporter, "openebs-csi-"+config.PluginType)
 
 	switch config.PluginType {
 	case "controller":
+		if err := event.Init("openebs-csi-controller", config.NodeID); err != nil {
+			log.Warningf("failed to initialize event recorder: %v", err)
+		}
 		driver.cs = NewController(driver)
 
+		driver.health.
+			WithCheck("kubernetes api", utils.VerifyKubernetesAPI).
+			WithCheck("maya apiserver", utils.VerifyMAPIServer)
+
 	case "node":
-		utils.FetchAndUpdateVolInfos(config.NodeID)
+		iscsi.RecordDir = filepath.Join(config.StateDir, iscsiRecordDir)
+		// Events are informational, the driver works
+		// without them
+		if err := event.Init("openebs-csi-node", config.NodeID); err != nil {
+			log.Warningf("failed to initialize event recorder: %v", err)
+		}
+		driver.bindIface()
+		driver.publishInitiator()
+
+		j, err := journal.Open(config.StateDir)
+		if err != nil {
+			log.Fatalf("failed to open journal: %v", err)
+		}
+		driver.journal = j
+		// Half done operations are fixed before the
+		// volumes are recovered from their CRs
+		driver.replayJournal()
 
 		// Start monitor goroutine to monitor the
 		// mounted paths. If a path goes down or
 		// becomes read only (in case of RW mount
 		// points), this thread will fetch the path
 		// and relogin or remount
-		go utils.MonitorMounts()
+		driver.monitor = utils.NewMountMonitor(config.MountResyncInterval, driver.locks, driver.goTask)
+		driver.goTask(driver.monitor.Run)
+
+		driver.goTask(driver.recoverVolumes)
+
+		reconciler, err := newVolumeReconciler(driver)
+		if err != nil {
+			log.Fatalf("failed to initialize csivolume reconciler: %v", err)
+		}
+		driver.reconciler = reconciler
+		driver.goTask(driver.reconciler.Run)
+
+		if config.GCInterval > 0 {
+			driver.goTask(newOrphanCollector(driver).Run)
+		}
 
 		driver.ns = NewNode(driver)
+
+		driver.health.
+			WithCheck("iscsiadm", iscsi.VerifyISCSIAdm).
+			WithCheck("iscsid", iscsi.VerifyISCSID).
+			WithCheck("filesystem tools", health.BinariesPresent(requiredBinaries...)).
+			WithCheck("xfs tools", health.When(isXFSInUse, health.BinariesPresent(xfsBinaries...))).
+			WithCheck("volume recovery", health.Completed(&driver.recovered, "recovery of published volumes"))
 	}
 
 	// Identity server is common to both node and
@@ -102,17 +258,301 @@ func New(config *config.Config) *CSIDriver {
 	// share capabilities and probe the corresponding
 	// driver
 	driver.ids = NewIdentity(driver)
+	driver.goTask(driver.health.Run)
 	return driver
 }
 
+// bindIface creates the iSCSI iface of this node
+// which binds the iSCSI traffic to the configured
+// network interface
+func (d *CSIDriver) bindIface() {
+	configured := iscsi.Iface{
+		Name:      d.config.ISCSIIface,
+		NetDev:    d.config.ISCSIIfaceNetdev,
+		HWAddress: d.config.ISCSIIfaceHWAddress,
+	}
+	iface, err := utils.ResolveIface(configured, d.config.NodeID)
+	if err != nil {
+		log.Fatalf("failed to resolve iSCSI iface of node {%s}: %v", d.config.NodeID, err)
+	}
+	// Volumes are not logged in through an iface
+	// other than the one asked for, hence failing
+	// to create it is fatal
+	if err := iscsi.EnsureIface(iface); err != nil {
+		log.Fatalf("failed to create iSCSI iface {%s}: %v", iface.Name, err)
+	}
+	if iface.IsDefault() {
+		return
+	}
+	log.Infof("binding iSCSI sessions to iface {%s} netdev {%s} hwaddress {%s}", iface.Name, iface.NetDev, iface.HWAddress)
+	iscsi.NodeIface = iface.Name
+}
+
+// publishInitiator reads the initiator IQN of this
+// node and publishes it in the annotations of the
+// node. The IQN is informational only, hence the
+// failures are logged and the driver starts anyway.
+func (d *CSIDriver) publishInitiator() {
+	iqn, err := iscsi.ReadInitiatorName()
+	if err != nil {
+		log.Warningf("failed to read initiator of node {%s}: %v", d.config.NodeID, err)
+		return
+	}
+	iscsi.NodeInitiator = iqn
+	if err := utils.AnnotateInitiator(d.config.NodeID, iqn); err != nil {
+		log.Warningf("failed to publish initiator {%s} of node {%s}: %v", iqn, d.config.NodeID, err)
+		return
+	}
+	log.Infof("node {%s} published with initiator {%s}", d.config.NodeID, iqn)
+}
+
+// goTask runs the provided background task as a
+// goroutine. The task is expected to return once
+// the provided context is done.
+func (d *CSIDriver) goTask(task func(ctx context.Context)) {
+	d.tasks.Add(1)
+	go func() {
+		defer d.tasks.Done()
+		task(d.ctx)
+	}()
+}
+
+// recoverVolumes loads the volumes published on
+// this node from their CSIVolume CRs. This keeps
+// retrying till the volumes get loaded or the
+// context is done
+func (d *CSIDriver) recoverVolumes(ctx context.Context) {
+	for {
+		err := utils.FetchAndUpdateVolInfos(d.config.NodeID)
+		if err == nil {
+			d.migrateISCSIRecords()
+			d.monitorRecoveredVolumes()
+			d.recovered.Set()
+			return
+		}
+
+		log.Errorf(
+			"failed to recover volumes published on node {%s}: will retry: %v",
+			d.config.NodeID,
+			err,
+		)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(recoveryRetryInterval):
+		}
+	}
+}
+
+// migrateISCSIRecords moves the iSCSI config of the
+// recovered volumes, persisted by older versions in
+// the target path, to the state dir
+func (d *CSIDriver) migrateISCSIRecords() {
+	utils.VolumesListLock.RLock()
+	vols := make([]*apis.CSIVolume, 0, len(utils.Volumes))
+	for _, vol := range utils.Volumes {
+		vols = append(vols, vol)
+	}
+	utils.VolumesListLock.RUnlock()
+
+	if err := iscsi.MigrateRecords(mount.New(""), vols); err != nil {
+		log.Errorf("failed to migrate iSCSI records to {%s}: %v", iscsi.RecordDir, err)
+	}
+}
+
+// monitorRecoveredVolumes registers the recovered
+// volumes, whose mount has completed, with the
+// mount monitor
+func (d *CSIDriver) monitorRecoveredVolumes() {
+	utils.VolumesListLock.RLock()
+	defer utils.VolumesListLock.RUnlock()
+
+	for _, vol := range utils.Volumes {
+		if vol.Spec.Volume.DevicePath == "" {
+			// If device path is not set implies the node publish
+			// operation was not completed
+			continue
+		}
+		d.monitor.Register(vol)
+	}
+}
+
+// isXFSInUse returns true if any volume published
+// on this node is formatted as xfs
+func isXFSInUse() bool {
+	utils.VolumesListLock.RLock()
+	defer utils.VolumesListLock.RUnlock()
+
+	for _, vol := range utils.Volumes {
+		if vol.Spec.Volume.FSType == "xfs" {
+			return true
+		}
+	}
+	return false
+}
+
+// lockVolume acquires the operation lock of the
+// volume. Aborted is returned if another operation
+// is already in flight against the volume.
+func (d *CSIDriver) lockVolume(volumeID string) error {
+	if !d.locks.TryAcquire(volumeID) {
+		return status.Errorf(
+			codes.Aborted,
+			"an operation is already in progress for volume {%s}",
+			volumeID,
+		)
+	}
+	return nil
+}
+
+// unlockVolume releases the operation lock of
+// the volume
+func (d *CSIDriver) unlockVolume(volumeID string) {
+	d.locks.Release(volumeID)
+}
+
+// serveHealth exposes the readiness of this driver
+// over http at the configured address
+func (d *CSIDriver) serveHealth() {
+	log.Infof("serving health at {%s}", d.config.HealthAddress)
+	err := d.healthServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Errorf("failed to serve health at {%s}: %v", d.config.HealthAddress, err)
+	}
+}
+
+// serveMetrics exposes the metrics of this driver
+// over http at the configured address
+func (d *CSIDriver) serveMetrics() {
+	log.Infof("serving metrics at {%s}", d.config.MetricsAddress)
+	err := d.metricsServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Errorf("failed to serve metrics at {%s}: %v", d.config.MetricsAddress, err)
+	}
+}
+
+// serveLogLevel exposes the log level of this
+// driver over http at the configured address
+func (d *CSIDriver) serveLogLevel() {
+	log.Infof("serving log level at {%s}", d.config.LogLevelAddress)
+	err := d.logLevelServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Errorf("failed to serve log level at {%s}: %v", d.config.LogLevelAddress, err)
+	}
+}
+
+// registerVolumeMetrics exports the health of the
+// volumes from the controller, which can list all the
+// cstor volumes, and the usage of the volumes from
+// the node where they are mounted
+func (d *CSIDriver) registerVolumeMetrics() {
+	switch d.config.PluginType {
+	case "controller":
+		metrics.Registry.MustRegister(metrics.NewVolumeHealthCollector(utils.ListVolumeHealth))
+	case "node":
+		metrics.Registry.MustRegister(metrics.NewVolumeUsageCollector(d.monitor.Usage))
+	}
+}
+
 // Run starts the CSI plugin by communicating
-// over the given endpoint
+// over the given endpoint. This blocks till the
+// driver receives SIGTERM or SIGINT and then stops
+// the driver gracefully.
 func (d *CSIDriver) Run() error {
+	if d.config.HealthAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", d.health)
+		d.healthServer = &http.Server{Addr: d.config.HealthAddress, Handler: mux}
+
+		go d.serveHealth()
+	}
+
+	if d.config.MetricsAddress != "" {
+		mux := http.NewServeMux()
+		d.registerVolumeMetrics()
+		mux.Handle("/metrics", metrics.Handler())
+		d.metricsServer = &http.Server{Addr: d.config.MetricsAddress, Handler: mux}
+
+		go d.serveMetrics()
+	}
+
+	if d.config.LogLevelAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/loglevel", log.LevelHandler())
+		d.logLevelServer = &http.Server{Addr: d.config.LogLevelAddress, Handler: mux}
+
+		go d.serveLogLevel()
+	}
+
 	// Initialize and start listening on grpc server
 	s := utils.NewNonBlockingGRPCServer()
 
 	s.Start(d.config.Endpoint, d.ids, d.cs, d.ns)
-	s.Wait()
 
-	return nil
+	stopped := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(stopped)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	// Driver exits with an error if the grpc server
+	// stops by itself so that the restart of the
+	// driver is not mistaken for a clean shutdown
+	var err error
+	select {
+	case sig := <-signals:
+		log.Infof("received signal {%v}: stopping driver", sig)
+	case <-stopped:
+		err = fmt.Errorf("grpc server stopped unexpectedly")
+		log.Errorf("%v: stopping driver", err)
+	}
+
+	d.stop(s)
+	return err
+}
+
+// stop stops accepting new requests and waits for
+// the in flight requests to complete within the
+// shutdown grace period. Background tasks are
+// stopped after that.
+func (d *CSIDriver) stop(s utils.NonBlockingGRPCServer) {
+	done := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Infof("in flight requests completed")
+	case <-time.After(d.config.ShutdownGracePeriod):
+		log.Warningf(
+			"in flight requests did not complete within %v: cancelling them",
+			d.config.ShutdownGracePeriod,
+		)
+		s.ForceStop()
+	}
+
+	if d.healthServer != nil {
+		_ = d.healthServer.Close()
+	}
+	if d.metricsServer != nil {
+		_ = d.metricsServer.Close()
+	}
+	if d.logLevelServer != nil {
+		_ = d.logLevelServer.Close()
+	}
+
+	// stop the background tasks e.g. mount monitor
+	d.cancel()
+	d.tasks.Wait()
+
+	// pending spans are flushed once no more
+	// requests are served
+	trace.Shutdown()
+	log.Infof("driver stopped")
 }
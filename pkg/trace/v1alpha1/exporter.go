@@ -0,0 +1,173 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/net/context"
+)
+
+// Exporters supported by this driver
+const (
+	// ExporterNone disables tracing
+	ExporterNone = "none"
+
+	// ExporterOTLP sends the spans to an OTLP/HTTP
+	// endpoint e.g. of an OpenTelemetry collector
+	ExporterOTLP = "otlp"
+
+	// ExporterStdout writes the spans as json lines
+	// to the standard output
+	ExporterStdout = "stdout"
+
+	// ExporterFile writes the spans as json lines to
+	// a file
+	ExporterFile = "file"
+)
+
+const (
+	// otlpTracesPath is the path of the traces
+	// endpoint of OTLP/HTTP
+	otlpTracesPath = "/v1/traces"
+
+	// shutdownTimeout is the max time to send the
+	// pending spans on shutdown
+	shutdownTimeout = 10 * time.Second
+)
+
+var (
+	lock sync.Mutex
+
+	// provider batches the spans of this driver and
+	// sends them to the configured exporter, it is
+	// nil if tracing is disabled
+	provider *sdktrace.TracerProvider
+)
+
+// NewExporter returns the exporter of the given kind
+// sending the spans to the given endpoint i.e. the
+// OTLP url or the path of the file. The exporter is
+// nil if tracing is disabled.
+func NewExporter(kind, endpoint string) (sdktrace.SpanExporter, error) {
+	switch kind {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		if endpoint == "" {
+			return nil, fmt.Errorf("path of the file is required for trace exporter {%s}", kind)
+		}
+		f, err := os.OpenFile(endpoint, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &fileExporter{SpanExporter: e, f: f}, nil
+	case ExporterOTLP:
+		if endpoint == "" {
+			return nil, fmt.Errorf("endpoint is required for trace exporter {%s}", kind)
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint {%s} of trace exporter {%s}", endpoint, kind)
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		if !strings.HasSuffix(u.Path, otlpTracesPath) {
+			u.Path += otlpTracesPath
+		}
+		return otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(u.String()))
+	}
+	return nil, fmt.Errorf(
+		"invalid trace exporter {%s}: should be one of %s, %s, %s or %s",
+		kind, ExporterNone, ExporterOTLP, ExporterStdout, ExporterFile,
+	)
+}
+
+// fileExporter closes the file the spans are written
+// to once it is shut down
+type fileExporter struct {
+	sdktrace.SpanExporter
+	f *os.File
+}
+
+// Shutdown implements sdktrace.SpanExporter
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if cerr := e.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Init enables tracing of the given service with the
+// given exporter, tracing is disabled if the exporter
+// is nil
+func Init(e sdktrace.SpanExporter, service string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if e == nil {
+		provider = nil
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return
+	}
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(e),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(service),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+}
+
+// Shutdown disables tracing and flushes the spans
+// pending with the exporter
+func Shutdown() {
+	lock.Lock()
+	p := provider
+	lock.Unlock()
+
+	Init(nil, "")
+	if p == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		log.Warningf("failed to flush pending spans: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// tracerName is the name of the instrumentation
+// scope of the spans of this driver
+const tracerName = "github.com/openebs/csi"
+
+// propagator propagates the trace of a request across
+// processes as per the W3C trace context
+var propagator = propagation.TraceContext{}
+
+// Start starts a span with the given name as a child
+// of the span in the given context. The span does not
+// record anything if tracing is disabled.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End ends the given span which failed if err is not
+// nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceID returns the id of the trace of the given
+// context, it is empty if the context is not traced
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// metadataCarrier adapts the gRPC metadata to carry
+// the trace context
+type metadataCarrier metadata.MD
+
+// Get implements propagation.TextMapCarrier
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Set implements propagation.TextMapCarrier
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// Keys implements propagation.TextMapCarrier
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Extract returns a context with the trace propagated
+// in the metadata of the incoming gRPC request
+func Extract(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return propagator.Extract(ctx, metadataCarrier(md))
+}
+
+// Inject propagates the trace of the given context in
+// the headers of an outgoing http request
+func Inject(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
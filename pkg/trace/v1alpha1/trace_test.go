@@ -0,0 +1,204 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestNewExporter(t *testing.T) {
+	tests := map[string]struct {
+		kind       string
+		endpoint   string
+		isDisabled bool
+		isErr      bool
+	}{
+		"disabled":              {isDisabled: true},
+		"none":                  {kind: ExporterNone, isDisabled: true},
+		"stdout":                {kind: ExporterStdout},
+		"otlp":                  {kind: ExporterOTLP, endpoint: "http://otel-collector:4318"},
+		"otlp without endpoint": {kind: ExporterOTLP, isErr: true},
+		"otlp without host":     {kind: ExporterOTLP, endpoint: "otel-collector", isErr: true},
+		"file without path":     {kind: ExporterFile, isErr: true},
+		"invalid":               {kind: "jaeger", isErr: true},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			e, err := NewExporter(mock.kind, mock.endpoint)
+			if mock.isErr != (err != nil) {
+				t.Fatalf("Test {%s} failed: expected error {%t} got {%v}", name, mock.isErr, err)
+			}
+			if err == nil && mock.isDisabled != (e == nil) {
+				t.Fatalf("Test {%s} failed: expected disabled {%t} got exporter {%v}", name, mock.isDisabled, e)
+			}
+		})
+	}
+}
+
+func TestSpans(t *testing.T) {
+	defer Shutdown()
+
+	// spans do not record anything if tracing is
+	// disabled
+	Init(nil, "test")
+	_, span := Start(context.Background(), "disabled")
+	if span.IsRecording() {
+		t.Fatalf("Test {disabled} failed: expected span which does not record")
+	}
+	End(span, nil)
+
+	exporter := tracetest.NewInMemoryExporter()
+	Init(exporter, "test")
+
+	// trace of the incoming request is continued
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("traceparent", traceparent))
+	ctx, server := Start(Extract(ctx), "NodePublishVolume", trace.WithSpanKind(trace.SpanKindServer))
+	_, child := Start(ctx, "iscsi.login")
+	child.SetAttributes(attribute.String("iscsi.portal", "10.0.0.1:3260"))
+	End(child, errors.New("login failed"))
+	End(server, nil)
+
+	sc := server.SpanContext()
+	if sc.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("Test {extract} failed: expected trace of the request got {%s}", sc.TraceID())
+	}
+	if TraceID(ctx) != sc.TraceID().String() {
+		t.Fatalf("Test {trace id} failed: expected {%s} got {%s}", sc.TraceID(), TraceID(ctx))
+	}
+
+	// trace is propagated to outgoing requests
+	header := http.Header{}
+	Inject(ctx, header)
+	expected := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-01"
+	if header.Get("traceparent") != expected {
+		t.Fatalf("Test {inject} failed: expected {%s} got {%s}", expected, header.Get("traceparent"))
+	}
+
+	// spans are exported once flushed, the in memory
+	// exporter forgets them on shutdown
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Test {export} failed: %v", err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Test {export} failed: expected 2 spans got {%d}", len(spans))
+	}
+	login := spans[0]
+	if login.Name != "iscsi.login" || login.Parent.SpanID() != sc.SpanID() {
+		t.Fatalf("Test {child} failed: expected child of {%s} got {%s} of {%s}", sc.SpanID(), login.Name, login.Parent.SpanID())
+	}
+	if login.Status.Code != codes.Error || login.Status.Description != "login failed" {
+		t.Fatalf("Test {error} failed: unexpected status {%+v}", login.Status)
+	}
+	if spans[1].Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("Test {extract} failed: expected parent span of the request got {%s}", spans[1].Parent.SpanID())
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var got coltracepb.ExportTraceServiceRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpTracesPath {
+			t.Errorf("Test {otlp} failed: expected path {%s} got {%s}", otlpTracesPath, r.URL.Path)
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			err = proto.Unmarshal(body, &got)
+		}
+		if err != nil {
+			t.Errorf("Test {otlp} failed: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer srv.Close()
+
+	exporter, err := NewExporter(ExporterOTLP, srv.URL)
+	if err != nil {
+		t.Fatalf("Test {otlp} failed: %v", err)
+	}
+	Init(exporter, "openebs-csi-node")
+	_, span := Start(context.Background(), "maya.create", trace.WithSpanKind(trace.SpanKindClient))
+	End(span, errors.New("timeout"))
+	// pending spans are sent on shutdown
+	Shutdown()
+
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("Test {otlp} failed: unexpected request {%v}", &got)
+	}
+	rs := got.ResourceSpans[0]
+	var service string
+	for _, attr := range rs.Resource.Attributes {
+		if attr.Key == "service.name" {
+			service = attr.Value.GetStringValue()
+		}
+	}
+	if service != "openebs-csi-node" {
+		t.Fatalf("Test {otlp} failed: unexpected resource {%v}", rs.Resource)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 1 || spans[0].Name != "maya.create" {
+		t.Fatalf("Test {otlp} failed: unexpected spans {%v}", spans)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans.json")
+
+	exporter, err := NewExporter(ExporterFile, path)
+	if err != nil {
+		t.Fatalf("Test {file} failed: %v", err)
+	}
+	Init(exporter, "openebs-csi-node")
+	_, span := Start(context.Background(), "FormatAndMount")
+	End(span, nil)
+	Shutdown()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Test {file} failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"Name":"FormatAndMount"`) {
+		t.Fatalf("Test {file} failed: expected 1 span got:\n%s", data)
+	}
+}
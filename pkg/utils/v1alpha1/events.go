@@ -0,0 +1,70 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strings"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	event "github.com/openebs/csi/pkg/event/v1alpha1"
+)
+
+const (
+	// podNameKey & podNamespaceKey are the keys of
+	// the consuming pod in the volume context of node
+	// publish requests
+	//
+	// NOTE:
+	//  These are set by kubelet only if the CSIDriver
+	// object of this driver enables pod info on mount
+	podNameKey      = "csi.storage.k8s.io/pod.name"
+	podNamespaceKey = "csi.storage.k8s.io/pod.namespace"
+)
+
+// PodFromContext returns the pod consuming the volume
+// as namespace/name from the given volume context of
+// a node publish request
+func PodFromContext(volumeContext map[string]string) string {
+	name, namespace := volumeContext[podNameKey], volumeContext[podNamespaceKey]
+	if name == "" || namespace == "" {
+		return ""
+	}
+	return namespace + "/" + name
+}
+
+// splitKey splits the given namespace/name key
+func splitKey(key string) (namespace, name string) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// VolumeRefs returns the objects against which the
+// events of the given volume are recorded i.e. the
+// PV, its PVC & the pod consuming it
+func VolumeRefs(vol *apis.CSIVolume) event.Refs {
+	refs := event.Refs{event.PersistentVolume(vol.Spec.Volume.Name)}
+	if pvc := event.PersistentVolumeClaim(splitKey(vol.Spec.Volume.PersistentVolumeClaim)); pvc != nil {
+		refs = append(refs, pvc)
+	}
+	if pod := event.Pod(splitKey(vol.Spec.Volume.Pod)); pod != nil {
+		refs = append(refs, pod)
+	}
+	return refs
+}
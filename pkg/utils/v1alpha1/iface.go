@@ -0,0 +1,64 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	iscsi "github.com/openebs/csi/pkg/iscsi/v1alpha1"
+)
+
+const (
+	// IfaceLabelKey is the label of the node which
+	// sets the name of the iSCSI iface of the node
+	IfaceLabelKey = "openebs.io/iscsi-iface"
+
+	// IfaceNetdevLabelKey is the label of the node
+	// which binds the iSCSI iface to a netdev
+	IfaceNetdevLabelKey = "openebs.io/iscsi-iface-netdev"
+
+	// IfaceHWAddressLabelKey is the label of the node
+	// which binds the iSCSI iface to a hardware address
+	//
+	// NOTE:
+	//  Label values can not have colons, hence the
+	// address is expected to be dash separated
+	// e.g. 00-1b-21-aa-bb-cc
+	IfaceHWAddressLabelKey = "openebs.io/iscsi-iface-hwaddress"
+)
+
+// ResolveIface returns the iSCSI iface of this node.
+// The configured iface takes precedence over the one
+// set in the labels of the node.
+func ResolveIface(configured iscsi.Iface, nodeID string) (iscsi.Iface, error) {
+	if !configured.IsDefault() {
+		return configured, nil
+	}
+	node, err := getNodeDetails(nodeID)
+	if err != nil {
+		return iscsi.Iface{}, err
+	}
+	return ifaceFromLabels(node.Labels), nil
+}
+
+// ifaceFromLabels returns the iSCSI iface set in
+// the given node labels
+func ifaceFromLabels(labels map[string]string) iscsi.Iface {
+	return iscsi.Iface{
+		Name:      labels[IfaceLabelKey],
+		NetDev:    labels[IfaceNetdevLabelKey],
+		HWAddress: labels[IfaceHWAddressLabelKey],
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+
+	client "github.com/openebs/csi/pkg/generated/maya/kubernetes/client/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// InitiatorAnnotationKey is the annotation of the
+// node which holds its iSCSI initiator IQN
+//
+// NOTE:
+//  The IQN can not be a label value as it may have
+// colons in it
+const InitiatorAnnotationKey = "openebs.io/iscsi-initiator"
+
+// annotationsPatch returns a merge patch which sets
+// the given annotation
+func annotationsPatch(key, value string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				key: value,
+			},
+		},
+	})
+}
+
+// AnnotateInitiator sets the iSCSI initiator IQN
+// in the annotations of the given node
+func AnnotateInitiator(nodeID, iqn string) error {
+	node, err := getNodeDetails(nodeID)
+	if err != nil {
+		return err
+	}
+	if node.Annotations[InitiatorAnnotationKey] == iqn {
+		return nil
+	}
+
+	data, err := annotationsPatch(InitiatorAnnotationKey, iqn)
+	if err != nil {
+		return err
+	}
+	cs, err := client.New().Clientset()
+	if err != nil {
+		return err
+	}
+	_, err = cs.CoreV1().Nodes().Patch(nodeID, types.MergePatchType, data)
+	return err
+}
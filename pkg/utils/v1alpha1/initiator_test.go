@@ -0,0 +1,46 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+)
+
+func TestAnnotationsPatch(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected string
+	}{
+		"set annotation": {
+			value:    "iqn.1993-08.org.debian:01:abcdef",
+			expected: `{"metadata":{"annotations":{"openebs.io/iscsi-initiator":"iqn.1993-08.org.debian:01:abcdef"}}}`,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			data, err := annotationsPatch(InitiatorAnnotationKey, mock.value)
+			if err != nil {
+				t.Fatalf("Test {%s} failed: %v", name, err)
+			}
+			if string(data) != mock.expected {
+				t.Fatalf("Test {%s} failed: expected {%s} got {%s}", name, mock.expected, string(data))
+			}
+		})
+	}
+}
@@ -16,16 +16,32 @@ package utils
 
 import (
 	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	apismaya "github.com/openebs/csi/pkg/apis/openebs.io/maya/v1alpha1"
 	csv "github.com/openebs/csi/pkg/generated/maya/cstorvolume/v1alpha1"
 	errors "github.com/openebs/csi/pkg/generated/maya/errors/v1alpha1"
+	client "github.com/openebs/csi/pkg/generated/maya/kubernetes/client/v1alpha1"
 	node "github.com/openebs/csi/pkg/generated/maya/kubernetes/node/v1alpha1"
 	pv "github.com/openebs/csi/pkg/generated/maya/kubernetes/persistentvolume/v1alpha1"
 	csivolume "github.com/openebs/csi/pkg/volume/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
 )
 
+// VerifyKubernetesAPI checks if the kubernetes API
+// server is reachable
+func VerifyKubernetesAPI() error {
+	cs, err := client.New().Clientset()
+	if err != nil {
+		return err
+	}
+
+	_, err = cs.Discovery().ServerVersion()
+	return err
+}
+
 // getNodeDetails fetches the nodeInfo for the current node
 func getNodeDetails(name string) (*corev1.Node, error) {
 	return node.NewKubeClient().Get(name, metav1.GetOptions{})
@@ -36,27 +52,28 @@ func FetchPVDetails(name string) (*corev1.PersistentVolume, error) {
 	return pv.NewKubeClient().Get(name, metav1.GetOptions{})
 }
 
-// getVolStatus fetches the current VolumeStatus which specifies if the volume
-// is ready to serve IOs
-func getVolStatus(volumeID string) (string, error) {
+// getCStorVolume fetches the cstorVolume CR of the
+// volume whose status specifies if the volume is
+// ready to serve IOs
+func getCStorVolume(volumeID string) (*apismaya.CStorVolume, error) {
 	listOptions := v1.ListOptions{
 		LabelSelector: "openebs.io/persistent-volume=" + volumeID,
 	}
 
 	volumeList, err := csv.NewKubeclient().WithNamespace(OpenEBSNamespace).List(listOptions)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if len(volumeList.Items) != 1 {
-		return "", errors.Errorf(
+		return nil, errors.Errorf(
 			"expected single volume got {%d} for selector {%v}",
 			len(volumeList.Items),
 			listOptions,
 		)
 	}
 
-	return string(volumeList.Items[0].Status.Phase), nil
+	return &volumeList.Items[0], nil
 }
 
 // CreateCSIVolumeCR creates a new CSIVolume CR with this nodeID
@@ -81,6 +98,9 @@ func CreateCSIVolumeCR(csivol *apis.CSIVolume, nodeID, mountPath string) (err er
 		},
 	}
 	csivol.Finalizers = []string{nodeID}
+	csivol.Status = apis.CSIVolumeStatus{
+		Phase: apis.CSIVolumePhasePending,
+	}
 
 	_, err = csivolume.NewKubeclient().WithNamespace(OpenEBSNamespace).Create(csivol)
 	return
@@ -92,7 +112,7 @@ func CreateCSIVolumeCR(csivol *apis.CSIVolume, nodeID, mountPath string) (err er
 func DeleteOldCSIVolumeCR(vol *apis.CSIVolume, nodeID string) (err error) {
 	listOptions := v1.ListOptions{
 		// TODO Update this label selector name as per naming standards
-		LabelSelector: "Volname=" + vol.Name,
+		LabelSelector: "Volname=" + vol.Spec.Volume.Name,
 	}
 
 	csivols, err := csivolume.NewKubeclient().WithNamespace(OpenEBSNamespace).List(listOptions)
@@ -101,19 +121,39 @@ func DeleteOldCSIVolumeCR(vol *apis.CSIVolume, nodeID string) (err error) {
 	}
 
 	// TODO Add description why multiple CRs can be there for one volume
+	//
+	// NOTE:
+	//  CR of this node is left behind by an earlier publish
+	// which has failed. CR which is gone once its finalizer
+	// is removed is not an error.
 	for _, csivol := range csivols.Items {
 		if csivol.Labels["nodeID"] == nodeID {
 			csivol.Finalizers = nil
 			_, err = csivolume.NewKubeclient().WithNamespace(OpenEBSNamespace).Update(&csivol)
+			if k8serror.IsNotFound(err) {
+				err = nil
+				continue
+			}
 			if err != nil {
 				return
 			}
 		}
 
 		err = csivolume.NewKubeclient().WithNamespace(OpenEBSNamespace).Delete(csivol.Name)
+		if k8serror.IsNotFound(err) {
+			err = nil
+			continue
+		}
 		if err != nil {
 			return
 		}
+		// Node which had the volume earlier can no
+		// longer remount it
+		if owner := csivol.Labels["nodeID"]; owner != nodeID {
+			VolumeRefs(vol).Warning("Fenced",
+				"volume {%s} is fenced off node {%s} to be published on node {%s}",
+				vol.Spec.Volume.Name, owner, nodeID)
+		}
 	}
 	return
 }
@@ -121,6 +161,39 @@ func DeleteOldCSIVolumeCR(vol *apis.CSIVolume, nodeID string) (err error) {
 // TODO Explain when a create of csi volume happens & when it
 // gets deleted or replaced or updated
 //
+// RemoveCSIVolumeFinalizer removes the finalizer of
+// the given node from the CSIVolume so that its
+// deletion can complete. A CSIVolume which is already
+// gone is not an error.
+func RemoveCSIVolumeFinalizer(name, nodeID string) error {
+	cli := csivolume.NewKubeclient().WithNamespace(OpenEBSNamespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		csivol, err := cli.Get(name, v1.GetOptions{})
+		if k8serror.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		finalizers := csivol.Finalizers[:0]
+		for _, f := range csivol.Finalizers {
+			if f != nodeID {
+				finalizers = append(finalizers, f)
+			}
+		}
+		if len(finalizers) == len(csivol.Finalizers) {
+			return nil
+		}
+		csivol.Finalizers = finalizers
+		_, err = cli.Update(csivol)
+		if k8serror.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
 // DeleteCSIVolumeCR removes the CSIVolume with this nodeID as
 // labelSelector from the list
 func DeleteCSIVolumeCR(vol *apis.CSIVolume) (err error) {
@@ -139,11 +212,19 @@ func DeleteCSIVolumeCR(vol *apis.CSIVolume) (err error) {
 		if csivol.Spec.Volume.OwnerNodeID == vol.Spec.Volume.OwnerNodeID {
 			csivol.Finalizers = nil
 			_, err = csivolume.NewKubeclient().WithNamespace(OpenEBSNamespace).Update(&csivol)
+			if k8serror.IsNotFound(err) {
+				err = nil
+				continue
+			}
 			if err != nil {
 				return
 			}
 
 			err = csivolume.NewKubeclient().WithNamespace(OpenEBSNamespace).Delete(csivol.Name)
+			if k8serror.IsNotFound(err) {
+				err = nil
+				continue
+			}
 			if err != nil {
 				return
 			}
@@ -172,6 +253,9 @@ func FetchAndUpdateVolInfos(nodeID string) (err error) {
 		return
 	}
 
+	VolumesListLock.Lock()
+	defer VolumesListLock.Unlock()
+
 	for _, csivol := range csivols.Items {
 		vol := csivol
 		Volumes[csivol.Spec.Volume.Name] = &vol
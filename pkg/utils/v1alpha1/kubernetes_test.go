@@ -0,0 +1,138 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	event "github.com/openebs/csi/pkg/event/v1alpha1"
+	client "github.com/openebs/csi/pkg/generated/maya/kubernetes/client/v1alpha1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDeleteOldCSIVolumeCR(t *testing.T) {
+	const csivolumesPath = "/apis/openebs.io/v1alpha1/namespaces/openebs/csivolumes"
+
+	tests := map[string]struct {
+		owners          []string
+		gone            map[string]bool
+		expectedDeleted []string
+		expectedEvents  []string
+	}{
+		"volume published on another node is fenced": {
+			owners:          []string{"node2"},
+			expectedDeleted: []string{"pvc-1-node2"},
+			expectedEvents: []string{
+				"Warning Fenced volume {pvc-1} is fenced off node {node2} to be published on node {node1}",
+			},
+		},
+		"stale CR of this node is not fenced": {
+			owners:          []string{"node1"},
+			expectedDeleted: []string{"pvc-1-node1"},
+		},
+		"CR of another node which is gone is not fenced": {
+			owners: []string{"node2"},
+			gone:   map[string]bool{"pvc-1-node2": true},
+		},
+		"only the other node is fenced": {
+			owners:          []string{"node1", "node2"},
+			expectedDeleted: []string{"pvc-1-node1", "pvc-1-node2"},
+			expectedEvents: []string{
+				"Warning Fenced volume {pvc-1} is fenced off node {node2} to be published on node {node1}",
+			},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			var deleted []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Path == csivolumesPath {
+					list := &apis.CSIVolumeList{}
+					for _, owner := range mock.owners {
+						vol := apis.CSIVolume{}
+						vol.Name = "pvc-1-" + owner
+						vol.Labels = map[string]string{"Volname": "pvc-1", "nodeID": owner}
+						vol.Finalizers = []string{owner}
+						list.Items = append(list.Items, vol)
+					}
+					_ = json.NewEncoder(w).Encode(list)
+					return
+				}
+
+				volName := strings.TrimPrefix(r.URL.Path, csivolumesPath+"/")
+				if mock.gone[volName] {
+					w.WriteHeader(http.StatusNotFound)
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"kind": "Status", "apiVersion": "v1", "status": "Failure",
+						"reason": "NotFound", "code": http.StatusNotFound,
+					})
+					return
+				}
+				if r.Method == http.MethodDelete {
+					deleted = append(deleted, volName)
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"kind": "Status", "apiVersion": "v1", "status": "Success",
+					})
+					return
+				}
+				_ = json.NewEncoder(w).Encode(&apis.CSIVolume{})
+			}))
+			defer server.Close()
+
+			namespace := OpenEBSNamespace
+			master := os.Getenv(string(client.K8sMasterIPEnvironmentKey))
+			OpenEBSNamespace = "openebs"
+			_ = os.Setenv(string(client.K8sMasterIPEnvironmentKey), server.URL)
+			defer func() {
+				OpenEBSNamespace = namespace
+				_ = os.Setenv(string(client.K8sMasterIPEnvironmentKey), master)
+			}()
+
+			fake := record.NewFakeRecorder(10)
+			event.SetRecorder(fake)
+			defer event.SetRecorder(nil)
+
+			vol := &apis.CSIVolume{}
+			vol.Spec.Volume.Name = "pvc-1"
+			if err := DeleteOldCSIVolumeCR(vol, "node1"); err != nil {
+				t.Fatalf("Test {%s} failed: expected no error got: %v", name, err)
+			}
+			close(fake.Events)
+
+			var events []string
+			for e := range fake.Events {
+				events = append(events, e)
+			}
+			if !reflect.DeepEqual(deleted, mock.expectedDeleted) {
+				t.Fatalf("Test {%s} failed: expected deleted {%v} got {%v}", name, mock.expectedDeleted, deleted)
+			}
+			if !reflect.DeepEqual(events, mock.expectedEvents) {
+				t.Fatalf("Test {%s} failed: expected events {%v} got {%v}", name, mock.expectedEvents, events)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright © 2018-2019 The OpenEBS Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"sync"
+)
+
+// VolumeLocks keeps track of the volumes that have
+// an operation in flight so that only one operation
+// is performed against a volume at any given time
+//
+// NOTE:
+//  Acquiring a lock never blocks. Callers are expected
+// to reply with an Aborted error when the lock is not
+// acquired so that the CO retries the operation later.
+type VolumeLocks struct {
+	sync.Mutex
+
+	// inflight holds the volumes which have an
+	// operation in progress
+	inflight map[string]bool
+}
+
+// NewVolumeLocks returns a new instance of
+// VolumeLocks
+func NewVolumeLocks() *VolumeLocks {
+	return &VolumeLocks{
+		inflight: map[string]bool{},
+	}
+}
+
+// TryAcquire locks the volume & returns true if no
+// other operation is in flight against the volume.
+// It returns false otherwise.
+func (l *VolumeLocks) TryAcquire(volumeID string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.inflight[volumeID] {
+		return false
+	}
+	l.inflight[volumeID] = true
+	return true
+}
+
+// Release unlocks the volume
+func (l *VolumeLocks) Release(volumeID string) {
+	l.Lock()
+	defer l.Unlock()
+
+	delete(l.inflight, volumeID)
+}
@@ -0,0 +1,145 @@
+// Copyright © 2018-2019 The OpenEBS Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	"golang.org/x/net/context"
+)
+
+func TestVolumeLocks(t *testing.T) {
+	locks := NewVolumeLocks()
+
+	if !locks.TryAcquire("pvc-1") {
+		t.Fatalf("expected lock of pvc-1 to be acquired")
+	}
+	if locks.TryAcquire("pvc-1") {
+		t.Fatalf("expected lock of pvc-1 to be in use")
+	}
+	if !locks.TryAcquire("pvc-2") {
+		t.Fatalf("expected lock of pvc-2 to be independent of pvc-1")
+	}
+
+	locks.Release("pvc-1")
+	if !locks.TryAcquire("pvc-1") {
+		t.Fatalf("expected lock of pvc-1 to be acquired after release")
+	}
+}
+
+func TestStartRemount(t *testing.T) {
+	tests := map[string]struct {
+		registered         bool
+		remounting         bool
+		lockedDuringWait   bool
+		unregisteredInWait bool
+		waitErr            error
+		expectedWait       bool
+		expectedRemount    bool
+	}{
+		"volume is remounted": {
+			registered:      true,
+			expectedWait:    true,
+			expectedRemount: true,
+		},
+		"operation started during the wait": {
+			registered:       true,
+			lockedDuringWait: true,
+			expectedWait:     true,
+		},
+		"volume unpublished during the wait": {
+			registered:         true,
+			unregisteredInWait: true,
+			expectedWait:       true,
+		},
+		"wait stopped": {
+			registered:   true,
+			waitErr:      errors.New("context canceled"),
+			expectedWait: true,
+		},
+		"volume being remounted": {
+			registered: true,
+			remounting: true,
+		},
+		"volume unregistered": {},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			volName := "pvc-1"
+			locks := NewVolumeLocks()
+			m := NewMountMonitor(time.Minute, locks, func(task func(ctx context.Context)) {
+				task(context.Background())
+			})
+			vol := &apis.CSIVolume{}
+			vol.Spec.Volume.Name = volName
+			if mock.registered {
+				m.Register(vol)
+			}
+			if mock.remounting {
+				markForRemount(volName)
+			}
+			defer func() {
+				ReqMountListLock.Lock()
+				delete(ReqMountList, volName)
+				ReqMountListLock.Unlock()
+			}()
+
+			var waited, remounted bool
+			m.waitReady = func(ctx context.Context, vol *apis.CSIVolume) error {
+				waited = true
+				// volume is not locked while being waited upon
+				if !locks.TryAcquire(volName) {
+					t.Fatalf("Test {%s} failed: expected volume not locked during the wait", name)
+				}
+				if !mock.lockedDuringWait {
+					locks.Release(volName)
+				}
+				if mock.unregisteredInWait {
+					m.Unregister(volName)
+				}
+				return mock.waitErr
+			}
+			m.startRemount(vol, false, func(ctx context.Context) {
+				remounted = true
+				if locks.TryAcquire(volName) {
+					t.Fatalf("Test {%s} failed: expected volume locked during the remount", name)
+				}
+			})
+
+			if waited != mock.expectedWait {
+				t.Fatalf("Test {%s} failed: expected wait {%t} got {%t}", name, mock.expectedWait, waited)
+			}
+			if remounted != mock.expectedRemount {
+				t.Fatalf("Test {%s} failed: expected remount {%t} got {%t}", name, mock.expectedRemount, remounted)
+			}
+			// lock is released once the remount is over
+			isFree := locks.TryAcquire(volName)
+			if isFree == mock.lockedDuringWait {
+				t.Fatalf("Test {%s} failed: expected lock held {%t} got {%t}", name, mock.lockedDuringWait, !isFree)
+			}
+			ReqMountListLock.RLock()
+			_, isRemounting := ReqMountList[volName]
+			ReqMountListLock.RUnlock()
+			if isRemounting != mock.remounting {
+				t.Fatalf("Test {%s} failed: expected remounting {%t} got {%t}", name, mock.remounting, isRemounting)
+			}
+		})
+	}
+}
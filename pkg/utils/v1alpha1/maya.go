@@ -5,13 +5,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	apismaya "github.com/openebs/csi/pkg/apis/openebs.io/maya/v1alpha1"
 	errors "github.com/openebs/csi/pkg/generated/maya/errors/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	metrics "github.com/openebs/csi/pkg/metrics/v1alpha1"
+	trace "github.com/openebs/csi/pkg/trace/v1alpha1"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -21,6 +29,10 @@ const (
 	gib100 int64 = gib * 100
 	tib    int64 = gib * 1024
 	tib100 int64 = tib * 100
+
+	// mapiDialTimeout is the time to wait while
+	// verifying if maya apiserver is reachable
+	mapiDialTimeout = 2 * time.Second
 )
 
 // TODO
@@ -32,7 +44,7 @@ const (
 //
 // ProvisionVolume sends a request to maya
 // apiserver to create a new CAS volume
-func ProvisionVolume(req *csi.CreateVolumeRequest) (*apismaya.CASVolume, error) {
+func ProvisionVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*apismaya.CASVolume, error) {
 	casVolume := apismaya.CASVolume{}
 	casVolume.Spec.Capacity = strconv.FormatInt(req.GetCapacityRange().GetRequiredBytes(), 10)
 
@@ -46,7 +58,7 @@ func ProvisionVolume(req *csi.CreateVolumeRequest) (*apismaya.CASVolume, error)
 	mapLabels := make(map[string]string)
 
 	if storageclass == "" {
-		logrus.Errorf("volume is not specified with storageclass")
+		log.FromContext(ctx).Errorf("volume is not specified with storageclass")
 	} else {
 		mapLabels[string(apismaya.StorageClassKey)] = storageclass
 		casVolume.Labels = mapLabels
@@ -58,38 +70,38 @@ func ProvisionVolume(req *csi.CreateVolumeRequest) (*apismaya.CASVolume, error)
 		parameters["persistentvolumeclaim"]
 	casVolume.Name = req.GetName()
 
-	logrus.Infof("verify if volume {%s} is already present", casVolume.Name)
-	err := ReadVolume(req.GetName(), namespace, storageclass, &casVolume)
+	log.FromContext(ctx).Infof("verify if volume {%s} is already present", casVolume.Name)
+	err := ReadVolume(ctx, req.GetName(), namespace, storageclass, &casVolume)
 	if err == nil {
-		logrus.Infof("volume {%v} already present", req.GetName())
+		log.FromContext(ctx).Infof("volume {%v} already present", req.GetName())
 		return &casVolume, nil
 	}
 
 	if err.Error() != http.StatusText(404) {
 		// any error other than 404 is unexpected error
-		logrus.Errorf("failed to read volume {%s}: %v", req.GetName(), err)
+		log.FromContext(ctx).Errorf("failed to read volume {%s}: %v", req.GetName(), err)
 		return nil, err
 	}
 
 	if err.Error() == http.StatusText(404) {
-		logrus.Infof("volume {%s} does not exist: will attempt to create", req.GetName())
+		log.FromContext(ctx).Infof("volume {%s} does not exist: will attempt to create", req.GetName())
 
-		err = CreateVolume(casVolume)
+		err = CreateVolume(ctx, casVolume)
 		if err != nil {
-			logrus.Errorf(
+			log.FromContext(ctx).Errorf(
 				"failed to create volume {%s}: %v",
 				req.GetName(),
 				err)
 			return nil, err
 		}
 
-		err = ReadVolume(req.GetName(), namespace, storageclass, &casVolume)
+		err = ReadVolume(ctx, req.GetName(), namespace, storageclass, &casVolume)
 		if err != nil {
-			logrus.Errorf("failed to read volume {%s}: %v", req.GetName(), err)
+			log.FromContext(ctx).Errorf("failed to read volume {%s}: %v", req.GetName(), err)
 			return nil, err
 		}
 
-		logrus.Infof("volume {%s} created successfully", req.GetName())
+		log.FromContext(ctx).Infof("volume {%s} created successfully", req.GetName())
 	}
 
 	return &casVolume, nil
@@ -97,7 +109,7 @@ func ProvisionVolume(req *csi.CreateVolumeRequest) (*apismaya.CASVolume, error)
 
 // CreateVolume creates the CAS volume through
 // an API call to maya apiserver
-func CreateVolume(vol apismaya.CASVolume) error {
+func CreateVolume(ctx context.Context, vol apismaya.CASVolume) error {
 
 	url := MAPIServerEndpoint + "/latest/volumes/"
 
@@ -106,46 +118,43 @@ func CreateVolume(vol apismaya.CASVolume) error {
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonValue))
 	if err != nil {
-		logrus.Infof("error while creating newRequest: %v", err)
+		log.FromContext(ctx).Infof("error while creating newRequest: %v", err)
 		return err
 	}
 
 	req.Header.Add("Content-Type", "application/json")
 
-	c := &http.Client{
-		Timeout: timeout,
-	}
-	resp, err := c.Do(req)
+	resp, err := doMAPIRequest(ctx, "create", req)
 	if err != nil {
-		logrus.Errorf("Error when connecting maya-apiserver %v", err)
+		log.FromContext(ctx).Errorf("Error when connecting maya-apiserver %v", err)
 		return err
 	}
 	defer resp.Body.Close()
 
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		logrus.Errorf("Unable to read response from maya-apiserver %v", err)
+		log.FromContext(ctx).Errorf("Unable to read response from maya-apiserver %v", err)
 		return err
 	}
 
 	code := resp.StatusCode
 	if code != http.StatusOK {
-		logrus.Errorf("%s: failed to create volume '%s': response: %+v",
+		log.FromContext(ctx).Errorf("%s: failed to create volume '%s': response: %+v",
 			http.StatusText(code), vol.Name, string(data))
 		return fmt.Errorf("%s: failed to create volume '%s': response: %+v",
 			http.StatusText(code), vol.Name, string(data))
 	}
 
-	logrus.Infof("volume {%s} created successfully", vol.Name)
+	log.FromContext(ctx).Infof("volume {%s} created successfully", vol.Name)
 	return nil
 }
 
 // ReadVolume to get the info of CAS volume through a API call to m-apiserver
-func ReadVolume(vname, namespace, storageclass string, obj interface{}) error {
+func ReadVolume(ctx context.Context, vname, namespace, storageclass string, obj interface{}) error {
 
 	url := MAPIServerEndpoint + "/latest/volumes/" + vname
 
-	logrus.Infof("[DEBUG] Get details for Volume :%v", string(vname))
+	log.FromContext(ctx).Infof("[DEBUG] Get details for Volume :%v", string(vname))
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -157,29 +166,26 @@ func ReadVolume(vname, namespace, storageclass string, obj interface{}) error {
 	// Maya-apiserver to get the CAS template name
 	req.Header.Set(string(apismaya.StorageClassHeaderKey), storageclass)
 
-	c := &http.Client{
-		Timeout: timeout,
-	}
-	resp, err := c.Do(req)
+	resp, err := doMAPIRequest(ctx, "read", req)
 	if err != nil {
-		logrus.Errorf("Error when connecting to maya-apiserver %v", err)
+		log.FromContext(ctx).Errorf("Error when connecting to maya-apiserver %v", err)
 		return err
 	}
 	defer resp.Body.Close()
 
 	code := resp.StatusCode
 	if code != http.StatusOK {
-		logrus.Errorf("HTTP Status error from maya-apiserver: %v\n",
+		log.FromContext(ctx).Errorf("HTTP Status error from maya-apiserver: %v\n",
 			http.StatusText(code))
 		return errors.New(http.StatusText(code))
 	}
-	logrus.Info("volume Details Successfully Retrieved")
+	log.FromContext(ctx).Infof("volume Details Successfully Retrieved")
 	return json.NewDecoder(resp.Body).Decode(obj)
 }
 
 // DeleteVolume deletes CAS volume through an
 // API call to maya apiserver
-func DeleteVolume(name, namespace string) error {
+func DeleteVolume(ctx context.Context, name, namespace string) error {
 
 	url := MAPIServerEndpoint + "/latest/volumes/" + name
 	req, err := http.NewRequest("DELETE", url, nil)
@@ -188,11 +194,7 @@ func DeleteVolume(name, namespace string) error {
 	}
 
 	req.Header.Set("namespace", namespace)
-	c := &http.Client{
-		Timeout: timeout,
-	}
-
-	resp, err := c.Do(req)
+	resp, err := doMAPIRequest(ctx, "delete", req)
 	if err != nil {
 		return err
 	}
@@ -209,3 +211,45 @@ func DeleteVolume(name, namespace string) error {
 
 	return nil
 }
+
+// doMAPIRequest sends the given request to maya
+// apiserver and records its latency. The trace of
+// the given context is propagated to maya apiserver.
+func doMAPIRequest(ctx context.Context, operation string, req *http.Request) (resp *http.Response, err error) {
+	c := &http.Client{
+		Timeout: timeout,
+	}
+
+	ctx, span := trace.Start(ctx, "maya."+operation, oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+	span.SetAttributes(
+		attribute.String("http.method", req.Method),
+		attribute.String("http.url", req.URL.String()),
+	)
+	defer func() { trace.End(span, err) }()
+	trace.Inject(ctx, req.Header)
+
+	start := time.Now()
+	resp, err = c.Do(req.WithContext(ctx))
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+		span.SetAttributes(attribute.String("http.status_code", code))
+	}
+	metrics.ObserveMAPIRequest(operation, code, time.Since(start))
+	return resp, err
+}
+
+// VerifyMAPIServer checks if maya apiserver
+// is reachable
+func VerifyMAPIServer() error {
+	u, err := url.Parse(MAPIServerEndpoint)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", u.Host, mapiDialTimeout)
+	if err != nil {
+		return errors.Wrapf(err, "maya apiserver {%s} is not reachable", u.Host)
+	}
+	return conn.Close()
+}
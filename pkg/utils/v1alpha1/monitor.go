@@ -0,0 +1,349 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"sync"
+	"time"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	metrics "github.com/openebs/csi/pkg/metrics/v1alpha1"
+	"golang.org/x/net/context"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+// MountMonitor makes sure that the volumes registered
+// with it stay mounted with their original mount
+// options
+//
+// The monitor wakes up whenever the mount table of
+// the node changes. A slower periodic pass acts as
+// a safety net for the missed changes.
+type MountMonitor struct {
+	sync.RWMutex
+
+	// volumes being monitored, keyed by
+	// volume name
+	volumes map[string]*apis.CSIVolume
+
+	mounter mount.Interface
+
+	// locks of the volumes, the volume is remounted
+	// only if no other operation is in flight against
+	// it & is locked only while it is being remounted
+	locks *VolumeLocks
+
+	// goTask runs the remount of a volume in the
+	// background so that it can be waited upon
+	// during shutdown
+	goTask func(task func(ctx context.Context))
+
+	// waitReady waits till the volume can be
+	// remounted, this is a variable to be able to
+	// test without a volume
+	waitReady func(ctx context.Context, vol *apis.CSIVolume) error
+
+	// resyncInterval is the time after which all the
+	// volumes are verified irrespective of changes
+	// to the mount table
+	resyncInterval time.Duration
+}
+
+// NewMountMonitor returns a new instance of
+// MountMonitor which verifies all the volumes
+// after every resyncInterval. Remounts are run
+// via the provided goTask.
+func NewMountMonitor(
+	resyncInterval time.Duration,
+	locks *VolumeLocks,
+	goTask func(task func(ctx context.Context)),
+) *MountMonitor {
+	return &MountMonitor{
+		volumes:        map[string]*apis.CSIVolume{},
+		mounter:        mount.New(""),
+		locks:          locks,
+		goTask:         goTask,
+		waitReady:      WaitForVolumeReadyAndReachable,
+		resyncInterval: resyncInterval,
+	}
+}
+
+// Register starts monitoring the provided volume
+//
+// NOTE:
+//  This should be invoked only after the volume
+// has been mounted
+func (m *MountMonitor) Register(vol *apis.CSIVolume) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.volumes[vol.Spec.Volume.Name] = vol
+	metrics.MonitoredVolumes.Set(float64(len(m.volumes)))
+}
+
+// Unregister stops monitoring the provided volume
+//
+// NOTE:
+//  This should be invoked before the volume is
+// unmounted
+func (m *MountMonitor) Unregister(volName string) {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.volumes, volName)
+	metrics.MonitoredVolumes.Set(float64(len(m.volumes)))
+}
+
+// Len returns the number of volumes being
+// monitored
+func (m *MountMonitor) Len() int {
+	m.RLock()
+	defer m.RUnlock()
+
+	return len(m.volumes)
+}
+
+// snapshot returns the volumes being monitored
+// so that they can be verified without holding
+// the lock
+func (m *MountMonitor) snapshot() []*apis.CSIVolume {
+	m.RLock()
+	defer m.RUnlock()
+
+	vols := make([]*apis.CSIVolume, 0, len(m.volumes))
+	for _, vol := range m.volumes {
+		vols = append(vols, vol)
+	}
+	return vols
+}
+
+// isRegistered returns true if the volume is
+// still being monitored
+func (m *MountMonitor) isRegistered(volName string) bool {
+	m.RLock()
+	defer m.RUnlock()
+
+	_, ok := m.volumes[volName]
+	return ok
+}
+
+// Run verifies the monitored volumes whenever the
+// mount table changes and after every resync
+// interval. This blocks till the context is done
+// and hence should be run as a goroutine.
+func (m *MountMonitor) Run(ctx context.Context) {
+	changed := make(chan struct{}, 1)
+	go func() {
+		if err := watchMountInfo(ctx, changed); err != nil {
+			log.Errorf(
+				"failed to watch mount table: will verify mounts every %v: %v",
+				m.resyncInterval,
+				err,
+			)
+		}
+	}()
+
+	ticker := time.NewTicker(m.resyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("stopping mount monitor")
+			return
+		case <-changed:
+			m.verify()
+		case <-ticker.C:
+			m.verify()
+		}
+	}
+}
+
+// verify adds the volumes which are either not
+// mounted or are mounted in an undesired mode to
+// ReqMountList and starts a goroutine to remount
+// each of them, so that they can all be remounted
+// in parallel
+func (m *MountMonitor) verify() {
+	vols := m.snapshot()
+	if len(vols) == 0 {
+		return
+	}
+
+	// Get list of mounted paths present with the node
+	list, err := m.mounter.List()
+	if err != nil {
+		log.Errorf("failed to list mount points: %v", err)
+		return
+	}
+
+	for _, vol := range vols {
+		m.verifyVolume(vol, list)
+	}
+}
+
+// Verify verifies the mount of the provided volume
+// and starts a goroutine to remount it if required
+func (m *MountMonitor) Verify(vol *apis.CSIVolume) error {
+	list, err := m.mounter.List()
+	if err != nil {
+		return err
+	}
+
+	m.verifyVolume(vol, list)
+	return nil
+}
+
+// verifyVolume remounts the volume if it is either
+// not present in the provided mount list or is
+// mounted in an undesired mode
+func (m *MountMonitor) verifyVolume(vol *apis.CSIVolume, list []mount.MountPoint) {
+	desiredMountOpt := getDesiredMountOpt(vol)
+
+	// Search the volume in the list of mounted volumes at the node
+	// retrieved above
+	mountPoint, exists := listContains(vol.Spec.Volume.MountPath, list)
+	// If the volume is present in the list verify its state
+	if exists && verifyMountOpts(mountPoint.Opts, desiredMountOpt) {
+		// Nothing to do since this volume looks to be in good shape
+		return
+	}
+
+	m.startRemount(vol, exists, func(ctx context.Context) {
+		// Mount may have been fixed or replaced while
+		// the volume was being waited upon
+		list, err := m.mounter.List()
+		if err != nil {
+			log.FromContext(ctx).Errorf("failed to list mount points: %v", err)
+			return
+		}
+		mountPoint, exists := listContains(vol.Spec.Volume.MountPath, list)
+		if exists && verifyMountOpts(mountPoint.Opts, desiredMountOpt) {
+			return
+		}
+		RemountVolume(ctx, exists, vol, mountPoint, desiredMountOpt)
+	})
+}
+
+// Reattach logs in to the provided volume again and
+// mounts it. This is meant for the volumes whose
+// mount point is present but whose iSCSI session is
+// lost.
+func (m *MountMonitor) Reattach(vol *apis.CSIVolume) {
+	m.startRemount(vol, false, func(ctx context.Context) {
+		// The stale mount point needs to be removed else
+		// the attach would skip mounting the new device
+		if err := m.mounter.Unmount(vol.Spec.Volume.MountPath); err != nil {
+			log.FromContext(ctx).Warningf(
+				"failed to unmount stale mount point {%s}: %v",
+				vol.Spec.Volume.MountPath,
+				err,
+			)
+		}
+		RemountVolume(ctx, false, vol, nil, getDesiredMountOpt(vol))
+	})
+}
+
+// startRemount marks the volume for remount and runs
+// the provided remount in the background. Nothing is
+// done if the volume is already being remounted or
+// got unregistered after the snapshot was taken.
+func (m *MountMonitor) startRemount(vol *apis.CSIVolume, exists bool, remount func(ctx context.Context)) {
+	volName := vol.Spec.Volume.Name
+	if !m.isRegistered(volName) || !markForRemount(volName) {
+		return
+	}
+	m.goTask(func(ctx context.Context) {
+		defer unmarkForRemount(volName)
+		reportRemounting(vol, exists, getDesiredMountOpt(vol))
+		m.remount(ctx, vol, remount)
+	})
+}
+
+// remount waits till the volume is ready & reachable
+// and then remounts it with the volume locked
+//
+// NOTE:
+//  Volume is not locked while being waited upon since
+// the wait lasts till the target comes back. Unpublish
+// or expansion of the volume proceed meanwhile & the
+// remount is skipped if the volume is found locked or
+// unregistered after the wait. Volume is verified again
+// during the next resync in that case.
+func (m *MountMonitor) remount(ctx context.Context, vol *apis.CSIVolume, remount func(ctx context.Context)) {
+	volName := vol.Spec.Volume.Name
+	if err := m.waitReady(ctx, vol); err != nil {
+		log.FromContext(ctx).Errorf("stopped remount of volume {%s}: %v", volName, err)
+		return
+	}
+	if !m.lockForRemount(volName) {
+		log.FromContext(ctx).Infof(
+			"skipped remount of volume {%s}: volume is busy or no longer published", volName)
+		return
+	}
+	defer m.locks.Release(volName)
+	remount(ctx)
+}
+
+// lockForRemount locks the volume to be remounted.
+// False is returned if another operation is in flight
+// against the volume or the volume got unregistered.
+func (m *MountMonitor) lockForRemount(volName string) bool {
+	if !m.locks.TryAcquire(volName) {
+		return false
+	}
+	if !m.isRegistered(volName) {
+		m.locks.Release(volName)
+		return false
+	}
+	return true
+}
+
+// getDesiredMountOpt returns the mode in which the
+// volume is supposed to be mounted
+func getDesiredMountOpt(vol *apis.CSIVolume) string {
+	if vol.Spec.Volume.ReadOnly {
+		return "ro"
+	}
+	return "rw"
+}
+
+// markForRemount adds the volume to ReqMountList and
+// returns false if the volume is already present in
+// the list
+func markForRemount(volName string) bool {
+	ReqMountListLock.Lock()
+	defer ReqMountListLock.Unlock()
+
+	if _, isRemounting := ReqMountList[volName]; isRemounting {
+		return false
+	}
+	ReqMountList[volName] = true
+	metrics.PendingRemounts.Set(float64(len(ReqMountList)))
+	return true
+}
+
+// unmarkForRemount removes the volume from
+// ReqMountList once its remount is over
+func unmarkForRemount(volName string) {
+	ReqMountListLock.Lock()
+	defer ReqMountListLock.Unlock()
+
+	delete(ReqMountList, volName)
+	metrics.PendingRemounts.Set(float64(len(ReqMountList)))
+}
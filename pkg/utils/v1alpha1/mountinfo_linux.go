@@ -0,0 +1,93 @@
+// +build linux
+
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// mountInfoPath lists the mount points seen by
+	// this process. Kernel flags this file with
+	// EPOLLPRI|EPOLLERR whenever the mount table
+	// changes
+	mountInfoPath = "/proc/self/mountinfo"
+
+	// mountInfoWaitTimeoutMs is the max time epoll
+	// waits before checking if the context is done
+	mountInfoWaitTimeoutMs = 1000
+)
+
+// watchMountInfo signals on the provided channel
+// whenever the mount table of this node changes.
+// This blocks until the context is done or an
+// error occurs.
+func watchMountInfo(ctx context.Context, changed chan<- struct{}) error {
+	// NOTE:
+	//  The file is not opened via os.Open since that
+	// registers it with the go runtime's poller which
+	// would then consume the change notifications
+	fd, err := unix.Open(mountInfoPath, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(epfd)
+
+	event := unix.EpollEvent{
+		Events: unix.EPOLLPRI | unix.EPOLLERR,
+		Fd:     int32(fd),
+	}
+	if err := unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, fd, &event); err != nil {
+		return err
+	}
+
+	events := make([]unix.EpollEvent, 1)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		n, err := unix.EpollWait(epfd, events, mountInfoWaitTimeoutMs)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+
+		// coalesce the changes if the previous one
+		// is yet to be processed
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
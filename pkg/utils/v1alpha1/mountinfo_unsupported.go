@@ -0,0 +1,31 @@
+// +build !linux
+
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"errors"
+
+	"golang.org/x/net/context"
+)
+
+// watchMountInfo is not supported on this platform,
+// the mount monitor relies on its periodic pass
+func watchMountInfo(ctx context.Context, changed chan<- struct{}) error {
+	return errors.New("watching mount table is not supported on this platform")
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+
+	apismaya "github.com/openebs/csi/pkg/apis/openebs.io/maya/v1alpha1"
+)
+
+// DegradedPolicy decides if a volume with fewer
+// healthy replicas than its replication factor can
+// be published
+type DegradedPolicy string
+
+const (
+	// DegradedPolicyAllow publishes the volume as
+	// soon as its consistency factor is met
+	DegradedPolicyAllow DegradedPolicy = "allow"
+
+	// DegradedPolicyDeny publishes the volume only
+	// once all its replicas are healthy
+	DegradedPolicyDeny DegradedPolicy = "deny"
+
+	// DegradedPolicyKey is the key of the degraded
+	// policy in the StorageClass parameters & volume
+	// context
+	DegradedPolicyKey = "degradedPolicy"
+)
+
+// ParseDegradedPolicy returns the degraded policy set
+// in the given StorageClass parameters or volume
+// context
+func ParseDegradedPolicy(params map[string]string) (DegradedPolicy, error) {
+	policy := DegradedPolicy(params[DegradedPolicyKey])
+	switch policy {
+	case "":
+		return DegradedPolicyAllow, nil
+	case DegradedPolicyAllow, DegradedPolicyDeny:
+		return policy, nil
+	}
+	return "", fmt.Errorf(
+		"invalid %s {%s}: should be one of %s or %s",
+		DegradedPolicyKey, policy, DegradedPolicyAllow, DegradedPolicyDeny,
+	)
+}
+
+// volumeReadiness returns nil if the volume can serve
+// IOs as per its replicas and the given policy, else
+// it returns the reason why it is not ready
+//
+// NOTE:
+//  Volumes provisioned by older versions of maya do
+// not have the consistency factor in their spec,
+// the phase of such volumes is relied upon
+func volumeReadiness(cv *apismaya.CStorVolume, policy DegradedPolicy) error {
+	if cv.Spec.ConsistencyFactor == 0 {
+		// In both healthy and degraded states the
+		// volume can serve IOs
+		phase := string(cv.Status.Phase)
+		if phase != "Healthy" && phase != "Degraded" {
+			return fmt.Errorf("volume status is {%s}", phase)
+		}
+		return nil
+	}
+
+	health := volumeHealth(cv)
+	healthy := health.HealthyReplicas()
+	if healthy < health.ConsistencyFactor {
+		return fmt.Errorf(
+			"{%d} of {%d} replicas are healthy, {%d} required for quorum",
+			healthy, health.ReplicationFactor, health.ConsistencyFactor,
+		)
+	}
+	if policy == DegradedPolicyDeny && health.IsDegraded() {
+		return fmt.Errorf(
+			"{%d} of {%d} replicas are healthy, {%d} required as %s is {%s}",
+			healthy, health.ReplicationFactor, health.ReplicationFactor, DegradedPolicyKey, policy,
+		)
+	}
+	return nil
+}
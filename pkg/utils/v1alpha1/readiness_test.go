@@ -0,0 +1,133 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	apismaya "github.com/openebs/csi/pkg/apis/openebs.io/maya/v1alpha1"
+)
+
+func TestParseDegradedPolicy(t *testing.T) {
+	tests := map[string]struct {
+		params   map[string]string
+		expected DegradedPolicy
+		isErr    bool
+	}{
+		"default": {
+			params:   map[string]string{},
+			expected: DegradedPolicyAllow,
+		},
+		"deny": {
+			params:   map[string]string{DegradedPolicyKey: "deny"},
+			expected: DegradedPolicyDeny,
+		},
+		"invalid": {
+			params: map[string]string{DegradedPolicyKey: "sometimes"},
+			isErr:  true,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseDegradedPolicy(mock.params)
+			if mock.isErr != (err != nil) {
+				t.Fatalf("Test {%s} failed: expected error {%t} got {%v}", name, mock.isErr, err)
+			}
+			if got != mock.expected {
+				t.Fatalf("Test {%s} failed: expected {%s} got {%s}", name, mock.expected, got)
+			}
+		})
+	}
+}
+
+func TestVolumeReadiness(t *testing.T) {
+	cstorVolume := func(phase string, modes ...string) *apismaya.CStorVolume {
+		cv := &apismaya.CStorVolume{
+			Spec: apismaya.CStorVolumeSpec{
+				ReplicationFactor: 3,
+				ConsistencyFactor: 2,
+			},
+			Status: apismaya.CStorVolumeStatus{
+				Phase: apismaya.CStorVolumePhase(phase),
+			},
+		}
+		for _, mode := range modes {
+			cv.Status.ReplicaStatuses = append(cv.Status.ReplicaStatuses,
+				apismaya.ReplicaStatus{Mode: mode})
+		}
+		return cv
+	}
+
+	tests := map[string]struct {
+		cv       *apismaya.CStorVolume
+		policy   DegradedPolicy
+		expected string
+	}{
+		"all replicas healthy": {
+			cv:     cstorVolume("Healthy", "Healthy", "Healthy", "Healthy"),
+			policy: DegradedPolicyDeny,
+		},
+		"degraded volume is allowed": {
+			cv:     cstorVolume("Degraded", "Healthy", "Healthy", "Degraded"),
+			policy: DegradedPolicyAllow,
+		},
+		"degraded volume is denied": {
+			cv:       cstorVolume("Degraded", "Healthy", "Healthy", "Degraded"),
+			policy:   DegradedPolicyDeny,
+			expected: "{2} of {3} replicas are healthy, {3} required as degradedPolicy is {deny}",
+		},
+		"quorum is not met": {
+			cv:       cstorVolume("Offline", "Healthy", "Degraded"),
+			policy:   DegradedPolicyAllow,
+			expected: "{1} of {3} replicas are healthy, {2} required for quorum",
+		},
+		"no replica connected": {
+			cv:       cstorVolume("Init"),
+			policy:   DegradedPolicyAllow,
+			expected: "{0} of {3} replicas are healthy, {2} required for quorum",
+		},
+		"volume without consistency factor": {
+			cv: &apismaya.CStorVolume{
+				Status: apismaya.CStorVolumeStatus{Phase: "Degraded"},
+			},
+			policy: DegradedPolicyDeny,
+		},
+		"offline volume without consistency factor": {
+			cv: &apismaya.CStorVolume{
+				Status: apismaya.CStorVolumeStatus{Phase: "Offline"},
+			},
+			policy:   DegradedPolicyAllow,
+			expected: "volume status is {Offline}",
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			err := volumeReadiness(mock.cv, mock.policy)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != mock.expected {
+				t.Fatalf("Test {%s} failed: expected {%s} got {%s}", name, mock.expected, got)
+			}
+		})
+	}
+}
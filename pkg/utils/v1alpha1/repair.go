@@ -0,0 +1,299 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	iscsi "github.com/openebs/csi/pkg/iscsi/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	"golang.org/x/net/context"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+// RepairPolicy decides if the filesystem of a volume
+// which went read only is repaired before remounting
+type RepairPolicy string
+
+const (
+	// RepairPolicyNever remounts the volume without
+	// checking its filesystem
+	RepairPolicyNever RepairPolicy = "never"
+
+	// RepairPolicyAuto checks & repairs the filesystem
+	// of the volume before remounting it
+	RepairPolicyAuto RepairPolicy = "auto"
+
+	// RepairPolicyManual leaves the volume read only
+	// for the filesystem to be repaired by the admin
+	RepairPolicyManual RepairPolicy = "manual"
+
+	// RepairPolicyKey is the key of the repair policy
+	// in the StorageClass parameters & volume context
+	RepairPolicyKey = "fsRepairPolicy"
+)
+
+// Causes of a volume turning read only
+const (
+	// ReadOnlyDeviceOffline means the device of the
+	// volume was taken offline e.g. iSCSI session
+	// failed beyond its replacement timeout
+	ReadOnlyDeviceOffline = "DeviceOffline"
+
+	// ReadOnlyFilesystemErrors means the filesystem
+	// detected errors e.g. ext4 journal errors
+	ReadOnlyFilesystemErrors = "FilesystemErrors"
+
+	// ReadOnlyUnknown means the cause is not known
+	ReadOnlyUnknown = "Unknown"
+)
+
+// sysRoot is the root of sysfs, this is a variable
+// to be able to test against a fake sysfs
+var sysRoot = "/sys"
+
+// errDeviceOffline is returned by repairBeforeRemount
+// if the device of the volume went offline. Such a
+// volume needs to be logged in to again instead of
+// being repaired.
+var errDeviceOffline = errors.New("device of the volume is offline")
+
+// openExclusive opens the given block device with
+// O_EXCL which fails with EBUSY if the device is
+// mounted or held open by someone else e.g. another
+// mount namespace or a device mapper target. This is
+// a variable to be able to test without a device.
+var openExclusive = func(device string) (*os.File, error) {
+	return os.OpenFile(device, os.O_RDONLY|syscall.O_EXCL, 0)
+}
+
+// ParseRepairPolicy returns the repair policy set in
+// the given StorageClass parameters or volume context
+func ParseRepairPolicy(params map[string]string) (RepairPolicy, error) {
+	policy := RepairPolicy(params[RepairPolicyKey])
+	switch policy {
+	case "":
+		return RepairPolicyAuto, nil
+	case RepairPolicyNever, RepairPolicyAuto, RepairPolicyManual:
+		return policy, nil
+	}
+	return "", fmt.Errorf(
+		"invalid %s {%s}: should be one of %s, %s or %s",
+		RepairPolicyKey, policy, RepairPolicyNever, RepairPolicyAuto, RepairPolicyManual,
+	)
+}
+
+// classifyReadOnly returns the likely cause of the
+// given device being mounted read only
+func classifyReadOnly(device string) string {
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	name := filepath.Base(device)
+
+	// device of a SCSI disk goes offline once its
+	// session can not be recovered
+	state, err := ioutil.ReadFile(filepath.Join(sysRoot, "block", name, "device", "state"))
+	if err == nil && strings.TrimSpace(string(state)) == "offline" {
+		return ReadOnlyDeviceOffline
+	}
+
+	// ext4 counts the errors which made it read only
+	count, err := ioutil.ReadFile(filepath.Join(sysRoot, "fs", "ext4", name, "errors_count"))
+	if err == nil {
+		if n, _ := strconv.Atoi(strings.TrimSpace(string(count))); n > 0 {
+			return ReadOnlyFilesystemErrors
+		}
+	}
+	return ReadOnlyUnknown
+}
+
+// exitCode returns the exit code of the command
+// which failed with the given error
+func exitCode(err error) int {
+	if e, ok := err.(interface{ ExitCode() int }); ok {
+		return e.ExitCode()
+	}
+	return -1
+}
+
+// repairFilesystem checks & repairs the filesystem on
+// the given device. It returns the output of the
+// repair tool.
+func repairFilesystem(exec mount.Exec, device, fsType string) (string, error) {
+	switch fsType {
+	case "", "ext2", "ext3", "ext4":
+		out, err := exec.Run("fsck", "-y", device)
+		// fsck exits with 1 if the errors were
+		// corrected
+		if err != nil && exitCode(err) != 1 {
+			return string(out), fmt.Errorf("fsck failed: %v", err)
+		}
+		return string(out), nil
+	case "xfs":
+		out, err := exec.Run("xfs_repair", device)
+		if err != nil {
+			return string(out), fmt.Errorf("xfs_repair failed: %v", err)
+		}
+		return string(out), nil
+	}
+	return "", fmt.Errorf("repair of filesystem {%s} is not supported", fsType)
+}
+
+// ensureUnused returns an error if the given device
+// is still in use, a filesystem in use must not be
+// repaired as the repair would corrupt it further
+func ensureUnused(device string) error {
+	f, err := openExclusive(device)
+	if err != nil {
+		if perr, ok := err.(*os.PathError); ok && perr.Err == syscall.EBUSY {
+			return fmt.Errorf("device {%s} is still in use", device)
+		}
+		return fmt.Errorf("failed to open device {%s}: %v", device, err)
+	}
+	return f.Close()
+}
+
+// lastLine returns the last non empty line of the
+// given output to keep the reported outcome brief
+func lastLine(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// repairBeforeRemount unmounts the volume which went
+// read only and repairs its filesystem as per the
+// repair policy of the volume. The volume is expected
+// to be remounted only if this returns nil.
+//
+// NOTE:
+//  Only the filesystem which went read only due to
+// its own errors or an unknown cause is repaired.
+// errDeviceOffline is returned without touching the
+// mount if the device went offline, since a failed
+// session needs a login & not a repair.
+func repairBeforeRemount(vol *apis.CSIVolume, mounter mount.Interface, mountPoint *mount.MountPoint) error {
+	volName := vol.Spec.Volume.Name
+	cause := classifyReadOnly(mountPoint.Device)
+	log.Infof("volume {%s} at {%s} is read only, cause: {%s}", volName, mountPoint.Path, cause)
+
+	if cause == ReadOnlyDeviceOffline {
+		UpdateCSIVolumeStatus(vol,
+			WithCondition(apis.CSIVolumeFilesystemHealthy, apis.ConditionUnknown, "RepairSkipped",
+				"volume went read only due to "+cause+", will login again"),
+		)
+		return errDeviceOffline
+	}
+
+	policy, err := ParseRepairPolicy(map[string]string{RepairPolicyKey: vol.Spec.Volume.RepairPolicy})
+	if err != nil {
+		return err
+	}
+
+	switch policy {
+	case RepairPolicyNever:
+		UpdateCSIVolumeStatus(vol,
+			WithCondition(apis.CSIVolumeFilesystemHealthy, apis.ConditionUnknown, "RepairSkipped",
+				"volume went read only due to "+cause+", repair policy is never"),
+		)
+		return mounter.Unmount(mountPoint.Path)
+
+	case RepairPolicyManual:
+		msg := fmt.Sprintf("volume went read only due to %s, filesystem on {%s} needs to be repaired manually", cause, mountPoint.Device)
+		UpdateCSIVolumeStatus(vol,
+			WithCondition(apis.CSIVolumeFilesystemHealthy, apis.ConditionFalse, "RepairRequired", msg),
+		)
+		VolumeRefs(vol).Warning("RepairRequired", "%s", msg)
+		return fmt.Errorf("volume {%s} is left read only: %s", volName, msg)
+	}
+
+	// The mount is quiesced before the repair, the
+	// filesystem can not be repaired while mounted
+	if err := mounter.Unmount(mountPoint.Path); err != nil {
+		return err
+	}
+
+	// Filesystem may still be mounted elsewhere e.g.
+	// in the mount namespace of a container, repair is
+	// refused in that case & the volume is mounted back
+	// read only for the admin to look into it
+	if err := ensureUnused(mountPoint.Device); err != nil {
+		msg := fmt.Sprintf("repair of filesystem on {%s} is refused: %v", mountPoint.Device, err)
+		return failRepair(vol, mounter, mountPoint, msg, err)
+	}
+
+	out, err := repairFilesystem(mount.NewOsExec(), mountPoint.Device, vol.Spec.Volume.FSType)
+	if err != nil {
+		msg := fmt.Sprintf("repair of filesystem on {%s} failed: %v: %s", mountPoint.Device, err, lastLine(out))
+		return failRepair(vol, mounter, mountPoint, msg, err)
+	}
+
+	msg := fmt.Sprintf("filesystem on {%s} checked after it went read only due to %s: %s", mountPoint.Device, cause, lastLine(out))
+	UpdateCSIVolumeStatus(vol,
+		WithCondition(apis.CSIVolumeFilesystemHealthy, apis.ConditionTrue, "Repaired", msg),
+	)
+	VolumeRefs(vol).Normal("Repaired", "%s", msg)
+	return nil
+}
+
+// failRepair reports the repair of the volume as
+// failed and mounts the volume back read only so that
+// the application does not write to the node's disk
+func failRepair(vol *apis.CSIVolume, mounter mount.Interface, mountPoint *mount.MountPoint, msg string, err error) error {
+	volName := vol.Spec.Volume.Name
+	UpdateCSIVolumeStatus(vol,
+		WithCondition(apis.CSIVolumeFilesystemHealthy, apis.ConditionFalse, "RepairFailed", msg),
+	)
+	VolumeRefs(vol).Warning("RepairFailed", "%s", msg)
+
+	if merr := mounter.Mount(mountPoint.Device, mountPoint.Path, "", []string{"ro"}); merr != nil {
+		log.Errorf("failed to mount volume {%s} read only after failed repair: %v", volName, merr)
+	}
+	return fmt.Errorf("failed to repair volume {%s}: %v", volName, err)
+}
+
+// reloginVolume logs out of the iSCSI sessions of the
+// volume whose device went offline and attaches &
+// mounts it again. Stale mount point is removed first
+// else the attach would skip mounting the new device.
+func reloginVolume(ctx context.Context, vol *apis.CSIVolume, mounter mount.Interface, mountPoint *mount.MountPoint) (string, error) {
+	if err := mounter.Unmount(mountPoint.Path); err != nil {
+		log.FromContext(ctx).Warningf("failed to unmount stale mount point {%s}: %v", mountPoint.Path, err)
+	}
+
+	sessions, err := iscsi.ListSessions()
+	if err != nil {
+		return "", err
+	}
+	for _, session := range sessions {
+		if session.Iqn != vol.Spec.ISCSI.Iqn {
+			continue
+		}
+		if err := iscsi.LogoutSession(session, vol.Spec.Volume.Name); err != nil {
+			return "", err
+		}
+	}
+	return iscsi.AttachAndMountDisk(ctx, vol)
+}
@@ -0,0 +1,246 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+// exitError is a failed command with an exit code
+type exitError int
+
+func (e exitError) Error() string { return "exit status" }
+
+func (e exitError) ExitCode() int { return int(e) }
+
+func TestParseRepairPolicy(t *testing.T) {
+	tests := map[string]struct {
+		params   map[string]string
+		expected RepairPolicy
+		isErr    bool
+	}{
+		"default": {
+			params:   map[string]string{},
+			expected: RepairPolicyAuto,
+		},
+		"never": {
+			params:   map[string]string{RepairPolicyKey: "never"},
+			expected: RepairPolicyNever,
+		},
+		"manual": {
+			params:   map[string]string{RepairPolicyKey: "manual"},
+			expected: RepairPolicyManual,
+		},
+		"invalid": {
+			params: map[string]string{RepairPolicyKey: "always"},
+			isErr:  true,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			policy, err := ParseRepairPolicy(mock.params)
+			if mock.isErr != (err != nil) {
+				t.Fatalf("Test {%s} failed: expected error {%v} got {%v}", name, mock.isErr, err)
+			}
+			if policy != mock.expected {
+				t.Fatalf("Test {%s} failed: expected {%s} got {%s}", name, mock.expected, policy)
+			}
+		})
+	}
+}
+
+func TestClassifyReadOnly(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(old string) { sysRoot = old }(sysRoot)
+	sysRoot = root
+
+	write := func(path, data string) {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("block/sdb/device/state", "offline\n")
+	write("block/sdc/device/state", "running\n")
+	write("fs/ext4/sdc/errors_count", "3\n")
+	write("block/sdd/device/state", "running\n")
+	write("fs/ext4/sdd/errors_count", "0\n")
+
+	tests := map[string]struct {
+		device   string
+		expected string
+	}{
+		"offline device":    {device: "/dev/sdb", expected: ReadOnlyDeviceOffline},
+		"filesystem errors": {device: "/dev/sdc", expected: ReadOnlyFilesystemErrors},
+		"no errors":         {device: "/dev/sdd", expected: ReadOnlyUnknown},
+		"unknown device":    {device: "/dev/sde", expected: ReadOnlyUnknown},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			if got := classifyReadOnly(mock.device); got != mock.expected {
+				t.Fatalf("Test {%s} failed: expected {%s} got {%s}", name, mock.expected, got)
+			}
+		})
+	}
+}
+
+func TestRepairFilesystem(t *testing.T) {
+	tests := map[string]struct {
+		fsType      string
+		err         error
+		expectedCmd string
+		isErr       bool
+	}{
+		"clean ext4": {
+			fsType:      "ext4",
+			expectedCmd: "fsck",
+		},
+		"corrected ext4": {
+			fsType:      "ext4",
+			err:         exitError(1),
+			expectedCmd: "fsck",
+		},
+		"uncorrected ext4": {
+			fsType:      "ext4",
+			err:         exitError(4),
+			expectedCmd: "fsck",
+			isErr:       true,
+		},
+		"xfs": {
+			fsType:      "xfs",
+			expectedCmd: "xfs_repair",
+		},
+		"failed xfs": {
+			fsType:      "xfs",
+			err:         errors.New("xfs_repair failed"),
+			expectedCmd: "xfs_repair",
+			isErr:       true,
+		},
+		"unsupported filesystem": {
+			fsType: "btrfs",
+			isErr:  true,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			var ran string
+			exec := mount.NewFakeExec(func(cmd string, args ...string) ([]byte, error) {
+				ran = cmd
+				return []byte("/dev/sdb: clean\n"), mock.err
+			})
+			_, err := repairFilesystem(exec, "/dev/sdb", mock.fsType)
+			if mock.isErr != (err != nil) {
+				t.Fatalf("Test {%s} failed: expected error {%v} got {%v}", name, mock.isErr, err)
+			}
+			if ran != mock.expectedCmd {
+				t.Fatalf("Test {%s} failed: expected command {%s} got {%s}", name, mock.expectedCmd, ran)
+			}
+		})
+	}
+}
+
+func TestEnsureUnused(t *testing.T) {
+	defer func(old func(string) (*os.File, error)) { openExclusive = old }(openExclusive)
+
+	tests := map[string]struct {
+		err   error
+		isErr bool
+	}{
+		"unused device": {},
+		"busy device": {
+			err:   &os.PathError{Op: "open", Path: "/dev/sdb", Err: syscall.EBUSY},
+			isErr: true,
+		},
+		"missing device": {
+			err:   &os.PathError{Op: "open", Path: "/dev/sdb", Err: syscall.ENOENT},
+			isErr: true,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			openExclusive = func(device string) (*os.File, error) {
+				if mock.err != nil {
+					return nil, mock.err
+				}
+				return ioutil.TempFile("", "device")
+			}
+			err := ensureUnused("/dev/sdb")
+			if mock.isErr != (err != nil) {
+				t.Fatalf("Test {%s} failed: expected error {%v} got {%v}", name, mock.isErr, err)
+			}
+		})
+	}
+}
+
+func TestRepairBeforeRemountDeviceOffline(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(old string) { sysRoot = old }(sysRoot)
+	sysRoot = root
+
+	path := filepath.Join(root, "block", "sdb", "device", "state")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("offline\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mountPoint := mount.MountPoint{Device: "/dev/sdb", Path: "/mnt/pv1", Opts: []string{"ro"}}
+	mounter := &mount.FakeMounter{MountPoints: []mount.MountPoint{mountPoint}}
+	vol := &apis.CSIVolume{}
+	vol.Spec.Volume.Name = "pv1"
+
+	// policy is ignored for an offline device since
+	// only a login can recover it
+	for _, policy := range []RepairPolicy{RepairPolicyAuto, RepairPolicyNever, RepairPolicyManual} {
+		vol.Spec.Volume.RepairPolicy = string(policy)
+		if err := repairBeforeRemount(vol, mounter, &mountPoint); err != errDeviceOffline {
+			t.Fatalf("Test {%s} failed: expected error {%v} got {%v}", policy, errDeviceOffline, err)
+		}
+		if len(mounter.Log) != 0 {
+			t.Fatalf("Test {%s} failed: expected no mount actions got {%v}", policy, mounter.Log)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	trace "github.com/openebs/csi/pkg/trace/v1alpha1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDKey is the gRPC metadata key of the id
+// which correlates the logs of a request across the
+// caller & this driver
+const requestIDKey = "x-request-id"
+
+// requestID returns the id set by the caller of the
+// request, else a new random id
+func requestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDKey); len(ids) > 0 && ids[0] != "" {
+			return ids[0]
+		}
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestLogger returns the logger of the given gRPC
+// request. Its logs carry the method, the volume &
+// the node the request is for along with the request
+// id and the trace id to correlate them.
+func requestLogger(ctx context.Context, method string, req interface{}) log.Logger {
+	fields := log.Fields{
+		"method":    method,
+		"requestId": requestID(ctx),
+	}
+	if r, ok := req.(interface{ GetVolumeId() string }); ok && r.GetVolumeId() != "" {
+		fields["volume"] = r.GetVolumeId()
+	}
+	// node of the driver is logged by the base logger,
+	// this is the node a controller request is for
+	if r, ok := req.(interface{ GetNodeId() string }); ok && r.GetNodeId() != "" {
+		fields["targetNode"] = r.GetNodeId()
+	}
+	if traceID := trace.TraceID(ctx); traceID != "" {
+		fields["traceId"] = traceID
+	}
+	return log.With(fields)
+}
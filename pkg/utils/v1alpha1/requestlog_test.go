@@ -0,0 +1,88 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestLogger(t *testing.T) {
+	tests := map[string]struct {
+		ctx            context.Context
+		req            interface{}
+		expectedFields map[string]string
+		absentFields   []string
+	}{
+		"publish request with request id": {
+			ctx: metadata.NewIncomingContext(context.Background(),
+				metadata.Pairs(requestIDKey, "req-1")),
+			req: &csi.ControllerPublishVolumeRequest{VolumeId: "pvc-1", NodeId: "node2"},
+			expectedFields: map[string]string{
+				"method":     "/csi.v1.Controller/ControllerPublishVolume",
+				"requestId":  "req-1",
+				"volume":     "pvc-1",
+				"targetNode": "node2",
+			},
+			absentFields: []string{"traceId"},
+		},
+		"request without volume": {
+			ctx: context.Background(),
+			req: &csi.NodeGetInfoRequest{},
+			expectedFields: map[string]string{
+				"method": "/csi.v1.Controller/ControllerPublishVolume",
+			},
+			absentFields: []string{"volume", "targetNode"},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			requestLogger(mock.ctx, "/csi.v1.Controller/ControllerPublishVolume", mock.req).Infof("test")
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("Test {%s} failed: expected json log got {%s}: %v", name, buf.String(), err)
+			}
+			for k, v := range mock.expectedFields {
+				if got[k] != v {
+					t.Fatalf("Test {%s} failed: expected {%s} to be {%s} got {%v}", name, k, v, got[k])
+				}
+			}
+			for _, k := range mock.absentFields {
+				if _, ok := got[k]; ok {
+					t.Fatalf("Test {%s} failed: expected no {%s} got {%v}", name, k, got[k])
+				}
+			}
+			if id, _ := got["requestId"].(string); id == "" {
+				t.Fatalf("Test {%s} failed: expected a request id", name)
+			}
+		})
+	}
+}
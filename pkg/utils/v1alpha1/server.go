@@ -21,7 +21,7 @@ import (
 	"os"
 	"sync"
 
-	"github.com/golang/glog"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
 	"google.golang.org/grpc"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -55,14 +55,20 @@ func NewNonBlockingGRPCServer() NonBlockingGRPCServer {
 type nonBlockingGRPCServer struct {
 	wg     sync.WaitGroup
 	server *grpc.Server
+
+	// socket is the path of the unix socket this
+	// server listens on, it is empty for tcp
+	socket string
 }
 
 // Start grpc server for serving CSI endpoints
 func (s *nonBlockingGRPCServer) Start(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
 
+	listener := s.listen(endpoint, ids, cs, ns)
+
 	s.wg.Add(1)
 
-	go s.serve(endpoint, ids, cs, ns)
+	go s.serve(listener)
 
 	return
 }
@@ -72,24 +78,41 @@ func (s *nonBlockingGRPCServer) Wait() {
 	s.wg.Wait()
 }
 
-// Stop the service forcefully
+// Stop the service gracefully i.e. new requests
+// are not accepted & this blocks till the in
+// flight requests complete
 func (s *nonBlockingGRPCServer) Stop() {
 	s.server.GracefulStop()
+	s.removeSocket()
 }
 
 // ForceStop the service
 func (s *nonBlockingGRPCServer) ForceStop() {
 	s.server.Stop()
+	s.removeSocket()
+}
+
+// removeSocket removes the unix socket of this
+// server so that it is not left behind once the
+// server stops
+func (s *nonBlockingGRPCServer) removeSocket() {
+	if s.socket == "" {
+		return
+	}
+	if err := os.Remove(s.socket); err != nil && !os.IsNotExist(err) {
+		log.Errorf("Failed to remove %s, error: %s", s.socket, err.Error())
+	}
 }
 
-// serve starts serving requests at the provided endpoint based on the type of
-// plugin. In this function all the csi related interfaces are provided by
-// container-storage-interface
-func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
+// listen creates the grpc server and the listener at
+// the provided endpoint based on the type of plugin.
+// In this function all the csi related interfaces
+// are provided by container-storage-interface
+func (s *nonBlockingGRPCServer) listen(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) net.Listener {
 
 	proto, addr, err := parseEndpoint(endpoint)
 	if err != nil {
-		glog.Fatal(err.Error())
+		log.Fatalf("%v", err)
 	}
 
 	// Clear off the addr if it is already present, this is done to remove stale
@@ -99,13 +122,14 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, c
 	if proto == "unix" {
 		addr = "/" + addr
 		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
-			glog.Fatalf("Failed to remove %s, error: %s", addr, err.Error())
+			log.Fatalf("Failed to remove %s, error: %s", addr, err.Error())
 		}
+		s.socket = addr
 	}
 
 	listener, err := net.Listen(proto, addr)
 	if err != nil {
-		glog.Fatalf("Failed to listen: %v", err)
+		log.Fatalf("Failed to listen: %v", err)
 	}
 
 	opts := []grpc.ServerOption{
@@ -126,9 +150,18 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, c
 		csi.RegisterNodeServer(server, ns)
 	}
 
-	glog.Infof("Listening for connections on address: %#v", listener.Addr())
+	return listener
+}
 
-	// Start serving requests on the grpc server created
-	server.Serve(listener)
+// serve starts serving requests on the grpc server
+// till it is stopped
+func (s *nonBlockingGRPCServer) serve(listener net.Listener) {
+	defer s.wg.Done()
+
+	log.Infof("Listening for connections on address: %#v", listener.Addr())
 
+	// Start serving requests on the grpc server created
+	if err := s.server.Serve(listener); err != nil {
+		log.Errorf("Stopped serving on address %#v: %v", listener.Addr(), err)
+	}
 }
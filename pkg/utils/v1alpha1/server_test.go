@@ -0,0 +1,70 @@
+// Copyright © 2018-2019 The OpenEBS Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNonBlockingGRPCServerStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csi-server")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		stop func(s NonBlockingGRPCServer)
+	}{
+		"graceful stop": {
+			stop: func(s NonBlockingGRPCServer) { s.Stop() },
+		},
+		"force stop": {
+			stop: func(s NonBlockingGRPCServer) { s.ForceStop() },
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			socket := filepath.Join(dir, "csi.sock")
+			s := NewNonBlockingGRPCServer()
+			s.Start("unix://"+socket, nil, nil, nil)
+			if _, err := os.Stat(socket); err != nil {
+				t.Fatalf("expected socket {%s} to exist: %v", socket, err)
+			}
+
+			mock.stop(s)
+
+			stopped := make(chan struct{})
+			go func() {
+				s.Wait()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected server to stop")
+			}
+			if _, err := os.Stat(socket); !os.IsNotExist(err) {
+				t.Fatalf("expected socket {%s} to be removed got: %v", socket, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright © 2018-2019 The OpenEBS Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	csivolume "github.com/openebs/csi/pkg/volume/v1alpha1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// StatusUpdate defines the abstraction to
+// modify the status of a CSIVolume
+type StatusUpdate func(*apis.CSIVolumeStatus)
+
+// WithPhase sets the provided phase against
+// the status
+func WithPhase(phase apis.CSIVolumePhase) StatusUpdate {
+	return func(s *apis.CSIVolumeStatus) {
+		s.Phase = phase
+	}
+}
+
+// WithCondition sets the provided condition against
+// the status. The transition time of the condition
+// is changed only if its status has changed.
+func WithCondition(
+	condType apis.CSIVolumeConditionType,
+	condStatus apis.ConditionStatus,
+	reason, message string,
+) StatusUpdate {
+	return func(s *apis.CSIVolumeStatus) {
+		cond := apis.CSIVolumeCondition{
+			Type:               condType,
+			Status:             condStatus,
+			Reason:             reason,
+			Message:            message,
+			LastTransitionTime: metav1.Now(),
+		}
+		for i := range s.Conditions {
+			if s.Conditions[i].Type != condType {
+				continue
+			}
+			if s.Conditions[i].Status == condStatus {
+				cond.LastTransitionTime = s.Conditions[i].LastTransitionTime
+			}
+			s.Conditions[i] = cond
+			return
+		}
+		s.Conditions = append(s.Conditions, cond)
+	}
+}
+
+// WithError marks the status as failed along
+// with the provided error
+func WithError(err error) StatusUpdate {
+	return func(s *apis.CSIVolumeStatus) {
+		s.Phase = apis.CSIVolumePhaseFailed
+		s.LastError = err.Error()
+	}
+}
+
+// WithRemount increments the remount count of
+// the status
+func WithRemount() StatusUpdate {
+	return func(s *apis.CSIVolumeStatus) {
+		s.RemountCount++
+	}
+}
+
+// WithPaths sets the iSCSI paths of the volume
+// against the status along with the condition
+// that reports if all of them are active
+func WithPaths(paths []apis.CSIVolumePath) StatusUpdate {
+	return func(s *apis.CSIVolumeStatus) {
+		s.Paths = paths
+
+		var inactive []string
+		for _, path := range paths {
+			if !path.Active {
+				inactive = append(inactive, path.Portal)
+			}
+		}
+		if len(inactive) == 0 {
+			WithCondition(apis.CSIVolumePathsHealthy, apis.ConditionTrue,
+				"AllPathsActive", fmt.Sprintf("%d of %d paths are active", len(paths), len(paths)))(s)
+			return
+		}
+		WithCondition(apis.CSIVolumePathsHealthy, apis.ConditionFalse, "PathsInactive",
+			fmt.Sprintf("%d of %d paths are active, inactive: %s",
+				len(paths)-len(inactive), len(paths), strings.Join(inactive, ",")))(s)
+	}
+}
+
+// csiVolumeClient is the subset of the CSIVolume
+// client needed to save the status of a volume
+type csiVolumeClient interface {
+	Get(name string, opts metav1.GetOptions) (*apis.CSIVolume, error)
+	Update(vol *apis.CSIVolume) (*apis.CSIVolume, error)
+	UpdateStatus(vol *apis.CSIVolume) (*apis.CSIVolume, error)
+}
+
+// UpdateCSIVolumeStatus applies the provided updates
+// against the latest copy of the volume's CSIVolume CR
+// & saves its status. Updates are retried on conflicts.
+//
+// NOTE:
+//  Status is informational & hence failure to update
+// it is logged instead of failing the caller.
+func UpdateCSIVolumeStatus(vol *apis.CSIVolume, updates ...StatusUpdate) {
+	if vol == nil || vol.Name == "" {
+		return
+	}
+
+	cli := csivolume.NewKubeclient().WithNamespace(OpenEBSNamespace)
+	if err := saveCSIVolumeStatus(cli, vol.Name, updates...); err != nil {
+		log.Warningf("failed to update status of csivolume {%s}: %v", vol.Name, err)
+	}
+}
+
+// saveCSIVolumeStatus applies the updates to the
+// status of the given CSIVolume and saves it
+//
+// NOTE:
+//  The status subresource of the CSIVolume CRD may
+// not be enabled on clusters where the CRD was
+// installed by an older release. The API server
+// replies NotFound to the status update in that
+// case, hence the whole object is updated instead.
+func saveCSIVolumeStatus(cli csiVolumeClient, name string, updates ...StatusUpdate) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		csivol, err := cli.Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		for _, update := range updates {
+			update(&csivol.Status)
+		}
+		_, err = cli.UpdateStatus(csivol)
+		if k8serror.IsNotFound(err) {
+			_, err = cli.Update(csivol)
+		}
+		return err
+	})
+}
@@ -0,0 +1,249 @@
+// Copyright © 2018-2019 The OpenEBS Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStatusUpdates(t *testing.T) {
+	past := metav1.NewTime(time.Now().Add(-time.Hour))
+	mounted := func(s apis.ConditionStatus) apis.CSIVolumeStatus {
+		return apis.CSIVolumeStatus{
+			Phase: apis.CSIVolumePhaseMounted,
+			Conditions: []apis.CSIVolumeCondition{
+				{Type: apis.CSIVolumeMounted, Status: s, LastTransitionTime: past},
+			},
+		}
+	}
+
+	tests := map[string]struct {
+		status            apis.CSIVolumeStatus
+		updates           []StatusUpdate
+		expectedPhase     apis.CSIVolumePhase
+		expectedCondCount int
+		expectedMounted   apis.ConditionStatus
+		isTimeChanged     bool
+		expectedRemounts  int
+		expectedLastError string
+	}{
+		"new condition is added": {
+			status:            apis.CSIVolumeStatus{Phase: apis.CSIVolumePhasePending},
+			updates:           []StatusUpdate{WithPhase(apis.CSIVolumePhaseMounted), WithCondition(apis.CSIVolumeMounted, apis.ConditionTrue, "Mounted", "")},
+			expectedPhase:     apis.CSIVolumePhaseMounted,
+			expectedCondCount: 1,
+			expectedMounted:   apis.ConditionTrue,
+			isTimeChanged:     true,
+		},
+		"same condition status keeps transition time": {
+			status:            mounted(apis.ConditionTrue),
+			updates:           []StatusUpdate{WithCondition(apis.CSIVolumeMounted, apis.ConditionTrue, "Remounted", "")},
+			expectedPhase:     apis.CSIVolumePhaseMounted,
+			expectedCondCount: 1,
+			expectedMounted:   apis.ConditionTrue,
+		},
+		"changed condition status updates transition time": {
+			status:            mounted(apis.ConditionTrue),
+			updates:           []StatusUpdate{WithPhase(apis.CSIVolumePhaseRemounting), WithCondition(apis.CSIVolumeMounted, apis.ConditionFalse, "MountPointMissing", ""), WithRemount()},
+			expectedPhase:     apis.CSIVolumePhaseRemounting,
+			expectedCondCount: 1,
+			expectedMounted:   apis.ConditionFalse,
+			isTimeChanged:     true,
+			expectedRemounts:  1,
+		},
+		"error marks the volume as failed": {
+			status:            mounted(apis.ConditionTrue),
+			updates:           []StatusUpdate{WithError(errors.New("login failed")), WithCondition(apis.CSIVolumeAttached, apis.ConditionFalse, "LoginFailed", "")},
+			expectedPhase:     apis.CSIVolumePhaseFailed,
+			expectedCondCount: 2,
+			expectedMounted:   apis.ConditionTrue,
+			expectedLastError: "login failed",
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			status := mock.status
+			for _, update := range mock.updates {
+				update(&status)
+			}
+			if status.Phase != mock.expectedPhase {
+				t.Fatalf("expected phase {%s} got {%s}", mock.expectedPhase, status.Phase)
+			}
+			if len(status.Conditions) != mock.expectedCondCount {
+				t.Fatalf("expected {%d} conditions got {%d}", mock.expectedCondCount, len(status.Conditions))
+			}
+			if status.RemountCount != mock.expectedRemounts {
+				t.Fatalf("expected remount count {%d} got {%d}", mock.expectedRemounts, status.RemountCount)
+			}
+			if status.LastError != mock.expectedLastError {
+				t.Fatalf("expected last error {%s} got {%s}", mock.expectedLastError, status.LastError)
+			}
+			for _, cond := range status.Conditions {
+				if cond.Type != apis.CSIVolumeMounted {
+					continue
+				}
+				if cond.Status != mock.expectedMounted {
+					t.Fatalf("expected mounted condition {%s} got {%s}", mock.expectedMounted, cond.Status)
+				}
+				if isTimeChanged := !cond.LastTransitionTime.Equal(&past); isTimeChanged != mock.isTimeChanged {
+					t.Fatalf("expected transition time changed {%t} got {%t}", mock.isTimeChanged, isTimeChanged)
+				}
+			}
+		})
+	}
+}
+
+func TestWithPaths(t *testing.T) {
+	tests := map[string]struct {
+		paths           []apis.CSIVolumePath
+		expectedStatus  apis.ConditionStatus
+		expectedMessage string
+	}{
+		"all paths active": {
+			paths: []apis.CSIVolumePath{
+				{Portal: "10.0.0.1:3260", Active: true},
+				{Portal: "10.0.0.2:3260", Active: true},
+			},
+			expectedStatus:  apis.ConditionTrue,
+			expectedMessage: "2 of 2 paths are active",
+		},
+		"some paths inactive": {
+			paths: []apis.CSIVolumePath{
+				{Portal: "10.0.0.1:3260", Active: true},
+				{Portal: "10.0.0.2:3260"},
+				{Portal: "10.0.0.3:3260"},
+			},
+			expectedStatus:  apis.ConditionFalse,
+			expectedMessage: "1 of 3 paths are active, inactive: 10.0.0.2:3260,10.0.0.3:3260",
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			status := apis.CSIVolumeStatus{}
+			WithPaths(mock.paths)(&status)
+
+			if len(status.Paths) != len(mock.paths) {
+				t.Fatalf("expected {%d} paths got {%d}", len(mock.paths), len(status.Paths))
+			}
+			if len(status.Conditions) != 1 || status.Conditions[0].Type != apis.CSIVolumePathsHealthy {
+				t.Fatalf("expected paths healthy condition got %+v", status.Conditions)
+			}
+			cond := status.Conditions[0]
+			if cond.Status != mock.expectedStatus || cond.Message != mock.expectedMessage {
+				t.Fatalf("expected {%s: %s} got {%s: %s}",
+					mock.expectedStatus, mock.expectedMessage, cond.Status, cond.Message)
+			}
+		})
+	}
+}
+
+// fakeCSIVolumeClient saves the CSIVolume in memory,
+// the status subresource is served only if enabled
+type fakeCSIVolumeClient struct {
+	vol               *apis.CSIVolume
+	statusSubresource bool
+	conflicts         int
+	statusUpdates     int
+	updates           int
+}
+
+func (f *fakeCSIVolumeClient) Get(name string, opts metav1.GetOptions) (*apis.CSIVolume, error) {
+	if f.vol == nil || f.vol.Name != name {
+		return nil, k8serror.NewNotFound(apis.Resource("csivolumes"), name)
+	}
+	return f.vol.DeepCopy(), nil
+}
+
+func (f *fakeCSIVolumeClient) Update(vol *apis.CSIVolume) (*apis.CSIVolume, error) {
+	f.updates++
+	f.vol = vol.DeepCopy()
+	return vol, nil
+}
+
+func (f *fakeCSIVolumeClient) UpdateStatus(vol *apis.CSIVolume) (*apis.CSIVolume, error) {
+	if !f.statusSubresource {
+		return nil, k8serror.NewNotFound(apis.Resource("csivolumes"), vol.Name)
+	}
+	if f.conflicts > 0 {
+		f.conflicts--
+		return nil, k8serror.NewConflict(apis.Resource("csivolumes"), vol.Name, errors.New("stale"))
+	}
+	f.statusUpdates++
+	f.vol.Status = vol.Status
+	return vol, nil
+}
+
+func TestSaveCSIVolumeStatus(t *testing.T) {
+	tests := map[string]struct {
+		client                *fakeCSIVolumeClient
+		isErr                 bool
+		expectedStatusUpdates int
+		expectedUpdates       int
+	}{
+		"status subresource enabled": {
+			client:                &fakeCSIVolumeClient{statusSubresource: true},
+			expectedStatusUpdates: 1,
+		},
+		"status subresource disabled": {
+			client:          &fakeCSIVolumeClient{},
+			expectedUpdates: 1,
+		},
+		"conflict is retried": {
+			client:                &fakeCSIVolumeClient{statusSubresource: true, conflicts: 1},
+			expectedStatusUpdates: 1,
+		},
+		"missing volume": {
+			client: &fakeCSIVolumeClient{statusSubresource: true},
+			isErr:  true,
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			volName := "pvc-1-node1"
+			if !mock.isErr {
+				mock.client.vol = &apis.CSIVolume{ObjectMeta: metav1.ObjectMeta{Name: volName}}
+			}
+
+			err := saveCSIVolumeStatus(mock.client, volName, WithPhase(apis.CSIVolumePhaseMounted))
+			if mock.isErr != (err != nil) {
+				t.Fatalf("Test {%s} failed: expected error {%t} got: %v", name, mock.isErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if mock.client.statusUpdates != mock.expectedStatusUpdates || mock.client.updates != mock.expectedUpdates {
+				t.Fatalf("Test {%s} failed: expected {%d} status updates & {%d} updates got {%d} & {%d}",
+					name, mock.expectedStatusUpdates, mock.expectedUpdates,
+					mock.client.statusUpdates, mock.client.updates)
+			}
+			if mock.client.vol.Status.Phase != apis.CSIVolumePhaseMounted {
+				t.Fatalf("Test {%s} failed: expected phase {%s} got {%s}",
+					name, apis.CSIVolumePhaseMounted, mock.client.vol.Status.Phase)
+			}
+		})
+	}
+}
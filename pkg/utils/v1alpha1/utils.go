@@ -11,28 +11,24 @@ import (
 
 	"golang.org/x/net/context"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
 	apis "github.com/openebs/csi/pkg/apis/openebs.io/core/v1alpha1"
+	config "github.com/openebs/csi/pkg/config/v1alpha1"
 	service "github.com/openebs/csi/pkg/generated/maya/kubernetes/service/v1alpha1"
 	iscsi "github.com/openebs/csi/pkg/iscsi/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	metrics "github.com/openebs/csi/pkg/metrics/v1alpha1"
+	retry "github.com/openebs/csi/pkg/retry/v1alpha1"
+	trace "github.com/openebs/csi/pkg/trace/v1alpha1"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/kubernetes/pkg/util/mount"
 )
 
-const (
-	// TODO make VolumeWaitTimeout as env
-	VolumeWaitTimeout = 2
-
-	// TODO make VolumeWaitRetryCount as env
-	VolumeWaitRetryCount = 6
-
-	// TODO make MonitorMountRetryTimeout as env
-	MonitorMountRetryTimeout = 5
-)
-
 var (
 	// MAPIServerEndpoint is the address to connect
 	// to maya apiserver
@@ -44,17 +40,22 @@ var (
 	// Volumes contains the list of volumes created in case of controller plugin
 	// and list of volumes attached to this node in node plugin
 	// This list is protected by VolumesListLock
-	Volumes map[string]*apis.CSIVolume
+	Volumes = map[string]*apis.CSIVolume{}
 
 	// VolumesListLock is required to protect the above Volumes list
 	VolumesListLock sync.RWMutex
 
 	// ReqMountList contains the list of volumes which are required
 	// to be remounted. This list is secured by ReqMountListLock
-	ReqMountList map[string]bool
+	ReqMountList = map[string]bool{}
 
 	// ReqMountListLock is required to protect the above ReqMount list
 	ReqMountListLock sync.RWMutex
+
+	// VolumeWaitPolicy decides how long to wait for a volume
+	// to be ready and reachable. This is overridden by the
+	// driver as per its config.
+	VolumeWaitPolicy = config.Default().VolumeWaitPolicy()
 )
 
 const (
@@ -62,11 +63,15 @@ const (
 	timeout = 60 * time.Second
 )
 
-func init() {
+// Init discovers the openebs namespace and the maya
+// apiserver endpoint. The driver cannot serve any
+// request without these, hence this needs to be
+// invoked before the driver starts
+func Init() error {
 
 	OpenEBSNamespace = os.Getenv("OPENEBS_NAMESPACE")
 	if OpenEBSNamespace == "" {
-		logrus.Fatalf("OPENEBS_NAMESPACE environment variable not set")
+		return fmt.Errorf("OPENEBS_NAMESPACE environment variable not set")
 	}
 
 	// Get MAPI_ServiceName from env OPENEBS_MAPI_SVC
@@ -75,7 +80,7 @@ func init() {
 	// or delete volumes
 	MAPIServiceName := os.Getenv("OPENEBS_MAPI_SVC")
 	if MAPIServiceName == "" {
-		logrus.Fatalf("OPENEBS_MAPI_SVC environment variable not set")
+		return fmt.Errorf("OPENEBS_MAPI_SVC environment variable not set")
 	}
 
 	svc, err := service.NewKubeclient().
@@ -85,16 +90,13 @@ func init() {
 		// If error occurs over here then there are 2 possibilities either the
 		// service was not created or KubeAPIServer is not reachable
 		// In both the cases the driver cannot be started
-		logrus.Fatalf(err.Error())
+		return err
 	}
 
 	svcIP := svc.Spec.ClusterIP
 	svcPort := strconv.FormatInt(int64(svc.Spec.Ports[0].Port), 10)
 	MAPIServerEndpoint = "http://" + svcIP + ":" + svcPort
-
-	Volumes = map[string]*apis.CSIVolume{}
-	ReqMountList = make(map[string]bool)
-
+	return nil
 }
 
 // parseEndpoint should have a valid prefix(unix/tcp) to return a valid endpoint parts
@@ -109,15 +111,28 @@ func parseEndpoint(ep string) (string, string, error) {
 }
 
 // logGRPC logs all the grpc related errors, i.e the final errors
-// which are returned to the grpc clients
+// which are returned to the grpc clients. Every request is traced
+// as a child of the trace propagated by the client, if any, and
+// gets a logger which correlates all its logs.
 func logGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	logrus.Infof("GRPC call: %s", info.FullMethod)
-	logrus.Infof("GRPC request: %s", protosanitizer.StripSecrets(req))
+	ctx, span := trace.Start(trace.Extract(ctx), info.FullMethod, oteltrace.WithSpanKind(oteltrace.SpanKindServer))
+	if r, ok := req.(interface{ GetVolumeId() string }); ok {
+		span.SetAttributes(attribute.String("volume.id", r.GetVolumeId()))
+	}
+	logger := requestLogger(ctx, info.FullMethod, req)
+	ctx = log.NewContext(ctx, logger)
+
+	logger.Infof("GRPC request: %s", protosanitizer.StripSecrets(req))
+	start := time.Now()
 	resp, err := handler(ctx, req)
+	code := status.Code(err).String()
+	metrics.ObserveGRPCRequest(info.FullMethod, code, time.Since(start))
+	span.SetAttributes(attribute.String("rpc.grpc.status_code", code))
+	trace.End(span, err)
 	if err != nil {
-		logrus.Errorf("GRPC error: %v", err)
+		logger.Errorf("GRPC error: %v", err)
 	} else {
-		logrus.Infof("GRPC response: %s", protosanitizer.StripSecrets(resp))
+		logger.Infof("GRPC response: %s", protosanitizer.StripSecrets(resp))
 	}
 	return resp, err
 }
@@ -129,59 +144,61 @@ func ChmodMountPath(mountPath string) error {
 }
 
 // WaitForVolumeToBeReachable keeps the mounts on hold until the volume is
-// reachable
-func WaitForVolumeToBeReachable(targetPortal string) error {
-	var (
-		retries int
-		err     error
-		conn    net.Conn
-	)
+// reachable. It gives up as per VolumeWaitPolicy or when the context is done.
+func WaitForVolumeToBeReachable(ctx context.Context, targetPortal string) (err error) {
+	var dialer net.Dialer
+	// portal may be an IPv6 address & may not have a port
+	targetPortal = iscsi.NormalizePortal(targetPortal)
+
+	ctx, span := trace.Start(ctx, "WaitForVolumeToBeReachable")
+	span.SetAttributes(attribute.String("iscsi.portal", targetPortal))
+	defer func() { trace.End(span, err) }()
 
-	for {
+	err = VolumeWaitPolicy.Do(ctx, func() error {
 		// Create a connection to test if the iSCSI Portal is reachable,
-		if conn, err = net.Dial("tcp", targetPortal); err == nil {
-			conn.Close()
-			logrus.Infof("Volume is reachable to create connections")
-			return nil
-		}
-		// wait until the iSCSI targetPortal is reachable
-		// There is no pointn of triggering iSCSIadm login commands
-		// until the portal is reachable
-		time.Sleep(VolumeWaitTimeout * time.Second)
-		retries++
-		if retries >= VolumeWaitRetryCount {
-			// Let the caller function decide further if the volume is not reachable
-			// even after 12 seconds ( This number was arrived at
-			// based on the kubelets retrying logic. Kubelet retries to publish
-			// volume after every 14s )
-			return fmt.Errorf("iSCSI Target not reachable, TargetPortal %v, err:%v",
-				targetPortal, err)
+		// There is no point of triggering iSCSIadm login commands until the
+		// portal is reachable
+		conn, err := dialer.DialContext(ctx, "tcp", targetPortal)
+		if err != nil {
+			return err
 		}
+		conn.Close()
+		log.FromContext(ctx).Infof("Volume is reachable to create connections")
+		return nil
+	})
+	if err != nil {
+		// Let the caller function decide further if the volume is not reachable
+		return fmt.Errorf("iSCSI Target not reachable, TargetPortal %v, err:%v",
+			targetPortal, err)
 	}
+	return nil
 }
 
 // WaitForVolumeToBeReady retrieves the volume info from cstorVolume CR and
-// waits until consistency factor is met for connected replicas
-func WaitForVolumeToBeReady(volumeID string) error {
-	var retries int
-checkVolumeStatus:
-	// Status is fetched from cstorVolume CR
-	volStatus, err := getVolStatus(volumeID)
+// waits until consistency factor is met for connected replicas, or until all
+// the replicas are healthy if the policy denies degraded volumes. It gives up
+// as per VolumeWaitPolicy or when the context is done.
+func WaitForVolumeToBeReady(ctx context.Context, volumeID string, policy DegradedPolicy) (err error) {
+	ctx, span := trace.Start(ctx, "WaitForVolumeToBeReady")
+	span.SetAttributes(attribute.String("degraded.policy", string(policy)))
+	defer func() { trace.End(span, err) }()
+
+	err = VolumeWaitPolicy.Do(ctx, func() error {
+		// Status is fetched from cstorVolume CR
+		cv, err := getCStorVolume(volumeID)
+		if err != nil {
+			return retry.Permanent(err)
+		}
+		if err := volumeReadiness(cv, policy); err != nil {
+			return err
+		}
+		log.FromContext(ctx).Infof("Volume is ready to accept IOs")
+		return nil
+	})
 	if err != nil {
-		return err
-	} else if volStatus == "Healthy" || volStatus == "Degraded" {
-		// In both healthy and degraded states the volume can serve IOs
-		logrus.Infof("Volume is ready to accept IOs")
-	} else if retries >= VolumeWaitRetryCount {
 		// Let the caller function decide further if the volume is still not
-		// ready to accdept IOs after 12 seconds ( This number was arrived at
-		// based on the kubelets retrying logic. Kubelet retries to publish
-		// volume after every 14s )
-		return fmt.Errorf("Volume is not ready: Replicas yet to connect to controller")
-	} else {
-		time.Sleep(VolumeWaitTimeout * time.Second)
-		retries++
-		goto checkVolumeStatus
+		// ready to accept IOs
+		return fmt.Errorf("volume {%s} is not ready: %v", volumeID, err)
 	}
 	return nil
 }
@@ -220,6 +237,24 @@ func GetVolumeDetails(volumeID, mountPath string, readOnly bool, mountOptions []
 	vol.Spec.ISCSI.Lun = pv.Spec.CSI.VolumeAttributes["lun"]
 	vol.Spec.ISCSI.IscsiInterface = pv.Spec.CSI.VolumeAttributes["iscsiInterface"]
 	vol.Spec.ISCSI.TargetPortal = pv.Spec.CSI.VolumeAttributes["targetPortal"]
+	vol.Spec.ISCSI.Portals = pv.Spec.CSI.VolumeAttributes["portals"]
+	vol.Spec.ISCSI.SessionSettings, err = iscsi.SessionSettings(pv.Spec.CSI.VolumeAttributes)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ParseRepairPolicy(pv.Spec.CSI.VolumeAttributes)
+	if err != nil {
+		return nil, err
+	}
+	vol.Spec.Volume.RepairPolicy = string(policy)
+	degradedPolicy, err := ParseDegradedPolicy(pv.Spec.CSI.VolumeAttributes)
+	if err != nil {
+		return nil, err
+	}
+	vol.Spec.Volume.DegradedPolicy = string(degradedPolicy)
+	if claim := pv.Spec.ClaimRef; claim != nil {
+		vol.Spec.Volume.PersistentVolumeClaim = claim.Namespace + "/" + claim.Name
+	}
 	return &vol, nil
 }
 
@@ -233,75 +268,28 @@ func listContains(mountPath string, list []mount.MountPoint) (*mount.MountPoint,
 	return nil, false
 }
 
-// MonitorMounts makes sure that all the volumes present in the inmemory list
-// with the driver are mounted with the original mount options
-// This function runs a never ending loop therefore should be run as a goroutine
-// Mounted list is fetched from the OS and the state of all the volumes is
-// reverified after every 5 seconds. If the mountpoint is not present in the
-// list or if it has been remounted with a different mount option by the OS, the
-// volume is added to the ReqMountList which is removed as soon as the remount
-// operation on the volume is complete
-// For each remount operation a new goroutine is created, so that if multiple
-// volumes have lost their original state they can all be remounted in parallel
-func MonitorMounts() {
-	mounter := mount.New("")
-	ticker := time.NewTicker(MonitorMountRetryTimeout * time.Second)
-	for {
-		select {
-		case <-ticker.C:
-			// Get list of mounted paths present with the node
-			list, _ := mounter.List()
-			VolumesListLock.RLock()
-			for _, vol := range Volumes {
-				if vol.Spec.Volume.DevicePath == "" {
-					// If device path is not set implies the node publish
-					// operation is not completed yet
-					continue
-				}
-				// Search the volume in the list of mounted volumes at the node
-				// retrieved above
-				mountPoint, exists := listContains(vol.Spec.Volume.MountPath, list)
-				// If the volume is present in the list verify its state
-				if exists && verifyMountOpts(mountPoint.Opts, "rw") {
-					// Continue with remaining volumes since this volume looks
-					// to be in good shape
-					continue
-				}
-				// Skip remount if the volume is already being remounted
-				if _, isRemounting := ReqMountList[vol.Spec.Volume.Name]; isRemounting {
-					continue
-				}
-				// Add volume to the reqMountList and start a goroutine to
-				// remount it
-				ReqMountListLock.Lock()
-				ReqMountList[vol.Spec.Volume.Name] = true
-				ReqMountListLock.Unlock()
-				go RemountVolume(exists, vol, mountPoint, vol.Spec.Volume.MountPath)
-			}
-			VolumesListLock.RUnlock()
-		}
-	}
-}
-
 // WaitForVolumeReadyAndReachable waits until the volume is ready to accept IOs
 // and is reachable, this function will not come out until both the conditions
-// are met. This function stops the driver from overloading the OS with iSCSI
-// login commands.
-func WaitForVolumeReadyAndReachable(vol *apis.CSIVolume) {
-	for {
-		// This function return after 12s in case the volume is not ready
-		if err := WaitForVolumeToBeReady(vol.Spec.Volume.Name); err != nil {
-			logrus.Error(err)
-			// Keep retrying until the volume is ready
-			continue
+// are met or the context is done. This function stops the driver from
+// overloading the OS with iSCSI login commands.
+func WaitForVolumeReadyAndReachable(ctx context.Context, vol *apis.CSIVolume) error {
+	// Keep retrying until the volume is ready
+	policy := VolumeWaitPolicy
+	policy.MaxElapsedTime = 0
+
+	return policy.Do(ctx, func() error {
+		// Volume which was published already is
+		// recovered even if it is degraded
+		if err := WaitForVolumeToBeReady(ctx, vol.Spec.Volume.Name, DegradedPolicyAllow); err != nil {
+			log.FromContext(ctx).Errorf("%v", err)
+			return err
 		}
-		// This function return after 12s in case the volume is not reachable
-		if err := WaitForVolumeToBeReachable(vol.Spec.ISCSI.TargetPortal); err == nil {
-			return
-		} else {
-			logrus.Error(err)
+		if err := WaitForVolumeToBeReachable(ctx, vol.Spec.ISCSI.TargetPortal); err != nil {
+			log.FromContext(ctx).Errorf("%v", err)
+			return err
 		}
-	}
+		return nil
+	})
 }
 
 func verifyMountOpts(opts []string, desiredOpt string) bool {
@@ -313,32 +301,72 @@ func verifyMountOpts(opts []string, desiredOpt string) bool {
 	return false
 }
 
+// reportRemounting reports the volume which is not
+// mounted in the desired mode as being remounted
+func reportRemounting(vol *apis.CSIVolume, exists bool, desiredMountOpt string) {
+	reason := "MountPointMissing"
+	if exists {
+		reason = "MountOptionsChanged"
+	}
+	UpdateCSIVolumeStatus(vol,
+		WithPhase(apis.CSIVolumePhaseRemounting),
+		WithCondition(apis.CSIVolumeMounted, apis.ConditionFalse, reason,
+			"volume is not mounted in "+desiredMountOpt+" mode"),
+		WithRemount(),
+	)
+}
+
 // RemountVolume unmounts the volume if it is already mounted in an undesired
 // state and then tries to mount again. If it is not mounted the volume, first
-// the disk will be attached via iSCSI login and then it will be mounted
-func RemountVolume(exists bool, vol *apis.CSIVolume, mountPoint *mount.MountPoint, desiredMountOpt string) (devicePath string, err error) {
+// the disk will be attached via iSCSI login and then it will be mounted. The
+// volume is expected to be ready & reachable and locked by the caller.
+func RemountVolume(ctx context.Context, exists bool, vol *apis.CSIVolume, mountPoint *mount.MountPoint, desiredMountOpt string) (devicePath string, err error) {
 	mounter := mount.New("")
-	options := []string{"rw"}
-	// Wait until it is possible to chhange the state of mountpoint or when
-	// login to volume is possible
-	WaitForVolumeReadyAndReachable(vol)
+	options := []string{desiredMountOpt}
+
 	if exists {
-		logrus.Infof("MountPoint:%v IN RO MODE", mountPoint.Path)
+		log.FromContext(ctx).Infof("MountPoint:%v IN RO MODE", mountPoint.Path)
+		if desiredMountOpt == "rw" {
+			VolumeRefs(vol).Warning("ReadOnly",
+				"volume {%s} went read only at {%s}", vol.Spec.Volume.Name, mountPoint.Path)
+		}
 		// Unmout and mount operation is performed instead of just remount since
-		// the remount option didn't give the desired results
-		mounter.Unmount(mountPoint.Path)
-		err = mounter.Mount(mountPoint.Device,
-			mountPoint.Path, "", options)
+		// the remount option didn't give the desired results. Filesystem of a
+		// volume which went read only is repaired in between as per its policy
+		// while a volume whose device went offline is logged in to again.
+		if desiredMountOpt == "rw" {
+			err = repairBeforeRemount(vol, mounter, mountPoint)
+		} else {
+			mounter.Unmount(mountPoint.Path)
+		}
+		if err == errDeviceOffline {
+			devicePath, err = reloginVolume(ctx, vol, mounter, mountPoint)
+		} else if err == nil {
+			err = mounter.Mount(mountPoint.Device,
+				mountPoint.Path, "", options)
+		}
 	} else {
 		// A complete attach and mount is performed if for some reason disk is
 		// not present in the mounted list with the OS.
-		devicePath, err = iscsi.AttachAndMountDisk(vol)
+		devicePath, err = iscsi.AttachAndMountDisk(ctx, vol)
 		//TODO Updadate devicePath in inmemory list and CR
 	}
-	ReqMountListLock.Lock()
-	// Remove the volume from ReqMountList once the remount operation is
-	// complete
-	delete(ReqMountList, vol.Spec.Volume.Name)
-	ReqMountListLock.Unlock()
+	if err != nil {
+		UpdateCSIVolumeStatus(vol,
+			WithError(err),
+			WithCondition(apis.CSIVolumeMounted, apis.ConditionFalse, "RemountFailed", err.Error()),
+		)
+		VolumeRefs(vol).Warning("RemountFailed",
+			"failed to remount volume {%s} in %s mode: %v", vol.Spec.Volume.Name, desiredMountOpt, err)
+	} else {
+		UpdateCSIVolumeStatus(vol,
+			WithPhase(apis.CSIVolumePhaseMounted),
+			WithCondition(apis.CSIVolumeMounted, apis.ConditionTrue, "Remounted",
+				"volume is mounted in "+desiredMountOpt+" mode"),
+		)
+		VolumeRefs(vol).Normal("Remounted",
+			"volume {%s} is remounted in %s mode", vol.Spec.Volume.Name, desiredMountOpt)
+	}
+	metrics.ObserveRemount(err)
 	return
 }
@@ -0,0 +1,103 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	apismaya "github.com/openebs/csi/pkg/apis/openebs.io/maya/v1alpha1"
+	csv "github.com/openebs/csi/pkg/generated/maya/cstorvolume/v1alpha1"
+	log "github.com/openebs/csi/pkg/log/v1alpha1"
+	metrics "github.com/openebs/csi/pkg/metrics/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/volume/util/fs"
+)
+
+const (
+	// persistentVolumeLabelKey is the label of the
+	// CStorVolume with the name of its PV
+	persistentVolumeLabelKey = "openebs.io/persistent-volume"
+
+	// replicaInQuorum is the quorum of a replica which
+	// is part of the quorum of its volume
+	replicaInQuorum = "1"
+)
+
+// volumeHealth returns the health of the volume as
+// reported by the target in the given CStorVolume
+func volumeHealth(cv *apismaya.CStorVolume) metrics.VolumeHealth {
+	health := metrics.VolumeHealth{
+		Name:              cv.Labels[persistentVolumeLabelKey],
+		ReplicationFactor: cv.Spec.ReplicationFactor,
+		ConsistencyFactor: cv.Spec.ConsistencyFactor,
+		Replicas:          map[string]int{},
+	}
+	if health.Name == "" {
+		health.Name = cv.Name
+	}
+
+	for _, replica := range cv.Status.ReplicaStatuses {
+		health.Replicas[replica.Mode]++
+		if replica.Quorum == replicaInQuorum {
+			health.QuorumReplicas++
+		}
+	}
+
+	if cv.Spec.Capacity != "" {
+		capacity, err := resource.ParseQuantity(cv.Spec.Capacity)
+		if err != nil {
+			log.Warningf("invalid capacity {%s} of cstorvolume {%s}: %v", cv.Spec.Capacity, cv.Name, err)
+		} else {
+			health.CapacityBytes = float64(capacity.Value())
+		}
+	}
+	return health
+}
+
+// ListVolumeHealth returns the health of all the
+// cstor volumes
+func ListVolumeHealth() ([]metrics.VolumeHealth, error) {
+	volumeList, err := csv.NewKubeclient().WithNamespace(OpenEBSNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	vols := make([]metrics.VolumeHealth, 0, len(volumeList.Items))
+	for i := range volumeList.Items {
+		vols = append(vols, volumeHealth(&volumeList.Items[i]))
+	}
+	return vols, nil
+}
+
+// Usage returns the filesystem usage of the volumes
+// being monitored
+func (m *MountMonitor) Usage() []metrics.VolumeUsage {
+	vols := m.snapshot()
+	usage := make([]metrics.VolumeUsage, 0, len(vols))
+	for _, vol := range vols {
+		_, capacity, used, _, _, _, err := fs.FsInfo(vol.Spec.Volume.MountPath)
+		if err != nil {
+			log.Warningf("failed to get usage of volume {%s}: %v", vol.Spec.Volume.Name, err)
+			continue
+		}
+		usage = append(usage, metrics.VolumeUsage{
+			Name:       vol.Spec.Volume.Name,
+			UsedBytes:  float64(used),
+			TotalBytes: float64(capacity),
+		})
+	}
+	return usage
+}
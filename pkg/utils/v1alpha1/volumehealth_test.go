@@ -0,0 +1,88 @@
+/*
+Copyright © 2018-2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	apismaya "github.com/openebs/csi/pkg/apis/openebs.io/maya/v1alpha1"
+	metrics "github.com/openebs/csi/pkg/metrics/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVolumeHealth(t *testing.T) {
+	tests := map[string]struct {
+		cv       *apismaya.CStorVolume
+		expected metrics.VolumeHealth
+	}{
+		"degraded volume": {
+			cv: &apismaya.CStorVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "pvc-1",
+					Labels: map[string]string{persistentVolumeLabelKey: "pvc-1"},
+				},
+				Spec: apismaya.CStorVolumeSpec{
+					Capacity:          "5G",
+					ReplicationFactor: 3,
+					ConsistencyFactor: 2,
+				},
+				Status: apismaya.CStorVolumeStatus{
+					ReplicaStatuses: []apismaya.ReplicaStatus{
+						{ID: "r1", Mode: "Healthy", Quorum: "1"},
+						{ID: "r2", Mode: "Healthy", Quorum: "1"},
+						{ID: "r3", Mode: "Degraded", Quorum: "0"},
+					},
+				},
+			},
+			expected: metrics.VolumeHealth{
+				Name:              "pvc-1",
+				ReplicationFactor: 3,
+				ConsistencyFactor: 2,
+				Replicas:          map[string]int{"Healthy": 2, "Degraded": 1},
+				QuorumReplicas:    2,
+				CapacityBytes:     5e9,
+			},
+		},
+		"volume without label or status": {
+			cv: &apismaya.CStorVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc-2"},
+				Spec: apismaya.CStorVolumeSpec{
+					Capacity:          "invalid",
+					ReplicationFactor: 1,
+					ConsistencyFactor: 1,
+				},
+			},
+			expected: metrics.VolumeHealth{
+				Name:              "pvc-2",
+				ReplicationFactor: 1,
+				ConsistencyFactor: 1,
+				Replicas:          map[string]int{},
+			},
+		},
+	}
+	for name, mock := range tests {
+		name := name // pin it
+		mock := mock // pin it
+		t.Run(name, func(t *testing.T) {
+			got := volumeHealth(mock.cv)
+			if !reflect.DeepEqual(got, mock.expected) {
+				t.Fatalf("Test {%s} failed: expected {%+v} got {%+v}", name, mock.expected, got)
+			}
+		})
+	}
+}
@@ -53,6 +53,10 @@ type delFn func(cli *clientset.Clientset, name, namespace string, opts *metav1.D
 // updating csi volume instance
 type updateFn func(cs *clientset.Clientset, vol *apis.CSIVolume, namespace string) (*apis.CSIVolume, error)
 
+// updateStatusFn is a typed function that abstracts
+// updating status of csi volume instance
+type updateStatusFn func(cs *clientset.Clientset, vol *apis.CSIVolume, namespace string) (*apis.CSIVolume, error)
+
 // Kubeclient enables kubernetes API operations
 // on csi volume instance
 type Kubeclient struct {
@@ -75,6 +79,7 @@ type Kubeclient struct {
 	del                 delFn
 	create              createFn
 	update              updateFn
+	updateStatus        updateStatusFn
 }
 
 // KubeclientBuildOption defines the abstraction
@@ -138,6 +143,12 @@ func (k *Kubeclient) withDefaults() {
 			return cs.OpenebsV1alpha1().CSIVolumes(namespace).Update(vol)
 		}
 	}
+
+	if k.updateStatus == nil {
+		k.updateStatus = func(cs *clientset.Clientset, vol *apis.CSIVolume, namespace string) (*apis.CSIVolume, error) {
+			return cs.OpenebsV1alpha1().CSIVolumes(namespace).UpdateStatus(vol)
+		}
+	}
 }
 
 // WithClientSet sets the kubernetes client against
@@ -275,3 +286,14 @@ func (k *Kubeclient) Update(vol *apis.CSIVolume) (*apis.CSIVolume, error) {
 
 	return k.update(cs, vol, k.namespace)
 }
+
+// UpdateStatus updates the status of this csi
+// volume instance against kubernetes cluster
+func (k *Kubeclient) UpdateStatus(vol *apis.CSIVolume) (*apis.CSIVolume, error) {
+	cs, err := k.getClientOrCached()
+	if err != nil {
+		return nil, err
+	}
+
+	return k.updateStatus(cs, vol, k.namespace)
+}